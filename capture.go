@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"xp-pen-controller/internal/tablet"
+	"xp-pen-controller/internal/ui"
+)
+
+// captureOptions are the flags of the capture command
+var captureOptions struct {
+	output string
+}
+
+var captureCommand = &command{
+	name:    "capture",
+	summary: "Record raw tablet reports to a file",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&captureOptions.output, "o", "capture.txt", "output file")
+	},
+	run: runCapture,
+}
+
+// replayOptions are the flags of the replay command
+var replayOptions struct {
+	speed float64
+}
+
+var replayCommand = &command{
+	name:    "replay",
+	args:    "<capture file>",
+	summary: "Draw a recorded capture on the whiteboard",
+	flags: func(fs *flag.FlagSet) {
+		fs.Float64Var(&replayOptions.speed, "speed", 1, "playback speed relative to the recording, 0 for as fast as possible")
+	},
+	run: runReplay,
+}
+
+// runCapture records reports until interrupted
+func runCapture(env *environment, args []string) error {
+	tc := env.newTablet()
+	if err := tc.Connect(); err != nil {
+		return err
+	}
+	defer tc.Disconnect()
+
+	f, err := os.Create(captureOptions.output)
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+	defer f.Close()
+
+	capture, err := tablet.NewCaptureWriter(f, env.profile.Name)
+	if err != nil {
+		return err
+	}
+	defer capture.Flush()
+
+	// Stop cleanly on Ctrl+C so buffered reports are written
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		tc.Disconnect()
+	}()
+
+	fmt.Printf("Recording %s to %s, press Ctrl+C to stop\n", env.profile.Name, captureOptions.output)
+	count := 0
+	for tc.IsConnected() {
+		report, err := tc.ReadReport()
+		if err != nil {
+			continue
+		}
+		if err := capture.WriteReport(report); err != nil {
+			return err
+		}
+		count++
+	}
+
+	fmt.Printf("Recorded %d reports\n", count)
+	return nil
+}
+
+// runReplay feeds a capture into the whiteboard as if it came from the tablet
+func runReplay(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one capture file")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open capture: %w", err)
+	}
+	reports, profileName, err := tablet.ReadCapture(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	window := ui.NewWhiteboardWindow()
+	profile := env.profile
+	if env.config.Profile == "" && profileName != "" {
+		// Decode with the profile the capture was recorded with
+		if p, err := tablet.FindProfile(profileName, ""); err == nil {
+			profile = *p
+		}
+	}
+	window.Tablet().SetProfile(profile)
+	window.ConnectReportDevice(tablet.NewReplayDevice(reports, replayOptions.speed))
+
+	window.Show()
+	return nil
+}
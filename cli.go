@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"xp-pen-controller/internal/config"
+	"xp-pen-controller/internal/logging"
+	"xp-pen-controller/internal/tablet"
+)
+
+// command is a scrawl subcommand
+type command struct {
+	name    string
+	args    string // Usage of positional arguments
+	summary string
+	// flags registers command-specific flags; it may be nil
+	flags func(fs *flag.FlagSet)
+	run   func(env *environment, args []string) error
+}
+
+// commonFlags are accepted by every command
+type commonFlags struct {
+	configPath string
+	logLevel   string
+	logFile    string
+	device     string
+	profile    string
+}
+
+// environment is the configuration shared by all commands
+type environment struct {
+	config  *config.Config
+	profile tablet.Profile
+}
+
+// register adds the common flags to a flag set
+func (cf *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&cf.configPath, "config", config.DefaultPath(), "configuration file")
+	fs.StringVar(&cf.logLevel, "log-level", "", `log level, e.g. "debug" or "info,tablet=debug" (default $`+logging.LevelEnv+` or info)`)
+	fs.StringVar(&cf.logFile, "log-file", "", "also write JSON logs to this file (default $"+logging.FileEnv+")")
+	fs.StringVar(&cf.device, "device", "", "HID device path to use instead of searching for the tablet")
+	fs.StringVar(&cf.profile, "profile", "", "tablet profile name or file (default "+tablet.DefaultProfile.Name+")")
+}
+
+// load reads the configuration file, applies flag overrides, sets up
+// logging and resolves the tablet profile
+func (cf *commonFlags) load() (*environment, error) {
+	cfg, err := config.Load(cf.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags take precedence over the configuration file
+	if cf.logLevel != "" {
+		cfg.LogLevel = cf.logLevel
+	}
+	if cf.logFile != "" {
+		cfg.LogFile = cf.logFile
+	}
+	if cf.device != "" {
+		cfg.Device = cf.device
+	}
+	if cf.profile != "" {
+		cfg.Profile = cf.profile
+	}
+
+	if err := logging.SetupFromEnv(cfg.LogLevel, cfg.LogFile); err != nil {
+		return nil, fmt.Errorf("invalid logging configuration: %w", err)
+	}
+
+	profile := tablet.DefaultProfile
+	if cfg.Profile != "" {
+		p, err := tablet.FindProfile(cfg.Profile, config.ProfileDir())
+		if err != nil {
+			return nil, err
+		}
+		profile = *p
+	}
+
+	return &environment{config: cfg, profile: profile}, nil
+}
+
+// newTablet creates a tablet controller for the configured profile and device
+func (env *environment) newTablet() *tablet.TabletController {
+	tc := tablet.NewTabletController()
+	tc.SetProfile(env.profile)
+	tc.SetDevicePath(env.config.Device)
+	return tc
+}
+
+// commands lists all subcommands; the first one runs when none is given
+var commands = []*command{
+	whiteboardCommand,
+	devicesCommand,
+	monitorCommand,
+	discoverCommand,
+	captureCommand,
+	replayCommand,
+	exportCommand,
+	framesCommand,
+	driverCommand,
+	sendCommand,
+	ctlCommand,
+}
+
+// runCLI parses the arguments and runs the selected command
+func runCLI(args []string) error {
+	cmd := commands[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] == "help" {
+			printUsage()
+			return nil
+		}
+		cmd = findCommand(args[0])
+		if cmd == nil {
+			printUsage()
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("scrawl "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: scrawl %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	var common commonFlags
+	common.register(fs)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	env, err := common.load()
+	if err != nil {
+		return err
+	}
+	defer logging.Close()
+
+	return cmd.run(env, fs.Args())
+}
+
+// findCommand returns the command with the given name
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// printUsage lists the available commands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: scrawl [command] [flags] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "scrawl <command> -h" for the flags of a command.`)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xp-pen-controller/internal/control"
+)
+
+// ctlOptions are the flags of the ctl command
+var ctlOptions struct {
+	socket string
+}
+
+var ctlCommand = &command{
+	name:    "ctl",
+	args:    "<method> [value] [name=value ...]",
+	summary: "Control a running whiteboard, e.g. clear, undo, open, export or subscribe",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&ctlOptions.socket, "socket", "", "control socket of the whiteboard (default "+control.DefaultSocket()+")")
+	},
+	run: runCtl,
+}
+
+// mainParams names the parameter a bare value sets, e.g. the path in
+// "scrawl ctl open board.scrawl"
+var mainParams = map[string]string{
+	"save":     "path",
+	"open":     "path",
+	"export":   "path",
+	"set-mode": "mode",
+}
+
+// runCtl calls one method of the control API and prints its result. After
+// subscribe it prints every event until the whiteboard closes.
+func runCtl(env *environment, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected a method: %s", strings.Join(control.Methods, ", "))
+	}
+	method := args[0]
+	params, err := ctlParams(method, args[1:])
+	if err != nil {
+		return err
+	}
+
+	socket := ctlOptions.socket
+	if socket == "" {
+		socket = env.config.ControlSocket
+	}
+	if socket == "" || socket == controlOff {
+		socket = control.DefaultSocket()
+	}
+	client, err := control.Dial(socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	result, err := client.Call(method, params)
+	if err != nil {
+		return err
+	}
+	if method != "subscribe" {
+		var out bytes.Buffer
+		if err := json.Indent(&out, result, "", "  "); err != nil {
+			return fmt.Errorf("invalid result: %w", err)
+		}
+		fmt.Println(out.String())
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for {
+		event, err := client.Next()
+		if err != nil {
+			return nil // The whiteboard was closed
+		}
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+}
+
+// ctlParams builds the parameters of a call from "name=value" arguments.
+// Values that are valid JSON, such as numbers and true, keep their type.
+// Paths are made absolute, as the whiteboard may run elsewhere.
+func ctlParams(method string, args []string) (map[string]any, error) {
+	params := make(map[string]any)
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			if mainParams[method] == "" {
+				return nil, fmt.Errorf("expected name=value, got %q", arg)
+			}
+			name, value = mainParams[method], arg
+		}
+
+		var v any = value
+		if json.Valid([]byte(value)) {
+			json.Unmarshal([]byte(value), &v)
+		}
+		if name == "path" {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %w", value, err)
+			}
+			v = abs
+		}
+		params[name] = v
+	}
+	return params, nil
+}
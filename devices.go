@@ -4,9 +4,18 @@ import (
 	"fmt"
 
 	"github.com/karalabe/hid"
+
+	"xp-pen-controller/internal/tablet"
 )
 
-func debugMain() {
+var devicesCommand = &command{
+	name:    "devices",
+	summary: "List HID devices and identify XP-Pen tablets",
+	run:     runDevices,
+}
+
+// runDevices enumerates HID devices
+func runDevices(env *environment, args []string) error {
 	fmt.Println("Scanning for all HID devices...")
 
 	// List all HID devices
@@ -20,12 +29,13 @@ func debugMain() {
 		fmt.Printf("   Product: %s\n", device.Product)
 		fmt.Printf("   Serial: %s\n", device.Serial)
 		fmt.Printf("   Path: %s\n", device.Path)
+		fmt.Printf("   Interface: %d, Usage Page: 0x%04x, Usage: 0x%04x\n", device.Interface, device.UsagePage, device.Usage)
 		fmt.Println()
 	}
 
 	// Specifically look for XP-Pen devices
 	fmt.Println("Looking specifically for XP-Pen devices...")
-	xpPenDevices := hid.Enumerate(0x28bd, 0) // XP-Pen vendor ID, any product
+	xpPenDevices := hid.Enumerate(env.profile.VendorID, 0) // XP-Pen vendor ID, any product
 
 	if len(xpPenDevices) > 0 {
 		fmt.Printf("Found %d XP-Pen devices:\n", len(xpPenDevices))
@@ -34,6 +44,21 @@ func debugMain() {
 			fmt.Printf("   Product: %s\n", device.Product)
 		}
 	} else {
-		fmt.Println("No XP-Pen devices found with vendor ID 0x28bd")
+		fmt.Printf("No XP-Pen devices found with vendor ID 0x%04x\n", env.profile.VendorID)
+	}
+
+	// Input devices created by the kernel driver can be used with -evdev
+	inputDevices, err := tablet.ListEvdev()
+	if err != nil {
+		return err
 	}
+	if len(inputDevices) > 0 {
+		fmt.Println()
+		fmt.Println("Input event devices (for whiteboard -evdev):")
+		for _, device := range inputDevices {
+			fmt.Printf("   %s  %s\n", device.Path, device.Name)
+		}
+	}
+
+	return nil
 }
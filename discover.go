@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"xp-pen-controller/internal/config"
+	"xp-pen-controller/internal/diag"
+	"xp-pen-controller/internal/tablet"
+)
+
+// discoverOptions are the flags of the discover command
+var discoverOptions struct {
+	name    string
+	output  string
+	vendor  string
+	product string
+}
+
+var discoverCommand = &command{
+	name:    "discover",
+	summary: "Work out the report layout of an unknown tablet and save a profile",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&discoverOptions.name, "name", "discovered", "name of the new profile")
+		fs.StringVar(&discoverOptions.output, "o", "", "profile file to write (default <profile dir>/<name>.json)")
+		fs.StringVar(&discoverOptions.vendor, "vendor", "", "USB vendor ID of the tablet in hex, e.g. 28bd")
+		fs.StringVar(&discoverOptions.product, "product", "", "USB product ID of the tablet in hex, e.g. 0914")
+	},
+	run: runDiscover,
+}
+
+// runDiscover guides the user through the wizard steps, records the reports
+// of each step and saves the proposed profile
+func runDiscover(env *environment, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	// The identifiers of an unknown model have to be given explicitly
+	profile := env.profile
+	if discoverOptions.vendor != "" {
+		id, err := strconv.ParseUint(discoverOptions.vendor, 16, 16)
+		if err != nil {
+			return fmt.Errorf("invalid vendor ID: %w", err)
+		}
+		profile.VendorID = uint16(id)
+	}
+	if discoverOptions.product != "" {
+		id, err := strconv.ParseUint(discoverOptions.product, 16, 16)
+		if err != nil {
+			return fmt.Errorf("invalid product ID: %w", err)
+		}
+		profile.ProductID = uint16(id)
+	}
+
+	tc := tablet.NewTabletController()
+	tc.SetProfile(profile)
+	tc.SetDevicePath(env.config.Device)
+	if err := tc.Connect(); err != nil {
+		return err
+	}
+	defer tc.Disconnect()
+
+	info := tc.DeviceInfo()
+	fmt.Printf("Discovering the report layout of %s (%04x:%04x)\n", info.Product, info.VendorID, info.ProductID)
+	fmt.Println("Follow each instruction, then press Enter and keep going until the step ends.")
+
+	// Read reports in the background so none are lost while prompting
+	reports := make(chan []byte, 1024)
+	go func() {
+		defer close(reports)
+		for tc.IsConnected() {
+			report, err := tc.ReadReport()
+			if err != nil {
+				return
+			}
+			reports <- report
+		}
+	}()
+
+	stdin := bufio.NewReader(os.Stdin)
+	rec := diag.Recording{}
+	for i, step := range diag.WizardSteps {
+		fmt.Printf("\nStep %d of %d: %s\nPress Enter to start recording for %d seconds.", i+1, len(diag.WizardSteps), step.Prompt, step.Seconds)
+		if _, err := stdin.ReadString('\n'); err != nil {
+			return fmt.Errorf("failed to read from terminal: %w", err)
+		}
+
+		drainReports(reports)
+		recorded, ok := collectReports(reports, time.Duration(step.Seconds)*time.Second)
+		rec[step.Step] = recorded
+		fmt.Printf("Recorded %d reports\n", len(recorded))
+		if !ok {
+			return fmt.Errorf("tablet disconnected")
+		}
+	}
+
+	proposed, findings, err := diag.ProposeProfile(discoverOptions.name, info.VendorID, info.ProductID, rec)
+	fmt.Println("\nFindings:")
+	for _, f := range findings {
+		fmt.Printf("  %-10s %s\n", f.Name, f.Detail)
+	}
+	if err != nil {
+		return err
+	}
+	// The layout was recorded after the handshake, so it needs it too
+	proposed.Init = profile.Init
+
+	path := discoverOptions.output
+	if path == "" {
+		path = filepath.Join(config.ProfileDir(), discoverOptions.name+tablet.ProfileExtension)
+	}
+	if err := tablet.SaveProfile(proposed, path); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nSaved profile to %s\n", path)
+	fmt.Printf("Check it with: scrawl monitor --profile %s\n", discoverOptions.name)
+	return nil
+}
+
+// drainReports discards reports that arrived while waiting for the user
+func drainReports(reports <-chan []byte) {
+	for {
+		select {
+		case <-reports:
+		default:
+			return
+		}
+	}
+}
+
+// collectReports gathers reports for the given duration. It returns false
+// if the tablet stopped sending reports.
+func collectReports(reports <-chan []byte, d time.Duration) ([][]byte, bool) {
+	var recorded [][]byte
+	deadline := time.After(d)
+	for {
+		select {
+		case report, ok := <-reports:
+			if !ok {
+				return recorded, false
+			}
+			recorded = append(recorded, report)
+		case <-deadline:
+			return recorded, true
+		}
+	}
+}
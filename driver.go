@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+
+	"xp-pen-controller/internal/driver"
+	"xp-pen-controller/internal/tablet"
+)
+
+// driverOptions are the flags of the driver command
+var driverOptions struct {
+	evdev string
+	name  string
+}
+
+var driverCommand = &command{
+	name:    "driver",
+	summary: "Forward the pen to a virtual tablet so every application receives it (Linux)",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&driverOptions.evdev, "evdev", "", "read the pen from a Linux input device, given by name or /dev/input path, instead of raw HID")
+		fs.StringVar(&driverOptions.name, "name", "scrawl virtual pen", "name of the virtual tablet")
+	},
+	run: runDriver,
+}
+
+// runDriver reads the pen, processes each sample and sends it to a uinput
+// virtual tablet until interrupted
+func runDriver(env *environment, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	// Open the source before creating the virtual tablet, so that searching
+	// input devices by name never finds our own device
+	source, err := openPenSource(env, driverOptions.evdev)
+	if err != nil {
+		return err
+	}
+	defer source.Disconnect()
+
+	// The kernel would otherwise keep sending the pen to every application
+	// as well, which then receives it twice
+	release, err := grabSource(source)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	sink, err := driver.OpenUinput(driverOptions.name, driver.DefaultAxes)
+	if err != nil {
+		return err
+	}
+	virtual := driver.NewVirtualTablet(sink, driver.DefaultAxes)
+	defer virtual.Close()
+
+	processor := driver.NewProcessor(source, env.config.PressureCurve, env.config.Smoothing)
+
+	// Stop cleanly on Ctrl+C so the pen is lifted before the device goes away
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	var interrupted atomic.Bool
+	go func() {
+		<-interrupt
+		interrupted.Store(true)
+		source.Disconnect()
+	}()
+
+	fmt.Printf("Forwarding pen input to %q, press Ctrl+C to stop\n", driverOptions.name)
+	for source.IsConnected() {
+		pen, err := source.ReadPenData()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, tablet.ErrDisconnected) {
+			if interrupted.Load() {
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		if err := virtual.Send(processor.Process(pen)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grabSource takes the kernel's input devices for the tablet away from
+// other applications while the driver runs, and returns a function giving
+// them back
+func grabSource(source tablet.PenSource) (func(), error) {
+	switch s := source.(type) {
+	case *tablet.EvdevSource:
+		if err := s.Grab(); err != nil {
+			return nil, fmt.Errorf("%w; is another driver using the device?", err)
+		}
+		// Disconnect releases it
+		return func() {}, nil
+	case *tablet.TabletController:
+		info := s.DeviceInfo()
+		paths, release, err := tablet.GrabEvdevByID(info.VendorID, info.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("%w; the pen would reach applications twice", err)
+		}
+		if len(paths) > 0 {
+			fmt.Printf("Taking %s from the kernel driver\n", strings.Join(paths, ", "))
+		}
+		return release, nil
+	}
+	return func() {}, nil
+}
+
+// openPenSource connects to the tablet through raw HID, or through a Linux
+// input device if one is given or configured
+func openPenSource(env *environment, evdev string) (tablet.PenSource, error) {
+	if evdev == "" {
+		evdev = env.config.Evdev
+	}
+	if evdev != "" {
+		return tablet.OpenEvdev(evdev)
+	}
+
+	tc := env.newTablet()
+	if err := tc.Connect(); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
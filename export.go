@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/render"
+)
+
+// exportOptions are the flags of the export command
+var exportOptions struct {
+	output string
+	width  int
+	height int
+	fps    int
+	speed  float64
+}
+
+var exportCommand = &command{
+	name:    "export",
+	args:    "<drawing" + drawing.FileExtension + ">",
+	summary: "Render a drawing to PNG or JPEG, or its replay to an animated GIF",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&exportOptions.output, "o", "", "output file, .png, .jpg or .gif for an animated replay (default: input name with .png)")
+		fs.IntVar(&exportOptions.width, "width", 0, "image width in pixels (default: canvas width)")
+		fs.IntVar(&exportOptions.height, "height", 0, "image height in pixels (default: keeps the canvas aspect ratio)")
+		fs.IntVar(&exportOptions.fps, "fps", render.DefaultAnimationOptions.FrameRate, "frames per second of an animated replay")
+		fs.Float64Var(&exportOptions.speed, "speed", render.DefaultAnimationOptions.Speed, "playback speed of an animated replay")
+	},
+	run: runExport,
+}
+
+// runExport renders a drawing headlessly
+func runExport(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one drawing file")
+	}
+
+	c, err := loadDrawing(args[0])
+	if err != nil {
+		return err
+	}
+
+	output := exportOptions.output
+	if output == "" {
+		output = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".png"
+	}
+
+	width, height := render.ImageSize(c, exportOptions.width, exportOptions.height)
+	if strings.EqualFold(filepath.Ext(output), ".gif") {
+		return exportAnimation(c, output, width, height)
+	}
+	img := render.Canvas(c, width, height)
+
+	if err := render.WriteImage(output, img); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s (%dx%d)\n", output, width, height)
+	return nil
+}
+
+// exportAnimation writes the replay of a drawing as an animated GIF
+func exportAnimation(c *drawing.Canvas, output string, width, height int) error {
+	replay := drawing.NewReplay(c)
+	opts := render.DefaultAnimationOptions
+	opts.Width, opts.Height = width, height
+	opts.FrameRate = exportOptions.fps
+	opts.Speed = exportOptions.speed
+
+	err := render.WriteFile(output, func(w io.Writer) error {
+		return render.WriteGIF(w, replay, opts)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s (%dx%d, %s replay)\n", output, width, height, replay.Duration().Round(time.Millisecond))
+	return nil
+}
+
+// loadDrawing reads a drawing in the native format
+func loadDrawing(path string) (*drawing.Canvas, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open drawing: %w", err)
+	}
+	defer f.Close()
+
+	c, err := drawing.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/render"
+)
+
+// framesOptions are the flags of the frames command
+var framesOptions struct {
+	output string
+	width  int
+	height int
+	fps    int
+	speed  float64
+	cursor bool
+}
+
+var framesCommand = &command{
+	name:    "frames",
+	args:    "<drawing" + drawing.FileExtension + ">",
+	summary: "Render the replay of a drawing as numbered PNG frames or a Y4M video stream",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&framesOptions.output, "o", "frames", "directory for PNG frames, a .y4m file, or - for a Y4M stream on standard output")
+		fs.IntVar(&framesOptions.width, "width", 0, "frame width in pixels (default: canvas width)")
+		fs.IntVar(&framesOptions.height, "height", 0, "frame height in pixels (default: keeps the canvas aspect ratio)")
+		fs.IntVar(&framesOptions.fps, "fps", 30, "frames per second")
+		fs.Float64Var(&framesOptions.speed, "speed", 1, "playback speed relative to real time")
+		fs.BoolVar(&framesOptions.cursor, "cursor", false, "show the pen position")
+	},
+	run: runFrames,
+}
+
+// runFrames renders a replay for piping into a video encoder, e.g.
+//
+//	scrawl frames -o - board.scrawl | ffmpeg -i - board.mp4
+func runFrames(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one drawing file")
+	}
+
+	c, err := loadDrawing(args[0])
+	if err != nil {
+		return err
+	}
+	if framesOptions.fps <= 0 {
+		return fmt.Errorf("frame rate must be positive")
+	}
+	replay := drawing.NewReplay(c)
+
+	opts := render.DefaultAnimationOptions
+	opts.Width, opts.Height = render.ImageSize(c, framesOptions.width, framesOptions.height)
+	opts.FrameRate = framesOptions.fps
+	opts.Speed = framesOptions.speed
+	opts.Cursor = framesOptions.cursor
+
+	output := framesOptions.output
+	switch {
+	case output == "-":
+		err = writeY4M(os.Stdout, replay, opts)
+	case strings.EqualFold(filepath.Ext(output), ".y4m"):
+		err = writeY4MFile(output, replay, opts)
+	default:
+		err = writePNGFrames(output, replay, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Standard output may carry the video, so progress goes to standard error
+	fmt.Fprintf(os.Stderr, "Rendered %s (%dx%d at %d fps, %s replay)\n",
+		output, opts.Width, opts.Height, opts.FrameRate, replay.Duration())
+	return nil
+}
+
+// writePNGFrames writes every frame to a numbered PNG file in the directory
+func writePNGFrames(dir string, replay *drawing.Replay, opts render.AnimationOptions) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	// Frames are written often, so favour speed over size
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	n := 0
+	return render.WriteFrames(replay, opts, func(img *image.RGBA) error {
+		n++
+		path := filepath.Join(dir, fmt.Sprintf("frame-%05d.png", n))
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		if err := encoder.Encode(f, img); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to encode %s: %w", path, err)
+		}
+		return f.Close()
+	})
+}
+
+// writeY4MFile writes the frames as a Y4M video file
+func writeY4MFile(path string, replay *drawing.Replay, opts render.AnimationOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := writeY4M(f, replay, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeY4M writes the frames as a Y4M stream. 4:2:0 chroma needs an even
+// frame size, so an odd dimension loses a pixel.
+func writeY4M(w io.Writer, replay *drawing.Replay, opts render.AnimationOptions) error {
+	opts.Width &^= 1
+	opts.Height &^= 1
+
+	yw, err := render.NewY4MWriter(w, opts.Width, opts.Height, opts.FrameRate)
+	if err != nil {
+		return err
+	}
+	if err := render.WriteFrames(replay, opts, yw.WriteFrame); err != nil {
+		return err
+	}
+	return yw.Flush()
+}
@@ -0,0 +1,325 @@
+package collab
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// peerBuffer is the number of deltas queued for a peer. A peer that falls
+// further behind is disconnected; it reconnects and resyncs.
+const peerBuffer = 1024
+
+// reconnectDelay is how long Connect waits before dialling again
+const reconnectDelay = 2 * time.Second
+
+// handshakeTimeout bounds the exchange of the first packets
+const handshakeTimeout = 10 * time.Second
+
+// nonceSize is the length of the challenge each whiteboard sends
+const nonceSize = 32
+
+// Roles in the proofs, so a whiteboard cannot answer a challenge with the
+// proof it was just sent
+const (
+	roleJoin   = "join"
+	roleListen = "listen"
+)
+
+// packet is one line of the protocol: newline-delimited JSON in both
+// directions. Each whiteboard proves it knows the token by answering the
+// other's challenge, without sending the token itself:
+//
+//  1. the joining whiteboard sends its user and a random nonce;
+//  2. the listening one answers with its own user and nonce, and a proof
+//     over both nonces;
+//  3. the joining one checks the proof and sends its proof with its board;
+//  4. the listening one checks that proof and sends its board.
+//
+// After that, every packet carries a delta.
+type packet struct {
+	User  string `json:"user,omitempty"`  // Only in the handshake
+	Nonce []byte `json:"nonce,omitempty"` // Only in the handshake
+	Proof []byte `json:"proof,omitempty"` // Only in the handshake
+	Delta Delta  `json:"delta"`
+}
+
+// peer is a connected whiteboard
+type peer struct {
+	conn net.Conn
+	user string
+	out  chan Delta
+}
+
+// send queues a delta, dropping the peer if it is too far behind
+func (p *peer) send(d Delta) {
+	select {
+	case p.out <- d:
+	default:
+		logger.Warn("collaborator fell behind, dropping it", "user", p.user, "remote", p.conn.RemoteAddr())
+		p.conn.Close()
+	}
+}
+
+// Listen accepts whiteboards on the address, e.g. ":7070", and returns the
+// address it listens on. Other machines can only join if a token is set.
+func (s *Session) Listen(addr string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for collaborators: %w", err)
+	}
+	if tcp, ok := listener.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() && s.token == "" {
+		listener.Close()
+		return nil, fmt.Errorf("a shared token is required to let other machines join on %s", addr)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return nil, net.ErrClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Error("collaboration listener stopped", "err", err)
+				}
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				if err := s.serve(conn, true); err != nil {
+					logger.Info("collaborator disconnected", "remote", conn.RemoteAddr(), "err", err)
+				}
+			}()
+		}
+	}()
+	logger.Info("accepting collaborators", "addr", listener.Addr())
+	return listener.Addr(), nil
+}
+
+// Connect joins the whiteboard listening on the address. It returns at once
+// and keeps reconnecting until the session is closed.
+func (s *Session) Connect(addr string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		dialer := net.Dialer{Timeout: 10 * time.Second}
+		for {
+			conn, err := dialer.Dial("tcp", addr)
+			if err == nil {
+				logger.Info("joined whiteboard", "addr", addr)
+				err = s.serve(conn, false)
+			}
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			logger.Warn("collaboration connection lost, retrying", "addr", addr, "err", err)
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+}
+
+// serve exchanges the boards with a peer and then keeps them in sync until
+// the connection ends. Neither whiteboard sends its board before the other
+// has proven it knows the token.
+func (s *Session) serve(conn net.Conn, listening bool) error {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	var user string
+	var board Delta
+	var p *peer
+	var err error
+	if listening {
+		user, board, p, err = s.acceptHandshake(conn, encoder, decoder)
+	} else {
+		user, board, p, err = s.joinHandshake(conn, encoder, decoder)
+	}
+	if p != nil {
+		defer s.leave(p)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	s.mu.Lock()
+	p.user = user
+	s.mu.Unlock()
+	logger.Info("collaborator connected", "user", p.user, "remote", conn.RemoteAddr())
+	s.apply(board, p)
+
+	// The writer owns the encoder until stop is closed
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for {
+			select {
+			case d := <-p.out:
+				if err := encoder.Encode(packet{Delta: d}); err != nil {
+					conn.Close()
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-writerDone
+	}()
+
+	for {
+		var msg packet
+		if err := decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to read from collaborator: %w", err)
+		}
+		s.apply(msg.Delta, p)
+	}
+}
+
+// acceptHandshake answers a joining whiteboard's challenge, checks its
+// answer to ours and then exchanges the boards. It returns the peer's user
+// and board.
+func (s *Session) acceptHandshake(conn net.Conn, encoder *json.Encoder, decoder *json.Decoder) (string, Delta, *peer, error) {
+	hello, err := readPacket(decoder)
+	if err != nil {
+		return "", Delta{}, nil, err
+	}
+	if len(hello.Nonce) != nonceSize {
+		return "", Delta{}, nil, fmt.Errorf("collaborator %q sent no challenge", hello.User)
+	}
+
+	nonce := newNonce()
+	reply := packet{User: s.user, Nonce: nonce, Proof: s.proof(roleListen, hello.Nonce, nonce)}
+	if err := encoder.Encode(reply); err != nil {
+		return "", Delta{}, nil, fmt.Errorf("failed to answer collaborator: %w", err)
+	}
+
+	answer, err := readPacket(decoder)
+	if err != nil {
+		return "", Delta{}, nil, err
+	}
+	if !hmac.Equal(answer.Proof, s.proof(roleJoin, hello.Nonce, nonce)) {
+		return "", Delta{}, nil, fmt.Errorf("collaborator %q does not know the token", hello.User)
+	}
+
+	p, err := s.join(conn, encoder, nil)
+	return hello.User, answer.Delta, p, err
+}
+
+// joinHandshake challenges the listening whiteboard, answers its challenge
+// once it has proven it knows the token, and then exchanges the boards. It
+// returns the peer's user and board.
+func (s *Session) joinHandshake(conn net.Conn, encoder *json.Encoder, decoder *json.Decoder) (string, Delta, *peer, error) {
+	nonce := newNonce()
+	if err := encoder.Encode(packet{User: s.user, Nonce: nonce}); err != nil {
+		return "", Delta{}, nil, fmt.Errorf("failed to greet collaborator: %w", err)
+	}
+
+	hello, err := readPacket(decoder)
+	if err != nil {
+		return "", Delta{}, nil, err
+	}
+	if len(hello.Nonce) != nonceSize || !hmac.Equal(hello.Proof, s.proof(roleListen, nonce, hello.Nonce)) {
+		return "", Delta{}, nil, fmt.Errorf("whiteboard %q does not know the token", hello.User)
+	}
+
+	p, err := s.join(conn, encoder, s.proof(roleJoin, nonce, hello.Nonce))
+	if err != nil {
+		return "", Delta{}, p, err
+	}
+	board, err := readPacket(decoder)
+	return hello.User, board.Delta, p, err
+}
+
+// newNonce returns a random challenge
+func newNonce() []byte {
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+	return nonce
+}
+
+// proof answers a challenge for a role: an HMAC of both nonces keyed with
+// the token, which cannot be made without knowing it
+func (s *Session) proof(role string, joinNonce, listenNonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(s.token))
+	mac.Write([]byte(role))
+	mac.Write(joinNonce)
+	mac.Write(listenNonce)
+	return mac.Sum(nil)
+}
+
+// join registers a peer and sends it the whole board, together with a
+// proof if one is given. Changes made while the board is sent are queued
+// for the peer.
+func (s *Session) join(conn net.Conn, encoder *json.Encoder, proof []byte) (*peer, error) {
+	p := &peer{conn: conn, out: make(chan Delta, peerBuffer)}
+
+	// Taking the board and registering the peer under the canvas lock
+	// makes sure no change falls between the two
+	s.canvas.Lock()
+	full := s.state.full()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.canvas.Unlock()
+		return nil, net.ErrClosed
+	}
+	s.peers[p] = struct{}{}
+	s.mu.Unlock()
+	s.canvas.Unlock()
+
+	if err := encoder.Encode(packet{Proof: proof, Delta: full}); err != nil {
+		return p, fmt.Errorf("failed to send board to collaborator: %w", err)
+	}
+	return p, nil
+}
+
+// leave forgets a disconnected peer
+func (s *Session) leave(p *peer) {
+	s.mu.Lock()
+	delete(s.peers, p)
+	s.mu.Unlock()
+}
+
+// readPacket reads a handshake packet of a peer
+func readPacket(decoder *json.Decoder) (packet, error) {
+	var msg packet
+	if err := decoder.Decode(&msg); err != nil {
+		return msg, fmt.Errorf("failed to read from collaborator: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,206 @@
+// Package collab lets several whiteboards draw on the same board over the
+// network.
+//
+// Every board keeps a replicated set of strokes (see Delta) and sends its
+// changes to its peers as they happen. One whiteboard listens and the
+// others connect to it; it relays changes between them. A peer that loses
+// the connection keeps drawing, reconnects, and both sides exchange their
+// whole board to catch up.
+package collab
+
+import (
+	"image/color"
+	"net"
+	"slices"
+	"sync"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/logging"
+)
+
+var logger = logging.For(logging.Net)
+
+// Session shares a canvas with other whiteboards
+type Session struct {
+	canvas *drawing.Canvas
+	user   string
+	token  string // Shared secret peers must send, empty for none
+
+	// Guarded by the canvas lock
+	state    *state
+	ids      map[*drawing.Stroke]Stamp // Stamps of the strokes on the board
+	applying bool                      // Changes come from a peer, not the user
+
+	mu        sync.Mutex
+	peers     map[*peer]struct{}
+	listeners []net.Listener
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewSession shares the canvas as the given user. New strokes are drawn in
+// the user's colour, or in the canvas colour if it is nil, and undo only
+// takes back the user's own strokes. Strokes already on the canvas become
+// the user's.
+func NewSession(c *drawing.Canvas, user string, col color.Color) *Session {
+	s := &Session{
+		canvas: c,
+		user:   user,
+		state:  newState(newSite()),
+		ids:    make(map[*drawing.Stroke]Stamp),
+		peers:  make(map[*peer]struct{}),
+		done:   make(chan struct{}),
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.Owner = user
+	if col != nil {
+		c.Color = col
+	}
+	for _, stroke := range c.Strokes {
+		s.add(stroke)
+	}
+	c.Observe(s.observe)
+	return s
+}
+
+// SetToken sets the secret that whiteboards must share to draw together.
+// It must be called before Listen and Connect.
+func (s *Session) SetToken(token string) {
+	s.token = token
+}
+
+// User returns the name the session draws as
+func (s *Session) User() string {
+	return s.user
+}
+
+// add records a local stroke with a new stamp. The canvas lock must be held.
+func (s *Session) add(stroke *drawing.Stroke) Delta {
+	if stroke.Owner == "" {
+		stroke.Owner = s.user
+	}
+	stamp := s.state.stamp()
+	s.ids[stroke] = stamp
+	return s.state.merge(Delta{Add: []Add{{Stamp: stamp, Stroke: stroke}}})
+}
+
+// observe turns local changes into deltas for the peers. It runs with the
+// canvas lock held.
+func (s *Session) observe(event drawing.Event) {
+	if s.applying {
+		return
+	}
+
+	var d Delta
+	switch event.Kind {
+	case drawing.EventEnd, drawing.EventRedo, drawing.EventAdd:
+		d = s.add(event.Stroke)
+	case drawing.EventUndo:
+		stamp, ok := s.ids[event.Stroke]
+		if !ok {
+			return
+		}
+		delete(s.ids, event.Stroke)
+		d = s.state.merge(Delta{Remove: []Stamp{stamp}})
+	case drawing.EventClear:
+		clear(s.ids)
+		d = s.state.merge(Delta{Cleared: s.state.stamp()})
+	case drawing.EventReplace:
+		// A drawing was opened: it replaces the board for everyone
+		clear(s.ids)
+		d = s.state.merge(Delta{Cleared: s.state.stamp()})
+		for _, stroke := range s.canvas.Strokes {
+			added := s.add(stroke)
+			d.Add = append(d.Add, added.Add...)
+		}
+	default:
+		return
+	}
+	s.broadcast(d, nil)
+}
+
+// apply merges a delta from a peer into the board and passes what was new
+// on to the other peers
+func (s *Session) apply(d Delta, from *peer) {
+	c := s.canvas
+	c.Lock()
+	defer c.Unlock()
+
+	fresh := s.state.merge(d)
+	if fresh.Empty() {
+		return
+	}
+	for _, stamp := range fresh.Remove {
+		for stroke, id := range s.ids {
+			if id == stamp {
+				delete(s.ids, stroke)
+			}
+		}
+	}
+	if fresh.Cleared != (Stamp{}) {
+		for stroke, id := range s.ids {
+			if !s.state.live(id) {
+				delete(s.ids, stroke)
+			}
+		}
+	}
+
+	s.applying = true
+	visible := s.state.visible()
+	if len(visible) >= len(c.Strokes) && slices.Equal(visible[:len(c.Strokes)], c.Strokes) {
+		// The common case: new strokes on top
+		for _, stroke := range visible[len(c.Strokes):] {
+			c.AddStroke(stroke)
+		}
+	} else {
+		c.SetStrokes(visible)
+	}
+	s.applying = false
+
+	s.broadcast(fresh, from)
+}
+
+// broadcast queues a delta for every peer except the one it came from
+func (s *Session) broadcast(d Delta, from *peer) {
+	if d.Empty() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.peers {
+		if p != from {
+			p.send(d)
+		}
+	}
+}
+
+// Peers returns the number of connected whiteboards
+func (s *Session) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.peers)
+}
+
+// Close disconnects from all peers and stops listening
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for p := range s.peers {
+		p.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,287 @@
+package collab
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+const testToken = "secret"
+
+// board is a whiteboard taking part in a test session
+type board struct {
+	canvas  *drawing.Canvas
+	session *Session
+}
+
+// newBoard starts a session for a user on an empty canvas
+func newBoard(t *testing.T, user, token string) *board {
+	t.Helper()
+	c := drawing.NewCanvas(800, 600)
+	s := NewSession(c, user, nil)
+	s.SetToken(token)
+	t.Cleanup(func() { s.Close() })
+	return &board{canvas: c, session: s}
+}
+
+// listen makes the board accept others on a loopback port
+func (b *board) listen(t *testing.T) string {
+	t.Helper()
+	addr, err := b.session.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr.String()
+}
+
+// draw draws a short stroke starting at x
+func (b *board) draw(x float64) {
+	b.canvas.Lock()
+	defer b.canvas.Unlock()
+	b.canvas.StartStroke(drawing.Point{X: x, Y: 10, Pressure: 0.5})
+	b.canvas.AddPointToCurrentStroke(drawing.Point{X: x + 5, Y: 20, Pressure: 0.5})
+	b.canvas.FinishStroke()
+}
+
+// strokes describes the strokes on the board from bottom to top
+func (b *board) strokes() []string {
+	b.canvas.Lock()
+	defer b.canvas.Unlock()
+	var strokes []string
+	for _, s := range b.canvas.Strokes {
+		strokes = append(strokes, fmt.Sprintf("%s@%g", s.Owner, s.Points[0].X))
+	}
+	return strokes
+}
+
+// peers returns the number of whiteboards connected to the board
+func (b *board) peers() int {
+	return b.session.Peers()
+}
+
+// eventually waits until the condition holds
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// converged waits until all boards show the same strokes and returns them
+func converged(t *testing.T, boards ...*board) []string {
+	t.Helper()
+	var strokes []string
+	eventually(t, "the boards agree", func() bool {
+		strokes = boards[0].strokes()
+		for _, b := range boards[1:] {
+			if !slices.Equal(b.strokes(), strokes) {
+				return false
+			}
+		}
+		return true
+	})
+	return strokes
+}
+
+// connected starts a listening board and joins the others to it
+func connected(t *testing.T, users ...string) []*board {
+	t.Helper()
+	host := newBoard(t, users[0], testToken)
+	addr := host.listen(t)
+	boards := []*board{host}
+	for _, user := range users[1:] {
+		b := newBoard(t, user, testToken)
+		b.session.Connect(addr)
+		boards = append(boards, b)
+	}
+	eventually(t, "everyone joined", func() bool { return host.peers() == len(users)-1 })
+	return boards
+}
+
+func TestConcurrentStrokesConverge(t *testing.T) {
+	boards := connected(t, "alice", "bob", "carol")
+
+	const perUser = 20
+	var wg sync.WaitGroup
+	for i, b := range boards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perUser {
+				b.draw(float64(i*1000 + j))
+			}
+		}()
+	}
+	wg.Wait()
+
+	strokes := converged(t, boards...)
+	if len(strokes) != 3*perUser {
+		t.Errorf("%d strokes on the boards, want %d", len(strokes), 3*perUser)
+	}
+}
+
+func TestUndoOnlyTakesBackOwnStrokes(t *testing.T) {
+	boards := connected(t, "alice", "bob")
+	alice, bob := boards[0], boards[1]
+
+	alice.draw(1)
+	converged(t, alice, bob)
+	bob.draw(2)
+	converged(t, alice, bob)
+	alice.draw(3)
+	converged(t, alice, bob)
+
+	// Bob's undo skips Alice's newer stroke
+	bob.canvas.Lock()
+	bob.canvas.Undo()
+	bob.canvas.Unlock()
+
+	want := []string{"alice@1", "alice@3"}
+	if got := converged(t, alice, bob); !slices.Equal(got, want) {
+		t.Errorf("boards show %v, want %v", got, want)
+	}
+
+	// Nothing of Bob's is left to undo
+	bob.canvas.Lock()
+	undone := bob.canvas.Undo()
+	bob.canvas.Unlock()
+	if undone {
+		t.Error("Bob could undo another user's stroke")
+	}
+}
+
+func TestClearReachesEveryone(t *testing.T) {
+	boards := connected(t, "alice", "bob", "carol")
+	for i, b := range boards {
+		b.draw(float64(i))
+	}
+	converged(t, boards...)
+
+	// A joined board clears; the change is relayed through the host
+	boards[2].canvas.Lock()
+	boards[2].canvas.Clear()
+	boards[2].canvas.Unlock()
+
+	if got := converged(t, boards...); len(got) != 0 {
+		t.Errorf("boards show %v after clearing", got)
+	}
+}
+
+func TestResyncAfterConnectionLoss(t *testing.T) {
+	boards := connected(t, "alice", "bob")
+	alice, bob := boards[0], boards[1]
+	alice.draw(1)
+	converged(t, alice, bob)
+
+	// Cut the connection and keep drawing on both sides
+	alice.session.mu.Lock()
+	for p := range alice.session.peers {
+		p.conn.Close()
+	}
+	alice.session.mu.Unlock()
+	eventually(t, "the connection is gone", func() bool { return alice.peers() == 0 })
+	alice.draw(2)
+	bob.draw(3)
+
+	// Bob reconnects and both swap their boards
+	eventually(t, "bob reconnected", func() bool { return alice.peers() == 1 })
+	// Strokes drawn apart are stacked in the same, but arbitrary, order
+	got := converged(t, alice, bob)
+	slices.Sort(got)
+	want := []string{"alice@1", "alice@2", "bob@3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("boards show %v, want %v", got, want)
+	}
+}
+
+func TestWrongTokenIsRejected(t *testing.T) {
+	alice := newBoard(t, "alice", testToken)
+	addr := alice.listen(t)
+	alice.draw(1)
+
+	// A raw client gets a challenge, but not the board, without the token
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	encoder, decoder := json.NewEncoder(conn), json.NewDecoder(conn)
+	encoder.Encode(packet{User: "mallory", Nonce: newNonce()})
+	var challenge packet
+	if err := decoder.Decode(&challenge); err != nil || len(challenge.Nonce) != nonceSize || !challenge.Delta.Empty() {
+		t.Fatalf("challenge %+v, %v", challenge, err)
+	}
+	encoder.Encode(packet{Proof: make([]byte, sha256.Size)})
+	if err := decoder.Decode(&challenge); err == nil {
+		t.Errorf("the board was sent to a client with the wrong token: %+v", challenge)
+	}
+
+	// A whiteboard with the wrong token never joins
+	mallory := newBoard(t, "mallory", "guess")
+	mallory.session.Connect(addr)
+	time.Sleep(200 * time.Millisecond)
+	if alice.peers() != 0 || len(mallory.strokes()) != 0 {
+		t.Errorf("whiteboard with the wrong token joined: %d peers, %v", alice.peers(), mallory.strokes())
+	}
+}
+
+func TestJoinDoesNotRevealTokenOrBoard(t *testing.T) {
+	// An impostor listening where the whiteboard joins
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	bob := newBoard(t, "bob", testToken)
+	bob.draw(3)
+	bob.session.Connect(listener.Addr().String())
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(conn)
+	if !lines.Scan() {
+		t.Fatal("the whiteboard sent no greeting")
+	}
+	if strings.Contains(lines.Text(), testToken) {
+		t.Errorf("greeting %s contains the token", lines.Text())
+	}
+	var hello packet
+	if err := json.Unmarshal(lines.Bytes(), &hello); err != nil || len(hello.Nonce) != nonceSize || !hello.Delta.Empty() {
+		t.Fatalf("greeting %+v, %v", hello, err)
+	}
+
+	// Without a valid proof the board never follows
+	json.NewEncoder(conn).Encode(packet{User: "mallory", Nonce: newNonce(), Proof: make([]byte, sha256.Size)})
+	if lines.Scan() {
+		t.Errorf("the whiteboard answered an impostor: %s", lines.Text())
+	}
+}
+
+func TestListenElsewhereNeedsToken(t *testing.T) {
+	b := newBoard(t, "alice", "")
+	if _, err := b.session.Listen(":0"); err == nil {
+		t.Error("listening on all interfaces without a token succeeded")
+	}
+	if _, err := b.session.Listen("127.0.0.1:0"); err != nil {
+		t.Errorf("listening on loopback without a token failed: %v", err)
+	}
+}
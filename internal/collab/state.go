@@ -0,0 +1,161 @@
+package collab
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// Stamp identifies an operation. Clock is a Lamport clock and Site a random
+// ID of the session that made the operation, so stamps are unique and every
+// board orders them the same way.
+type Stamp struct {
+	Clock uint64 `json:"clock"`
+	Site  string `json:"site"`
+}
+
+// Compare orders stamps by clock, then by site
+func (s Stamp) Compare(other Stamp) int {
+	if c := cmp.Compare(s.Clock, other.Clock); c != 0 {
+		return c
+	}
+	return cmp.Compare(s.Site, other.Site)
+}
+
+// newSite returns a random site ID
+func newSite() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Add is a stroke put on the board
+type Add struct {
+	Stamp  Stamp           `json:"stamp"`
+	Stroke *drawing.Stroke `json:"stroke"`
+}
+
+// Delta is a set of changes to the board. Applying deltas in any order,
+// any number of times, gives the same board.
+type Delta struct {
+	Add     []Add   `json:"add,omitempty"`
+	Remove  []Stamp `json:"remove,omitempty"` // Strokes taken off, e.g. by undo
+	Cleared Stamp   `json:"cleared,omitzero"` // Strokes up to this stamp were cleared
+}
+
+// Empty reports whether the delta changes nothing
+func (d Delta) Empty() bool {
+	return len(d.Add) == 0 && len(d.Remove) == 0 && d.Cleared == Stamp{}
+}
+
+// state is a replicated set of strokes. A stroke is on the board if it was
+// added, was not removed, and is newer than the last clear. Strokes are
+// stacked in stamp order.
+type state struct {
+	site    string
+	clock   uint64
+	strokes map[Stamp]*drawing.Stroke
+	removed map[Stamp]bool
+	cleared Stamp
+}
+
+// newState creates an empty board for a site
+func newState(site string) *state {
+	return &state{
+		site:    site,
+		strokes: make(map[Stamp]*drawing.Stroke),
+		removed: make(map[Stamp]bool),
+	}
+}
+
+// stamp returns a stamp newer than any seen so far
+func (st *state) stamp() Stamp {
+	st.clock++
+	return Stamp{Clock: st.clock, Site: st.site}
+}
+
+// witness advances the clock past a stamp made elsewhere
+func (st *state) witness(s Stamp) {
+	st.clock = max(st.clock, s.Clock)
+}
+
+// live reports whether a stamp is newer than the last clear
+func (st *state) live(s Stamp) bool {
+	return s.Compare(st.cleared) > 0
+}
+
+// merge applies a delta and returns the part of it that was new
+func (st *state) merge(d Delta) Delta {
+	var fresh Delta
+
+	st.witness(d.Cleared)
+	if st.live(d.Cleared) {
+		st.cleared = d.Cleared
+		fresh.Cleared = d.Cleared
+
+		// Nothing older than the clear can come back, so it is forgotten
+		for s := range st.strokes {
+			if !st.live(s) {
+				delete(st.strokes, s)
+			}
+		}
+		for s := range st.removed {
+			if !st.live(s) {
+				delete(st.removed, s)
+			}
+		}
+	}
+
+	for _, s := range d.Remove {
+		st.witness(s)
+		if !st.live(s) || st.removed[s] {
+			continue
+		}
+		st.removed[s] = true
+		delete(st.strokes, s)
+		fresh.Remove = append(fresh.Remove, s)
+	}
+
+	for _, add := range d.Add {
+		st.witness(add.Stamp)
+		if add.Stroke == nil || !st.live(add.Stamp) || st.removed[add.Stamp] {
+			continue
+		}
+		if _, ok := st.strokes[add.Stamp]; ok {
+			continue
+		}
+		st.strokes[add.Stamp] = add.Stroke
+		fresh.Add = append(fresh.Add, add)
+	}
+	return fresh
+}
+
+// full returns a delta that recreates the whole board
+func (st *state) full() Delta {
+	d := Delta{Cleared: st.cleared}
+	for s, stroke := range st.strokes {
+		d.Add = append(d.Add, Add{Stamp: s, Stroke: stroke})
+	}
+	for s := range st.removed {
+		d.Remove = append(d.Remove, s)
+	}
+	return d
+}
+
+// visible returns the strokes on the board from bottom to top
+func (st *state) visible() []*drawing.Stroke {
+	stamps := make([]Stamp, 0, len(st.strokes))
+	for s := range st.strokes {
+		stamps = append(stamps, s)
+	}
+	slices.SortFunc(stamps, Stamp.Compare)
+
+	strokes := make([]*drawing.Stroke, len(stamps))
+	for i, s := range stamps {
+		strokes[i] = st.strokes[s]
+	}
+	return strokes
+}
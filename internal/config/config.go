@@ -0,0 +1,128 @@
+// Package config loads the settings shared by all scrawl commands.
+//
+// Settings come from a JSON file in the user's configuration directory and
+// can be overridden by command-line flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// AppName is the name of the configuration directory
+const AppName = "scrawl"
+
+// Config holds the settings shared by all commands
+type Config struct {
+	LogLevel     string `json:"logLevel,omitempty"`     // Level spec, e.g. "info,tablet=debug"
+	LogFile      string `json:"logFile,omitempty"`      // Optional JSON log file
+	Device       string `json:"device,omitempty"`       // HID device path to use instead of enumerating
+	Evdev        string `json:"evdev,omitempty"`        // Linux input device name or path to read instead of HID
+	Profile      string `json:"profile,omitempty"`      // Tablet profile name or file
+	MaxFrameRate int    `json:"maxFrameRate,omitempty"` // Display refresh cap
+	Fullscreen   bool   `json:"fullscreen,omitempty"`   // Start in full-screen mode
+	// PressureCurve is the exponent applied to pressure: above 1 needs a
+	// firmer touch, below 1 a lighter one; 0 means linear
+	PressureCurve float64 `json:"pressureCurve,omitempty"`
+	// Smoothing is the weight of the previous pen position from 0 (off)
+	// to 0.95 (heavy)
+	Smoothing float64 `json:"smoothing,omitempty"`
+	// TipDebounce is the number of consecutive reports a change of the tip
+	// switch may last and still be ignored as noise; 0 disables it
+	TipDebounce int `json:"tipDebounce,omitempty"`
+	// SpeedThinning is the pen speed in canvas units per second at which
+	// lines become noticeably thinner, like a real marker; 0 disables it
+	SpeedThinning float64 `json:"speedThinning,omitempty"`
+	// Bindings maps express keys ("key1", ...) and pen buttons ("button1",
+	// "button2") to actions such as "undo" or "zoom-in"
+	Bindings map[string]string `json:"bindings,omitempty"`
+	// Mirror is the address on which the board is shared read-only with
+	// web browsers, e.g. ":8080"; empty disables it
+	Mirror string `json:"mirror,omitempty"`
+	// RemotePen is the UDP address on which the whiteboard receives the pen
+	// from "scrawl send" on another machine, e.g. ":7071"; empty disables it
+	RemotePen string `json:"remotePen,omitempty"`
+	// RemotePenToken is the secret that "scrawl send" and the whiteboard
+	// receiving its pen must share; receiving on other than loopback
+	// requires one
+	RemotePenToken string `json:"remotePenToken,omitempty"`
+	// ControlSocket is the Unix socket on which other programs control the
+	// whiteboard, see "scrawl ctl"; empty uses the default path and "off"
+	// disables it
+	ControlSocket string `json:"controlSocket,omitempty"`
+	// ControlHTTP is a loopback address on which the control API is also
+	// served over HTTP, e.g. "127.0.0.1:7072"; empty disables it
+	ControlHTTP string `json:"controlHTTP,omitempty"`
+	// User is the name shown to collaborators and that owns the strokes
+	// drawn here; the login name if empty
+	User string `json:"user,omitempty"`
+	// Color is the colour of the user's strokes as "#rrggbb"; black if empty
+	Color string `json:"color,omitempty"`
+	// CollabListen is the address on which other whiteboards can join the
+	// board, e.g. ":7070"; empty disables it
+	CollabListen string `json:"collabListen,omitempty"`
+	// CollabJoin is the address of a whiteboard to draw on together, e.g.
+	// "host:7070"; empty disables it
+	CollabJoin string `json:"collabJoin,omitempty"`
+	// CollabToken is the secret that whiteboards drawing together must
+	// share; listening on other than loopback requires one
+	CollabToken string `json:"collabToken,omitempty"`
+}
+
+// Default returns the settings used when nothing is configured
+func Default() *Config {
+	return &Config{}
+}
+
+// Dir returns the directory holding the configuration file and profiles
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate configuration directory: %w", err)
+	}
+	return filepath.Join(base, AppName), nil
+}
+
+// DefaultPath returns the path of the configuration file
+func DefaultPath() string {
+	dir, err := Dir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// ProfileDir returns the directory holding user-defined tablet profiles
+func ProfileDir() string {
+	dir, err := Dir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "profiles")
+}
+
+// Load reads the configuration file at path. A missing file is not an error
+// and yields the default settings.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	return cfg, nil
+}
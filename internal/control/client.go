@@ -0,0 +1,83 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// Client calls the API of a whiteboard over its socket
+type Client struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+	nextID  int
+}
+
+// Dial connects to the control socket of a running whiteboard
+func Dial(path string) (*Client, error) {
+	// A socket in a directory someone else made may not be the whiteboard
+	if err := checkSocketDir(path); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("no whiteboard is listening on %s: %w", path, err)
+	}
+	return &Client{conn: conn, encoder: json.NewEncoder(conn), decoder: json.NewDecoder(conn)}, nil
+}
+
+// Call runs a method and returns its result. Params may be nil.
+// Notifications that arrive while waiting are discarded, so subscribers
+// should read them with Next.
+func (c *Client) Call(method string, params any) (json.RawMessage, error) {
+	c.nextID++
+	id := c.nextID
+	req := struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      int    `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{version, id, method, params}
+	if err := c.encoder.Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	for {
+		var resp struct {
+			ID     *int            `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+		}
+		if err := c.decoder.Decode(&resp); err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.Error != nil && (resp.ID == nil || *resp.ID == id) {
+			return nil, fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if resp.ID != nil && *resp.ID == id {
+			return resp.Result, nil
+		}
+	}
+}
+
+// Next waits for the next event after subscribing
+func (c *Client) Next() (EventInfo, error) {
+	for {
+		var msg struct {
+			Method string    `json:"method"`
+			Params EventInfo `json:"params"`
+		}
+		if err := c.decoder.Decode(&msg); err != nil {
+			return EventInfo{}, fmt.Errorf("failed to read event: %w", err)
+		}
+		if msg.Method == "event" {
+			return msg.Params, nil
+		}
+	}
+}
+
+// Close disconnects from the whiteboard
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package control
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether the user running the program owns a file
+func ownedByUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
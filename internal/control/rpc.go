@@ -0,0 +1,293 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+const version = "2.0"
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeFailed         = -32000 // The command itself failed
+)
+
+// Methods
+const (
+	methodClear       = "clear"
+	methodUndo        = "undo"
+	methodRedo        = "redo"
+	methodSave        = "save"
+	methodExport      = "export"
+	methodOpen        = "open"
+	methodSetMode     = "set-mode"
+	methodListStrokes = "list-strokes"
+	methodSubscribe   = "subscribe"
+)
+
+// Methods lists every method of the API
+var Methods = []string{
+	methodClear, methodUndo, methodRedo, methodSave, methodExport,
+	methodOpen, methodSetMode, methodListStrokes, methodSubscribe,
+}
+
+// request is a call from a client. Without an ID it is a notification and
+// gets no response.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response answers a request
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// notification is a message from the server that needs no answer
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// rpcError is the error of a failed call
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// fail answers the request with an error
+func (req request) fail(err *rpcError) *response {
+	if req.ID == nil {
+		return nil
+	}
+	return &response{JSONRPC: version, ID: req.ID, Error: err}
+}
+
+// parseError answers a message that is not valid JSON
+func parseError(err error) *response {
+	return &response{JSONRPC: version, Error: &rpcError{Code: codeParseError, Message: err.Error()}}
+}
+
+// encode marshals a message as one line
+func encode(msg any) []byte {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(&response{JSONRPC: version, Error: &rpcError{Code: codeFailed, Message: err.Error()}})
+	}
+	return append(data, '\n')
+}
+
+// Parameters of the methods
+type (
+	pathParams struct {
+		Path string `json:"path"`
+	}
+	exportParams struct {
+		Path   string `json:"path"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	}
+	modeParams struct {
+		Mode string `json:"mode"`
+	}
+	listParams struct {
+		Points bool `json:"points"` // Include every point of every stroke
+	}
+	subscribeParams struct {
+		Points bool `json:"points"` // Also send an event for every point drawn
+	}
+)
+
+// handle runs a request. Subscribing needs the connection it came from,
+// which is nil over HTTP.
+func (s *Server) handle(req request, c *conn) *response {
+	if req.JSONRPC != version || req.Method == "" {
+		return req.fail(&rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"})
+	}
+
+	result, err := s.call(req, c)
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: codeFailed, Message: err.Error()}
+		}
+		logger.Debug("control call failed", "method", req.Method, "err", err)
+		return req.fail(rpcErr)
+	}
+	if req.ID == nil {
+		return nil
+	}
+	return &response{JSONRPC: version, ID: req.ID, Result: result}
+}
+
+// call dispatches a request to its method
+func (s *Server) call(req request, c *conn) (any, error) {
+	switch req.Method {
+	case methodClear, methodUndo, methodRedo:
+		return true, s.commands.Perform(req.Method)
+
+	case methodSave:
+		var p pathParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return true, s.commands.Save(p.Path)
+
+	case methodOpen:
+		var p pathParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Path == "" {
+			return nil, invalidParams("path is required")
+		}
+		return true, s.commands.Open(p.Path)
+
+	case methodExport:
+		var p exportParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Path == "" {
+			return nil, invalidParams("path is required")
+		}
+		if p.Width < 0 || p.Height < 0 {
+			return nil, invalidParams("size must not be negative")
+		}
+		return true, s.commands.Export(p.Path, p.Width, p.Height)
+
+	case methodSetMode:
+		var p modeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return true, s.commands.SetMode(p.Mode)
+
+	case methodListStrokes:
+		var p listParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.listStrokes(p.Points), nil
+
+	case methodSubscribe:
+		var p subscribeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if c == nil {
+			return nil, &rpcError{Code: codeInvalidRequest, Message: "subscribe needs the control socket"}
+		}
+		s.subscribe(c, p.Points)
+		return true, nil
+
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+	}
+}
+
+// decodeParams decodes the parameters of a call, which may be omitted
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return invalidParams(err.Error())
+	}
+	return nil
+}
+
+// invalidParams reports bad parameters
+func invalidParams(msg string) error {
+	return &rpcError{Code: codeInvalidParams, Message: msg}
+}
+
+// StrokeInfo describes a stroke on the board
+type StrokeInfo struct {
+	Index  int             `json:"index"` // Position from the bottom
+	Owner  string          `json:"owner,omitempty"`
+	Color  string          `json:"color"`
+	Brush  drawing.Brush   `json:"brush"`
+	Points int             `json:"points"`
+	Bounds [4]float64      `json:"bounds"` // Min X, min Y, max X, max Y in canvas units
+	Start  time.Time       `json:"start,omitzero"`
+	End    time.Time       `json:"end,omitzero"`
+	Stroke *drawing.Stroke `json:"stroke,omitempty"` // Every point, if asked for
+}
+
+// EventInfo is the parameter of an event notification
+type EventInfo struct {
+	Kind   drawing.EventKind `json:"kind"`
+	Stroke *StrokeInfo       `json:"stroke,omitempty"`
+	Point  *[3]float64       `json:"point,omitempty"` // X, Y and pressure of a point event
+}
+
+// newStrokeInfo describes the stroke at the given position
+func newStrokeInfo(stroke *drawing.Stroke, index int, points bool) *StrokeInfo {
+	bounds := stroke.Bounds()
+	info := &StrokeInfo{
+		Index:  index,
+		Owner:  stroke.Owner,
+		Color:  hexColor(stroke.Color),
+		Brush:  stroke.Brush,
+		Points: len(stroke.Points),
+		Bounds: [4]float64{bounds.MinX, bounds.MinY, bounds.MaxX, bounds.MaxY},
+		Start:  stroke.Start,
+		End:    stroke.End,
+	}
+	if points {
+		info.Stroke = stroke
+	}
+	return info
+}
+
+// newEventInfo describes a change. The canvas lock must be held.
+func newEventInfo(c *drawing.Canvas, event drawing.Event) EventInfo {
+	info := EventInfo{Kind: event.Kind}
+	switch event.Kind {
+	case drawing.EventBegin:
+		info.Stroke = newStrokeInfo(event.Stroke, len(c.Strokes), false)
+	case drawing.EventPoint:
+		info.Point = &[3]float64{event.Point.X, event.Point.Y, event.Point.Pressure}
+	case drawing.EventEnd, drawing.EventRedo, drawing.EventAdd:
+		info.Stroke = newStrokeInfo(event.Stroke, len(c.Strokes)-1, false)
+	case drawing.EventUndo:
+		info.Stroke = newStrokeInfo(event.Stroke, event.Index, false)
+	}
+	return info
+}
+
+// listStrokes describes the finished strokes from bottom to top
+func (s *Server) listStrokes(points bool) []*StrokeInfo {
+	s.canvas.Lock()
+	defer s.canvas.Unlock()
+	strokes := make([]*StrokeInfo, len(s.canvas.Strokes))
+	for i, stroke := range s.canvas.Strokes {
+		strokes[i] = newStrokeInfo(stroke, i, points)
+	}
+	return strokes
+}
+
+// hexColor formats a colour as #rrggbbaa
+func hexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
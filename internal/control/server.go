@@ -0,0 +1,441 @@
+// Package control lets other programs script a running whiteboard.
+//
+// The API is JSON-RPC 2.0 with one message per line on a Unix domain
+// socket. The same methods, except subscribe, can be posted to /rpc over
+// HTTP on a loopback address with the bearer token from the token file:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "open", "params": {"path": "template.scrawl"}}
+//
+// Methods are clear, undo, redo, save, export, open, set-mode,
+// list-strokes and subscribe. After subscribe, the connection receives an
+// "event" notification for every change to the board.
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"xp-pen-controller/internal/config"
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/logging"
+)
+
+var logger = logging.For(logging.Net)
+
+// subscriberBuffer is the number of notifications queued for a subscriber.
+// One that falls further behind is disconnected.
+const subscriberBuffer = 1024
+
+// flushTimeout bounds how long the replies still queued for a client that
+// hung up or sent garbage are written for
+const flushTimeout = 5 * time.Second
+
+// Commands are the whiteboard operations behind the API. The whiteboard
+// implements them with the same code as its toolbar and key bindings.
+type Commands interface {
+	// Perform runs a toolbar action such as "clear", "undo" or "redo"
+	Perform(action string) error
+	// Save writes the drawing to path, or to its file if path is empty
+	Save(path string) error
+	// Open replaces the drawing with a file
+	Open(path string) error
+	// Export renders the drawing to an image or animation; a zero size
+	// keeps the canvas size
+	Export(path string, width, height int) error
+	// SetMode selects what the pen does, "pen" or "eraser"
+	SetMode(mode string) error
+}
+
+// Server serves the API for a canvas
+type Server struct {
+	canvas   *drawing.Canvas
+	commands Commands
+
+	unobserve func() // Stops observing the canvas; guarded by the canvas lock
+
+	mu          sync.Mutex
+	subscribers map[*conn]bool // Subscribed connections and whether they want every point
+	listeners   []net.Listener
+	socket      string // Path of the Unix socket, removed on Close
+	token       string // Bearer token of HTTP requests
+	tokenFile   string // Path of the file holding the token, removed on Close
+}
+
+// NewServer creates the API for a canvas and the commands that act on it
+func NewServer(c *drawing.Canvas, commands Commands) *Server {
+	s := &Server{
+		canvas:      c,
+		commands:    commands,
+		subscribers: make(map[*conn]bool),
+	}
+	c.Lock()
+	s.unobserve = c.Observe(s.observe)
+	c.Unlock()
+	return s
+}
+
+// DefaultSocket returns the path of the socket that scrawl ctl connects to
+// when none is given. Without a runtime directory it lies in a directory
+// of the user's in the temporary directory.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("%s-%d.sock", config.AppName, os.Getuid()))
+	}
+	return filepath.Join(privateDir(), "control.sock")
+}
+
+// privateDir is the directory of the default socket when there is no
+// runtime directory
+func privateDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", config.AppName, os.Getuid()))
+}
+
+// checkSocketDir makes sure that nobody else controls the directory of the
+// default socket, creating it if needed. Other directories are the user's
+// choice and left alone.
+func checkSocketDir(path string) error {
+	dir := filepath.Dir(path)
+	if dir != privateDir() {
+		return nil
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() || info.Mode().Perm()&0o077 != 0 || !ownedByUser(info) {
+		return fmt.Errorf("socket directory %s must be a directory only you can access", dir)
+	}
+	return nil
+}
+
+// ListenUnix serves the API on a Unix domain socket only the user can use.
+// A socket left behind by a whiteboard that crashed is replaced.
+func (s *Server) ListenUnix(path string) error {
+	if err := checkSocketDir(path); err != nil {
+		return err
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another whiteboard", path)
+	}
+	os.Remove(path)
+
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.socket = path
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Error("control socket stopped", "err", err)
+				}
+				return
+			}
+			go s.serveConn(c)
+		}
+	}()
+	logger.Info("control socket ready", "path", path)
+	return nil
+}
+
+// listenPrivate creates a socket that only the user can connect to. It is
+// created in a new directory only the user can enter and moved into place
+// once restricted, so there is no moment at which others could connect.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+	defer os.Remove(dir)
+
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+	// Close removes the socket at its final path instead
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		listener.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to create control socket: %w", err)
+	}
+	return listener, nil
+}
+
+// TokenFile returns the path of the HTTP token file that belongs to a
+// control socket
+func TokenFile(socket string) string {
+	return strings.TrimSuffix(socket, filepath.Ext(socket)) + ".token"
+}
+
+// ListenHTTP serves the API at /rpc on a loopback address, e.g.
+// "127.0.0.1:7072", and returns the address. Any local user can connect to
+// it, so requests must carry a new random token that is written to
+// tokenPath, a file only the user can read.
+func (s *Server) ListenHTTP(addr, tokenPath string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start control API: %w", err)
+	}
+	if tcp, ok := listener.Addr().(*net.TCPAddr); !ok || !tcp.IP.IsLoopback() {
+		listener.Close()
+		return nil, fmt.Errorf("control API must listen on a loopback address, not %s", addr)
+	}
+	token, err := writeToken(tokenPath)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.token = token
+	s.tokenFile = tokenPath
+	s.mu.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rpc", s.serveHTTP)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Error("control API stopped", "err", err)
+		}
+	}()
+	logger.Info("control API ready", "url", "http://"+listener.Addr().String()+"/rpc", "token", tokenPath)
+	return listener.Addr(), nil
+}
+
+// writeToken creates a random token and writes it to a new file only the
+// user can read, replacing the one of an earlier whiteboard
+func writeToken(path string) (string, error) {
+	if err := checkSocketDir(path); err != nil {
+		return "", err
+	}
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	token := hex.EncodeToString(secret)
+
+	// A new file, so an existing one cannot lend it wider permissions
+	os.Remove(path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create control API token: %w", err)
+	}
+	if _, err := f.WriteString(token + "\n"); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	return token, nil
+}
+
+// authorized reports whether a request carries the bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	want := s.token
+	s.mu.Unlock()
+	return ok && want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// serveHTTP answers one request posted over HTTP
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Web pages can post to localhost too. Requiring a JSON content type
+	// makes browsers ask first, which is never allowed, and checking the
+	// host defeats DNS rebinding.
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err != nil || !isLoopbackHost(host) {
+		http.Error(w, "forbidden host", http.StatusForbidden)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+		return
+	}
+
+	var req request
+	var resp *response
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		resp = parseError(err)
+	} else if req.Method == methodSubscribe {
+		resp = req.fail(&rpcError{Code: codeInvalidRequest, Message: "subscribe needs the control socket"})
+	} else {
+		resp = s.handle(req, nil)
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent) // A notification
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// isLoopbackHost reports whether a Host header names this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// conn is a client connected to the socket
+type conn struct {
+	net.Conn
+	out  chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+// close disconnects the client
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.Close()
+	})
+}
+
+// send queues a message, waiting if the queue is full
+func (c *conn) send(msg []byte) {
+	select {
+	case c.out <- msg:
+	case <-c.done:
+	}
+}
+
+// serveConn answers requests from a socket client until it disconnects
+func (s *Server) serveConn(nc net.Conn) {
+	c := &conn{Conn: nc, out: make(chan []byte, subscriberBuffer), done: make(chan struct{})}
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, c)
+		s.mu.Unlock()
+		// Nothing sends to the client any more, so the writer can send
+		// what is queued, such as a parse error, and hang up
+		c.SetWriteDeadline(time.Now().Add(flushTimeout))
+		close(c.out)
+	}()
+
+	go func() {
+		defer c.close()
+		for msg := range c.out {
+			if _, err := c.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	decoder := json.NewDecoder(c)
+	for {
+		var req request
+		if err := decoder.Decode(&req); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				c.send(encode(parseError(err)))
+			}
+			return
+		}
+		if resp := s.handle(req, c); resp != nil {
+			c.send(encode(resp))
+		}
+	}
+}
+
+// subscribe sends the events of the board to a client
+func (s *Server) subscribe(c *conn, points bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[c] = points
+}
+
+// observe notifies subscribers of a change. It runs with the canvas lock
+// held, so a subscriber that cannot keep up is dropped rather than waited
+// for.
+func (s *Server) observe(event drawing.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msg []byte
+	for c, points := range s.subscribers {
+		if event.Kind == drawing.EventPoint && !points {
+			continue
+		}
+		if msg == nil {
+			msg = encode(&notification{
+				JSONRPC: version,
+				Method:  "event",
+				Params:  newEventInfo(s.canvas, event),
+			})
+		}
+		select {
+		case c.out <- msg:
+		default:
+			logger.Warn("control subscriber fell behind, dropping it")
+			delete(s.subscribers, c)
+			c.close()
+		}
+	}
+}
+
+// Close stops serving the API and removes the socket
+func (s *Server) Close() error {
+	s.canvas.Lock()
+	s.unobserve()
+	s.canvas.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.listeners = nil
+	for c := range s.subscribers {
+		c.close()
+	}
+	if s.socket != "" {
+		os.Remove(s.socket)
+		s.socket = ""
+	}
+	if s.tokenFile != "" {
+		os.Remove(s.tokenFile)
+		s.tokenFile = ""
+	}
+	return nil
+}
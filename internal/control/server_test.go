@@ -0,0 +1,377 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// fakeCommands records the commands it is asked to run
+type fakeCommands struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeCommands) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+// Calls returns the commands run so far
+func (f *fakeCommands) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *fakeCommands) Perform(action string) error {
+	f.record(action)
+	return nil
+}
+
+func (f *fakeCommands) Save(path string) error {
+	f.record("save " + path)
+	if path == "" {
+		return errors.New("the drawing has no file yet")
+	}
+	return nil
+}
+
+func (f *fakeCommands) Open(path string) error {
+	f.record("open " + path)
+	return nil
+}
+
+func (f *fakeCommands) Export(path string, width, height int) error {
+	f.record(fmt.Sprintf("export %s %dx%d", path, width, height))
+	return nil
+}
+
+func (f *fakeCommands) SetMode(mode string) error {
+	f.record("mode " + mode)
+	return nil
+}
+
+// startServer serves a canvas on a socket in a temporary directory
+func startServer(t *testing.T) (*Server, *drawing.Canvas, *fakeCommands, string) {
+	t.Helper()
+	c := drawing.NewCanvas(800, 600)
+	commands := &fakeCommands{}
+	server := NewServer(c, commands)
+	t.Cleanup(func() { server.Close() })
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	if err := server.ListenUnix(path); err != nil {
+		t.Fatal(err)
+	}
+	return server, c, commands, path
+}
+
+// rawConn sends lines to the socket and reads the replies
+type rawConn struct {
+	t *testing.T
+	net.Conn
+	lines *bufio.Scanner
+}
+
+func dialRaw(t *testing.T, path string) *rawConn {
+	t.Helper()
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &rawConn{t: t, Conn: c, lines: bufio.NewScanner(c)}
+}
+
+func (rc *rawConn) send(line string) {
+	rc.t.Helper()
+	if _, err := fmt.Fprintln(rc.Conn, line); err != nil {
+		rc.t.Fatal(err)
+	}
+}
+
+// reply reads the next message as a response
+func (rc *rawConn) reply() response {
+	rc.t.Helper()
+	if !rc.lines.Scan() {
+		rc.t.Fatalf("connection closed: %v", rc.lines.Err())
+	}
+	var resp response
+	if err := json.Unmarshal(rc.lines.Bytes(), &resp); err != nil {
+		rc.t.Fatalf("invalid reply %q: %v", rc.lines.Text(), err)
+	}
+	return resp
+}
+
+func TestRequestAndResponse(t *testing.T) {
+	_, c, commands, path := startServer(t)
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Call(methodOpen, map[string]string{"path": "a.scrawl"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Call(methodExport, map[string]any{"path": "a.png", "width": 640}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Call(methodSetMode, map[string]string{"mode": "eraser"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"open a.scrawl", "export a.png 640x0", "mode eraser"}
+	if got := commands.Calls(); !slices.Equal(got, want) {
+		t.Errorf("commands %v, want %v", got, want)
+	}
+
+	// A failing command and bad parameters are reported as errors
+	if _, err := client.Call(methodSave, nil); err == nil || !strings.Contains(err.Error(), "no file yet") {
+		t.Errorf("save without a path: %v", err)
+	}
+	if _, err := client.Call(methodOpen, nil); err == nil {
+		t.Error("open without a path succeeded")
+	}
+
+	c.Lock()
+	c.StartStroke(drawing.Point{X: 1, Y: 2, Pressure: 0.5})
+	c.FinishStroke()
+	c.Unlock()
+	result, err := client.Call(methodListStrokes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strokes []StrokeInfo
+	if err := json.Unmarshal(result, &strokes); err != nil || len(strokes) != 1 || strokes[0].Points != 1 {
+		t.Errorf("list-strokes returned %s (%v)", result, err)
+	}
+}
+
+func TestNotificationGetsNoReply(t *testing.T) {
+	_, _, commands, path := startServer(t)
+	conn := dialRaw(t, path)
+
+	conn.send(`{"jsonrpc":"2.0","method":"undo"}`)
+	conn.send(`{"jsonrpc":"2.0","method":"no-such-method"}`)
+	conn.send(`{"jsonrpc":"2.0","id":7,"method":"redo"}`)
+
+	// The first reply answers the request, not the notifications
+	resp := conn.reply()
+	if string(resp.ID) != "7" || resp.Error != nil {
+		t.Errorf("first reply %+v, want the result of request 7", resp)
+	}
+	if got := commands.Calls(); !slices.Equal(got, []string{"undo", "redo"}) {
+		t.Errorf("commands %v, want undo and redo", got)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, _, _, path := startServer(t)
+	conn := dialRaw(t, path)
+
+	conn.send(`{"jsonrpc": "2.0", "id": 1, "method": `)
+	conn.send(`}`)
+	resp := conn.reply()
+	if resp.Error == nil || resp.Error.Code != codeParseError || string(resp.ID) != "null" {
+		t.Errorf("reply %+v, want a parse error without ID", resp)
+	}
+}
+
+func TestUnknownMethodAndInvalidRequest(t *testing.T) {
+	_, _, _, path := startServer(t)
+	conn := dialRaw(t, path)
+
+	conn.send(`{"jsonrpc":"2.0","id":1,"method":"fly"}`)
+	if resp := conn.reply(); resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("reply %+v, want method not found", resp)
+	}
+	conn.send(`{"jsonrpc":"1.0","id":2,"method":"clear"}`)
+	if resp := conn.reply(); resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Errorf("reply %+v, want an invalid request", resp)
+	}
+	conn.send(`{"jsonrpc":"2.0","id":3,"method":"set-mode","params":{"mode":5}}`)
+	if resp := conn.reply(); resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("reply %+v, want invalid params", resp)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	_, c, _, path := startServer(t)
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Call(methodSubscribe, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Lock()
+	c.StartStroke(drawing.Point{X: 1, Y: 2, Pressure: 0.5})
+	c.AddPointToCurrentStroke(drawing.Point{X: 3, Y: 4, Pressure: 0.5})
+	c.FinishStroke()
+	c.Undo()
+	c.Clear()
+	c.Unlock()
+
+	// Points are only sent to subscribers that ask for them
+	var kinds []drawing.EventKind
+	for range 4 {
+		event, err := client.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, event.Kind)
+		if event.Kind == drawing.EventEnd && (event.Stroke == nil || event.Stroke.Points != 2) {
+			t.Errorf("end event %+v does not describe the stroke", event.Stroke)
+		}
+	}
+	want := []drawing.EventKind{drawing.EventBegin, drawing.EventEnd, drawing.EventUndo, drawing.EventClear}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("events %v, want %v", kinds, want)
+	}
+}
+
+func TestSocketIsPrivate(t *testing.T) {
+	_, _, _, path := startServer(t)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode %v, want a socket with mode 0600", info.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the socket", len(entries))
+	}
+}
+
+func TestDefaultSocketDirMustBePrivate(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("TMPDIR", t.TempDir())
+	path := DefaultSocket()
+	if filepath.Dir(path) != privateDir() {
+		t.Fatalf("default socket %s is not in %s", path, privateDir())
+	}
+
+	server := NewServer(drawing.NewCanvas(800, 600), &fakeCommands{})
+	defer server.Close()
+	if err := server.ListenUnix(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(privateDir()); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("socket directory %v (%v), want mode 0700", info.Mode(), err)
+	}
+	server.Close()
+
+	// A directory others can enter is refused, by the server and the client
+	os.Chmod(privateDir(), 0o755)
+	if err := NewServer(drawing.NewCanvas(800, 600), &fakeCommands{}).ListenUnix(path); err == nil {
+		t.Error("listening in a shared directory succeeded")
+	}
+	if _, err := Dial(path); err == nil || !strings.Contains(err.Error(), "only you") {
+		t.Errorf("dialling into a shared directory: %v", err)
+	}
+}
+
+// postRPC posts a request to the HTTP API with a bearer token, if any
+func postRPC(t *testing.T, url, host, token, contentType, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if host != "" {
+		req.Host = host
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHTTP(t *testing.T) {
+	server, _, commands, path := startServer(t)
+	tokenFile := TokenFile(path)
+	addr, err := server.ListenHTTP("127.0.0.1:0", tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + addr.String() + "/rpc"
+	call := `{"jsonrpc":"2.0","id":1,"method":"clear"}`
+
+	// Only the user can read the token
+	info, err := os.Stat(tokenFile)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("token file: %v, %v", info, err)
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimSpace(string(data))
+
+	// Other local users cannot call anything without it
+	for _, wrong := range []string{"", "0123"} {
+		resp := postRPC(t, url, "", wrong, "application/json", call)
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("token %q: status %d, want 401", wrong, resp.StatusCode)
+		}
+	}
+
+	resp := postRPC(t, url, "", token, "application/json", call)
+	var result response
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil || result.Result != true {
+		t.Errorf("call: status %d, result %+v", resp.StatusCode, result)
+	}
+
+	if resp := postRPC(t, url, "", token, "application/json", `{"jsonrpc":"2.0","method":"undo"}`); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("notification: status %d, want 204", resp.StatusCode)
+	}
+
+	// A form post from a web page is refused before it runs
+	if resp := postRPC(t, url, "", token, "text/plain", call); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain: status %d, want 415", resp.StatusCode)
+	}
+	// So is a request for another host name, as after DNS rebinding
+	if resp := postRPC(t, url, "evil.example:7072", token, "application/json", call); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("foreign host: status %d, want 403", resp.StatusCode)
+	}
+	if got := commands.Calls(); !slices.Equal(got, []string{"clear", "undo"}) {
+		t.Errorf("commands %v, want only clear and undo", got)
+	}
+
+	resp = postRPC(t, url, "", token, "application/json", `{"jsonrpc":"2.0","id":2,"method":"subscribe"}`)
+	result = response{}
+	if json.NewDecoder(resp.Body).Decode(&result) != nil || result.Error == nil {
+		t.Errorf("subscribe over HTTP: %+v, want an error", result)
+	}
+
+	if _, err := server.ListenHTTP(":0", tokenFile); err == nil {
+		t.Error("the HTTP API listened on all interfaces")
+	}
+
+	server.Close()
+	if _, err := os.Stat(tokenFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("token file left behind: %v", err)
+	}
+}
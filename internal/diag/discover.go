@@ -0,0 +1,419 @@
+package diag
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// Step identifies what the user was doing while reports were recorded
+type Step int
+
+// Steps of the discovery wizard, in the order they are performed
+const (
+	StepLeave    Step = iota // Pen hovering, then lifted out of range
+	StepHover                // Pen hovering without touching
+	StepTouch                // Pen touching lightly
+	StepPressure             // Pen pressing harder and softer
+	StepMoveX                // Pen moving left to right
+	StepMoveY                // Pen moving top to bottom
+	StepButton1              // Hovering with the first barrel button held
+	StepButton2              // Hovering with the second barrel button held
+)
+
+// WizardStep describes one step of the discovery wizard
+type WizardStep struct {
+	Step    Step
+	Prompt  string
+	Seconds int // How long to record
+}
+
+// WizardSteps lists the steps in the order they are performed
+var WizardSteps = []WizardStep{
+	{StepLeave, "Hover the pen over the tablet, then lift it well away and keep it away.", 4},
+	{StepHover, "Hover the pen just above the tablet without touching it, moving it slightly.", 4},
+	{StepTouch, "Touch the tablet lightly with the pen tip and keep it still.", 4},
+	{StepPressure, "Keep touching and press harder, then softer, a few times.", 6},
+	{StepMoveX, "Hover or draw slowly from the LEFT edge to the RIGHT edge in a straight line.", 5},
+	{StepMoveY, "Hover or draw slowly from the TOP edge to the BOTTOM edge in a straight line.", 5},
+	{StepButton1, "Hover the pen and hold down the FIRST (lower) barrel button.", 4},
+	{StepButton2, "Hover the pen and hold down the SECOND (upper) barrel button.", 4},
+}
+
+// Recording holds the reports captured during each step
+type Recording map[Step][][]byte
+
+// Finding explains how a field or flag of the proposed layout was chosen
+type Finding struct {
+	Name   string
+	Detail string
+	Found  bool
+}
+
+// ProposeProfile analyses a recording and proposes a device profile
+func ProposeProfile(name string, vendorID, productID uint16, rec Recording) (*tablet.Profile, []Finding, error) {
+	layout, findings, err := ProposeLayout(rec)
+	if err != nil {
+		return nil, findings, err
+	}
+
+	profile := &tablet.Profile{
+		Name:        name,
+		VendorID:    vendorID,
+		ProductID:   productID,
+		MaxX:        observedMax(rec[StepMoveX], layout.X),
+		MaxY:        observedMax(rec[StepMoveY], layout.Y),
+		MaxPressure: roundUpToMask(observedMax(rec[StepPressure], layout.Pressure)),
+		Layout:      layout,
+	}
+
+	// Edges are rarely reached exactly, so these are lower bounds
+	findings = append(findings, Finding{
+		Name:   "ranges",
+		Detail: fmt.Sprintf("max X >= %d, max Y >= %d, max pressure %d", profile.MaxX, profile.MaxY, profile.MaxPressure),
+		Found:  true,
+	})
+
+	if err := profile.Validate(); err != nil {
+		return nil, findings, err
+	}
+	return profile, findings, nil
+}
+
+// ProposeLayout correlates the changes in each step with what the user
+// was asked to do and proposes a report layout
+func ProposeLayout(rec Recording) (tablet.ReportLayout, []Finding, error) {
+	var layout tablet.ReportLayout
+	var findings []Finding
+
+	layout.Length = commonLength(rec)
+	if layout.Length < 3 {
+		return layout, nil, fmt.Errorf("not enough reports were recorded")
+	}
+
+	used := map[int]bool{} // Bytes already assigned to a field
+
+	// A first byte that never changes is the report ID
+	if id, ok := constantFirstByte(rec); ok && id != 0 {
+		layout.ReportID = id
+		used[0] = true
+		findings = append(findings, Finding{Name: "report ID", Detail: fmt.Sprintf("0x%02x", id), Found: true})
+	}
+
+	// Position fields increase steadily while moving along their axis
+	x, xScore, ok := bestField(rec[StepMoveX], layout.Length, used, monotonicScore)
+	if !ok {
+		return layout, findings, fmt.Errorf("could not find the X coordinate; move the pen steadily from left to right")
+	}
+	layout.X = x
+	markUsed(used, x)
+	findings = append(findings, fieldFinding("x", x, xScore))
+
+	y, yScore, ok := bestField(rec[StepMoveY], layout.Length, used, monotonicScore)
+	if !ok {
+		return layout, findings, fmt.Errorf("could not find the Y coordinate; move the pen steadily from top to bottom")
+	}
+	layout.Y = y
+	markUsed(used, y)
+	findings = append(findings, fieldFinding("y", y, yScore))
+
+	// Pressure varies smoothly over a wide range while pressing
+	pressure, pScore, ok := bestField(rec[StepPressure], layout.Length, used, pressureScore)
+	if !ok {
+		return layout, findings, fmt.Errorf("could not find the pressure; press harder and softer while touching")
+	}
+	layout.Pressure = pressure
+	markUsed(used, pressure)
+	findings = append(findings, fieldFinding("pressure", pressure, pScore))
+
+	// Flags live in the bytes not used by any field
+	layout.InRange = findProximityFlag(rec[StepHover], rec[StepLeave], used)
+	findings = append(findings, bitFinding("in range", layout.InRange))
+
+	layout.TipSwitch = findFlag(rec[StepTouch], rec[StepHover], used, 0.9, 0.1, []tablet.Bit{layout.InRange})
+	findings = append(findings, bitFinding("tip switch", layout.TipSwitch))
+
+	exclude := []tablet.Bit{layout.InRange, layout.TipSwitch}
+	layout.Button1 = findFlag(rec[StepButton1], rec[StepHover], used, 0.5, 0.1, exclude)
+	findings = append(findings, bitFinding("button 1", layout.Button1))
+
+	exclude = append(exclude, layout.Button1)
+	layout.Button2 = findFlag(rec[StepButton2], rec[StepHover], used, 0.5, 0.1, exclude)
+	findings = append(findings, bitFinding("button 2", layout.Button2))
+
+	return layout, findings, nil
+}
+
+// commonLength returns the most frequent report length
+func commonLength(rec Recording) int {
+	counts := map[int]int{}
+	for _, reports := range rec {
+		for _, r := range reports {
+			counts[len(r)]++
+		}
+	}
+
+	best, bestCount := 0, 0
+	for length, count := range counts {
+		if count > bestCount || (count == bestCount && length > best) {
+			best, bestCount = length, count
+		}
+	}
+	return best
+}
+
+// constantFirstByte returns the first byte if it is the same in every report
+func constantFirstByte(rec Recording) (uint8, bool) {
+	var first uint8
+	seen := false
+	for _, reports := range rec {
+		for _, r := range reports {
+			if len(r) == 0 {
+				continue
+			}
+			if seen && r[0] != first {
+				return 0, false
+			}
+			first, seen = r[0], true
+		}
+	}
+	return first, seen
+}
+
+// candidateFields lists the 16-bit fields that fit into the free bytes
+func candidateFields(length int, used map[int]bool) []tablet.Field {
+	var fields []tablet.Field
+	for offset := 0; offset+2 <= length; offset++ {
+		if used[offset] || used[offset+1] {
+			continue
+		}
+		// Little-endian first so it wins ties, as it is the HID convention
+		fields = append(fields,
+			tablet.Field{Offset: offset, Size: 2},
+			tablet.Field{Offset: offset, Size: 2, BigEndian: true},
+		)
+	}
+	return fields
+}
+
+// bestField returns the candidate field with the highest score
+func bestField(reports [][]byte, length int, used map[int]bool, score func([]int) float64) (tablet.Field, float64, bool) {
+	var best tablet.Field
+	bestScore := 0.0
+
+	for _, field := range candidateFields(length, used) {
+		values := fieldValues(reports, field)
+		if s := score(values); s > bestScore {
+			best, bestScore = field, s
+		}
+	}
+	return best, bestScore, bestScore > 0
+}
+
+// fieldValues reads a field from every report long enough to contain it
+func fieldValues(reports [][]byte, field tablet.Field) []int {
+	values := make([]int, 0, len(reports))
+	for _, r := range reports {
+		if v, err := field.Read(r); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// monotonicScore rates how steadily the values increase. Reading a field
+// with the wrong byte order makes the low byte wrap around, which shows up
+// as frequent decreases and a lower score.
+func monotonicScore(values []int) float64 {
+	up, down, distinct := 0, 0, map[int]bool{}
+	for i, v := range values {
+		distinct[v] = true
+		if i == 0 {
+			continue
+		}
+		switch {
+		case v > values[i-1]:
+			up++
+		case v < values[i-1]:
+			down++
+		}
+	}
+
+	// A coordinate takes many different values along an axis
+	if len(distinct) < 16 || up+down == 0 {
+		return 0
+	}
+	return float64(up-down) / float64(up+down)
+}
+
+// pressureScore rates how well the values look like a pressure reading:
+// a wide range covered in small steps
+func pressureScore(values []int) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	lo, hi := values[0], values[0]
+	totalStep := 0.0
+	for i, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+		if i > 0 {
+			totalStep += math.Abs(float64(v - values[i-1]))
+		}
+	}
+	spread := float64(hi - lo)
+	if spread < 16 {
+		return 0
+	}
+
+	// Average step relative to the range; wrong byte order makes big jumps
+	smoothness := totalStep / float64(len(values)-1) / spread
+	if smoothness > 0.25 {
+		return 0
+	}
+	return math.Log2(spread) * (1 - smoothness)
+}
+
+// findFlag finds the bit that is set in at least minActive of the active
+// reports and in at most maxBaseline of the baseline reports
+func findFlag(active, baseline [][]byte, used map[int]bool, minActive, maxBaseline float64, exclude []tablet.Bit) tablet.Bit {
+	var best tablet.Bit
+	bestScore := 0.0
+
+	for offset := 0; offset < reportWidth(active); offset++ {
+		if used[offset] {
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			candidate := tablet.Bit{Offset: offset, Mask: 1 << bit}
+			if containsBit(exclude, candidate) {
+				continue
+			}
+
+			on := bitFraction(active, candidate)
+			off := bitFraction(baseline, candidate)
+			if len(baseline) == 0 || on < minActive || off > maxBaseline {
+				continue
+			}
+			if score := on - off; score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+	}
+	return best
+}
+
+// findProximityFlag finds the in-range bit: set in nearly every hover
+// report, and cleared in the last report of the leave step after being set
+// in it. Tablets keep the bit set until they stop reporting, so the leave
+// step may end with a single report without it.
+func findProximityFlag(hover, leave [][]byte, used map[int]bool) tablet.Bit {
+	var best tablet.Bit
+	bestScore := 0.0
+	if len(leave) == 0 {
+		return best
+	}
+	last := leave[len(leave)-1]
+
+	for offset := 0; offset < reportWidth(hover); offset++ {
+		if used[offset] {
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			candidate := tablet.Bit{Offset: offset, Mask: 1 << bit}
+			on := bitFraction(hover, candidate)
+			if on < 0.9 || candidate.Read(last) || bitFraction(leave, candidate) == 0 {
+				continue
+			}
+			if on > bestScore {
+				best, bestScore = candidate, on
+			}
+		}
+	}
+	return best
+}
+
+// bitFraction returns the fraction of reports with the bit set
+func bitFraction(reports [][]byte, bit tablet.Bit) float64 {
+	if len(reports) == 0 {
+		return 0
+	}
+	set := 0
+	for _, r := range reports {
+		if bit.Read(r) {
+			set++
+		}
+	}
+	return float64(set) / float64(len(reports))
+}
+
+// reportWidth returns the length of the longest report
+func reportWidth(reports [][]byte) int {
+	width := 0
+	for _, r := range reports {
+		width = max(width, len(r))
+	}
+	return width
+}
+
+// containsBit reports whether the bit is in the list
+func containsBit(list []tablet.Bit, bit tablet.Bit) bool {
+	for _, b := range list {
+		if b == bit {
+			return true
+		}
+	}
+	return false
+}
+
+// markUsed records the bytes covered by a field
+func markUsed(used map[int]bool, field tablet.Field) {
+	for i := 0; i < field.Size; i++ {
+		used[field.Offset+i] = true
+	}
+}
+
+// observedMax returns the largest value of a field in the reports
+func observedMax(reports [][]byte, field tablet.Field) int {
+	values := fieldValues(reports, field)
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Ints(values)
+	return values[len(values)-1]
+}
+
+// roundUpToMask rounds up to the next value of the form 2^n-1, the usual
+// range of a pressure sensor, e.g. 7000 becomes 8191
+func roundUpToMask(v int) int {
+	if v <= 0 {
+		return 0
+	}
+	return 1<<bits.Len(uint(v)) - 1
+}
+
+func fieldFinding(name string, f tablet.Field, score float64) Finding {
+	order := "little-endian"
+	if f.BigEndian {
+		order = "big-endian"
+	}
+	return Finding{
+		Name:   name,
+		Detail: fmt.Sprintf("bytes %d-%d, %s (score %.2f)", f.Offset, f.Offset+f.Size-1, order, score),
+		Found:  true,
+	}
+}
+
+func bitFinding(name string, b tablet.Bit) Finding {
+	if b.Mask == 0 {
+		return Finding{Name: name, Detail: "not found"}
+	}
+	return Finding{
+		Name:   name,
+		Detail: fmt.Sprintf("byte %d, mask 0x%02x", b.Offset, b.Mask),
+		Found:  true,
+	}
+}
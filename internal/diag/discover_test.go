@@ -0,0 +1,130 @@
+package diag
+
+import (
+	"testing"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// Status bits of the synthetic tablet. 0xa0 is set in every report.
+const (
+	testStatus  = 0xa0
+	testTip     = 0x01
+	testInRange = 0x02
+	testButton1 = 0x04
+	testButton2 = 0x08
+)
+
+// testReport builds a report laid out like the Star G640's
+func testReport(status byte, x, y, pressure int) []byte {
+	return []byte{
+		0x07, status,
+		byte(x), byte(x >> 8),
+		byte(y), byte(y >> 8),
+		byte(pressure), byte(pressure >> 8),
+	}
+}
+
+// hovering returns n reports of a pen wobbling around (x, y)
+func hovering(n int, status byte, x, y, pressure int) [][]byte {
+	var reports [][]byte
+	for i := range n {
+		reports = append(reports, testReport(status, x+i%5, y+i%3, pressure))
+	}
+	return reports
+}
+
+// testRecording returns what the wizard would record from the tablet,
+// with the given reports for the leave step
+func testRecording(leave [][]byte) Recording {
+	rec := Recording{
+		StepLeave:   leave,
+		StepHover:   hovering(40, testStatus|testInRange, 12000, 8000, 0),
+		StepTouch:   hovering(40, testStatus|testInRange|testTip, 12000, 8000, 500),
+		StepButton1: hovering(40, testStatus|testInRange|testButton1, 12000, 8000, 0),
+		StepButton2: hovering(40, testStatus|testInRange|testButton2, 12000, 8000, 0),
+	}
+	for i := range 120 {
+		// Press harder and softer three times
+		pressure := (i % 40) * 200
+		if i%40 >= 20 {
+			pressure = (40 - i%40) * 200
+		}
+		rec[StepPressure] = append(rec[StepPressure], testReport(testStatus|testInRange|testTip, 12000, 8000, pressure))
+	}
+	for i := range 100 {
+		rec[StepMoveX] = append(rec[StepMoveX], testReport(testStatus|testInRange, i*300, 8000+i%3, 0))
+		rec[StepMoveY] = append(rec[StepMoveY], testReport(testStatus|testInRange, 12000+i%3, i*150, 0))
+	}
+	return rec
+}
+
+// wantLayout is the layout of the synthetic tablet
+var wantLayout = tablet.ReportLayout{
+	Length:    8,
+	ReportID:  0x07,
+	X:         tablet.Field{Offset: 2, Size: 2},
+	Y:         tablet.Field{Offset: 4, Size: 2},
+	Pressure:  tablet.Field{Offset: 6, Size: 2},
+	TipSwitch: tablet.Bit{Offset: 1, Mask: testTip},
+	InRange:   tablet.Bit{Offset: 1, Mask: testInRange},
+	Button1:   tablet.Bit{Offset: 1, Mask: testButton1},
+	Button2:   tablet.Bit{Offset: 1, Mask: testButton2},
+}
+
+func TestProposeLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		leave [][]byte
+	}{
+		{
+			// The tablet keeps the bit set until the very last report
+			name:  "cleared in final report",
+			leave: append(hovering(60, testStatus|testInRange, 12000, 8000, 0), testReport(testStatus, 12000, 8000, 0)),
+		},
+		{
+			name:  "cleared after leaving",
+			leave: append(hovering(30, testStatus|testInRange, 12000, 8000, 0), hovering(30, testStatus, 12000, 8000, 0)...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, findings, err := ProposeLayout(testRecording(tt.leave))
+			if err != nil {
+				t.Fatalf("ProposeLayout failed: %v", err)
+			}
+			if layout != wantLayout {
+				t.Errorf("layout = %+v, want %+v", layout, wantLayout)
+			}
+			for _, f := range findings {
+				if !f.Found {
+					t.Errorf("%s not found: %s", f.Name, f.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestProposeLayoutWithoutLeaving(t *testing.T) {
+	// Without a report after the pen left, no bit can be trusted
+	layout, _, err := ProposeLayout(testRecording(hovering(60, testStatus|testInRange, 12000, 8000, 0)))
+	if err != nil {
+		t.Fatalf("ProposeLayout failed: %v", err)
+	}
+	if layout.InRange != (tablet.Bit{}) {
+		t.Errorf("in range = %+v, want none", layout.InRange)
+	}
+	if layout.X != wantLayout.X || layout.Y != wantLayout.Y || layout.Pressure != wantLayout.Pressure {
+		t.Errorf("fields = %+v %+v %+v, want %+v %+v %+v",
+			layout.X, layout.Y, layout.Pressure, wantLayout.X, wantLayout.Y, wantLayout.Pressure)
+	}
+}
+
+func TestProposeLayoutNeedsMovement(t *testing.T) {
+	rec := testRecording(hovering(10, testStatus, 0, 0, 0))
+	rec[StepMoveX] = hovering(40, testStatus|testInRange, 12000, 8000, 0)
+	if _, _, err := ProposeLayout(rec); err == nil {
+		t.Error("ProposeLayout succeeded without any movement along X")
+	}
+}
@@ -0,0 +1,230 @@
+// Package diag contains diagnostic tools for working out how a tablet
+// reports pen input.
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// ANSI escape sequences used by the live view
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiReset   = "\x1b[0m"
+	ansiChanged = "\x1b[1;31m" // Bits that changed in the latest report
+	ansiActive  = "\x1b[33m"   // Bits that changed at some point
+	ansiDim     = "\x1b[2m"    // Bits that never changed
+)
+
+// maxTransitions is the number of button and proximity changes kept
+const maxTransitions = 10
+
+// Range tracks the smallest and largest observed value
+type Range struct {
+	Min, Max int
+	seen     bool
+}
+
+// Observe extends the range to include the value
+func (r *Range) Observe(v int) {
+	if !r.seen {
+		r.Min, r.Max, r.seen = v, v, true
+		return
+	}
+	r.Min = min(r.Min, v)
+	r.Max = max(r.Max, v)
+}
+
+// String formats the range for display
+func (r Range) String() string {
+	if !r.seen {
+		return "-"
+	}
+	return fmt.Sprintf("%d..%d", r.Min, r.Max)
+}
+
+// Transition records a change of a pen flag
+type Transition struct {
+	Time  time.Time
+	Name  string
+	Value bool
+}
+
+// Monitor accumulates statistics about a stream of raw reports
+type Monitor struct {
+	profile tablet.Profile
+
+	report    []byte // Latest report
+	changed   []byte // Bits that changed in the latest report
+	ever      []byte // Bits that changed at any point
+	pen       *tablet.PenData
+	decodeErr error
+
+	count     int
+	rate      float64 // Reports per second over the last second
+	rateStart time.Time
+	rateCount int
+	lengths   map[int]int // Report lengths seen and how often
+
+	X, Y, Pressure Range
+	Transitions    []Transition
+}
+
+// NewMonitor creates a monitor that decodes reports with the profile
+func NewMonitor(profile tablet.Profile) *Monitor {
+	return &Monitor{
+		profile: profile,
+		lengths: map[int]int{},
+	}
+}
+
+// Update adds a report received at the given time
+func (m *Monitor) Update(report []byte, now time.Time) {
+	m.count++
+	m.lengths[len(report)]++
+
+	// Work out which bits changed compared to the previous report
+	if len(m.ever) < len(report) {
+		m.ever = append(m.ever, make([]byte, len(report)-len(m.ever))...)
+	}
+	m.changed = make([]byte, len(report))
+	for i, b := range report {
+		if i < len(m.report) {
+			m.changed[i] = b ^ m.report[i]
+		}
+		m.ever[i] |= m.changed[i]
+	}
+	m.report = append(m.report[:0], report...)
+
+	// Decode and track ranges and flag transitions
+	pen, err := m.profile.Layout.Decode(report)
+	m.decodeErr = err
+	if err == nil {
+		m.X.Observe(pen.X)
+		m.Y.Observe(pen.Y)
+		m.Pressure.Observe(pen.Pressure)
+
+		if m.pen != nil {
+			m.transition(now, "in range", m.pen.InRange, pen.InRange)
+			m.transition(now, "pen down", m.pen.PenDown, pen.PenDown)
+			m.transition(now, "button 1", m.pen.Button1, pen.Button1)
+			m.transition(now, "button 2", m.pen.Button2, pen.Button2)
+		}
+		m.pen = pen
+	}
+
+	// Report rate over roughly the last second
+	if m.rateStart.IsZero() {
+		m.rateStart = now
+	}
+	m.rateCount++
+	m.Refresh(now)
+}
+
+// Refresh brings the report rate up to date, so it falls to zero when the
+// tablet stops reporting
+func (m *Monitor) Refresh(now time.Time) {
+	if m.rateStart.IsZero() {
+		return
+	}
+	if elapsed := now.Sub(m.rateStart); elapsed >= time.Second {
+		m.rate = float64(m.rateCount) / elapsed.Seconds()
+		m.rateStart = now
+		m.rateCount = 0
+	}
+}
+
+// transition records a flag change
+func (m *Monitor) transition(now time.Time, name string, before, after bool) {
+	if before == after {
+		return
+	}
+	m.Transitions = append(m.Transitions, Transition{Time: now, Name: name, Value: after})
+	if len(m.Transitions) > maxTransitions {
+		m.Transitions = m.Transitions[len(m.Transitions)-maxTransitions:]
+	}
+}
+
+// Render draws the full-screen live view
+func (m *Monitor) Render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString(ansiClear)
+
+	fmt.Fprintf(&b, "Profile %s  reports %d  rate %.0f/s  lengths %s\n\n",
+		m.profile.Name, m.count, m.rate, m.lengthSummary())
+
+	// Raw bytes, with bit-level change highlighting
+	b.WriteString("Byte  Hex  Bits       (red: changed now, yellow: changed before)\n")
+	for i, v := range m.report {
+		fmt.Fprintf(&b, "%4d  %s  ", i, highlightByte(fmt.Sprintf("%02x", v), m.changed[i]))
+		for bit := 7; bit >= 0; bit-- {
+			mask := byte(1) << bit
+			digit := "0"
+			if v&mask != 0 {
+				digit = "1"
+			}
+			switch {
+			case m.changed[i]&mask != 0:
+				b.WriteString(ansiChanged + digit + ansiReset)
+			case m.ever[i]&mask != 0:
+				b.WriteString(ansiActive + digit + ansiReset)
+			default:
+				b.WriteString(ansiDim + digit + ansiReset)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	// Decoded fields
+	b.WriteString("\nDecoded\n")
+	if m.decodeErr != nil {
+		fmt.Fprintf(&b, "  error: %v\n", m.decodeErr)
+	} else if m.pen != nil {
+		p := m.pen
+		fmt.Fprintf(&b, "  X %5d  (%s of %d)\n", p.X, m.X, m.profile.MaxX)
+		fmt.Fprintf(&b, "  Y %5d  (%s of %d)\n", p.Y, m.Y, m.profile.MaxY)
+		fmt.Fprintf(&b, "  Pressure %4d  (%s of %d)\n", p.Pressure, m.Pressure, m.profile.MaxPressure)
+		if p.HasTilt {
+			fmt.Fprintf(&b, "  Tilt X %3d  Y %3d\n", p.TiltX, p.TiltY)
+		} else {
+			b.WriteString("  Tilt not reported\n")
+		}
+		fmt.Fprintf(&b, "  InRange %t  PenDown %t  Button1 %t  Button2 %t\n", p.InRange, p.PenDown, p.Button1, p.Button2)
+	}
+
+	// Recent transitions
+	b.WriteString("\nTransitions\n")
+	for i := len(m.Transitions) - 1; i >= 0; i-- {
+		t := m.Transitions[i]
+		state := "off"
+		if t.Value {
+			state = "on"
+		}
+		fmt.Fprintf(&b, "  %s  %-8s %s\n", t.Time.Format("15:04:05.000"), t.Name, state)
+	}
+
+	io.WriteString(w, b.String())
+}
+
+// lengthSummary lists the report lengths seen, e.g. "8(120) 12(3)"
+func (m *Monitor) lengthSummary() string {
+	var parts []string
+	for length := 0; length <= 64; length++ {
+		if n := m.lengths[length]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d(%d)", length, n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// highlightByte marks text red if any bit of the byte changed
+func highlightByte(text string, changed byte) string {
+	if changed == 0 {
+		return text
+	}
+	return ansiChanged + text + ansiReset
+}
@@ -0,0 +1,26 @@
+package diag
+
+import (
+	"testing"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+func TestMonitorRateFallsWhenQuiet(t *testing.T) {
+	m := NewMonitor(tablet.StarG640)
+	start := time.Now()
+	for i := range 201 {
+		m.Update(testReport(testStatus|testInRange, 100, 100, 0), start.Add(time.Duration(i)*5*time.Millisecond))
+	}
+	if m.rate < 150 {
+		t.Fatalf("rate %.0f/s while reporting, want about 200/s", m.rate)
+	}
+
+	// The tablet stops reporting; redraws bring the rate down
+	m.Refresh(start.Add(1500 * time.Millisecond))
+	m.Refresh(start.Add(2500 * time.Millisecond))
+	if m.rate != 0 {
+		t.Errorf("rate %.0f/s after a second without reports, want 0", m.rate)
+	}
+}
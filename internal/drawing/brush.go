@@ -0,0 +1,74 @@
+package drawing
+
+import "math"
+
+// Brush selects how the width of a stroke varies along its path
+type Brush string
+
+const (
+	// BrushRound varies the width with pressure
+	BrushRound Brush = "round"
+	// BrushChisel behaves like a flat marker nib: the stroke is broad when
+	// moving across the nib and thin when moving along it
+	BrushChisel Brush = "chisel"
+)
+
+// Default width ranges of the brushes in canvas units
+const (
+	chiselMinWidth = 2.0
+	chiselMaxWidth = 16.0
+	eraserMinWidth = 16.0
+	eraserMaxWidth = 32.0
+)
+
+// chiselNibAngle is the nib direction used when the pen reports no tilt:
+// the classic 45 degree calligraphy angle
+const chiselNibAngle = -math.Pi / 4
+
+// Tilt is the inclination of the pen in degrees from vertical. X is positive
+// when the pen leans to the right and Y when it leans towards the user.
+type Tilt struct {
+	X, Y float64
+}
+
+// Azimuth returns the direction the pen leans towards in radians, measured
+// clockwise from the X axis of the canvas. It is 0 for an upright pen.
+func (t Tilt) Azimuth() float64 {
+	tx, ty := math.Tan(t.X*math.Pi/180), math.Tan(t.Y*math.Pi/180)
+	if tx == 0 && ty == 0 {
+		return 0
+	}
+	return math.Atan2(ty, tx)
+}
+
+// Altitude returns the angle between the pen and the surface in radians,
+// from 0 for a pen lying flat to π/2 for an upright pen
+func (t Tilt) Altitude() float64 {
+	tx, ty := math.Tan(t.X*math.Pi/180), math.Tan(t.Y*math.Pi/180)
+	return math.Atan(1 / math.Hypot(tx, ty))
+}
+
+// WidthAt returns the width of the stroke at the point with the given index
+func (s *Stroke) WidthAt(i int) float64 {
+	p := s.Points[i]
+	if s.Brush != BrushChisel {
+		return s.GetWidth(p.Pressure, s.VelocityAt(i))
+	}
+
+	// The flat edge of the nib lies across the direction the pen leans in
+	nib := chiselNibAngle
+	if p.Tilt != nil && (p.Tilt.X != 0 || p.Tilt.Y != 0) {
+		nib = p.Tilt.Azimuth() + math.Pi/2
+	}
+
+	// Direction of travel through the point, from its neighbours
+	prev, next := s.Points[max(i-1, 0)], s.Points[min(i+1, len(s.Points)-1)]
+	dx, dy := next.X-prev.X, next.Y-prev.Y
+	if dx == 0 && dy == 0 {
+		return s.MaxWidth
+	}
+	direction := math.Atan2(dy, dx)
+
+	across := math.Abs(math.Sin(direction - nib))
+	return s.MinWidth + (s.MaxWidth-s.MinWidth)*across
+}
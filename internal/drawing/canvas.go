@@ -1,22 +1,38 @@
 package drawing
 
 import (
+	"encoding/hex"
+	"fmt"
 	"image/color"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Point represents a point in the drawing with coordinates and pressure
 type Point struct {
-	X, Y     float64 // Normalized coordinates (0.0 to 1.0)
-	Pressure float64 // Pressure value (0.0 to 1.0)
+	X, Y     float64   // Canvas coordinates (canvas units, independent of window size)
+	Pressure float64   // Pressure value (0.0 to 1.0)
+	Tilt     *Tilt     // Pen tilt, nil if the device does not report it
+	Time     time.Time // When the sample was read from the device, zero if unknown
 }
 
 // Stroke represents a continuous drawing stroke
 type Stroke struct {
 	Points    []Point
-	Color     color.Color // Always black per specification
-	MinWidth  float64     // Minimum line width
-	MaxWidth  float64     // Maximum line width based on pressure
+	Color     color.Color // Black, or the background colour for eraser strokes
+	MinWidth  float64     // Minimum line width in canvas units
+	MaxWidth  float64     // Maximum line width in canvas units based on pressure
+	Brush     Brush       // How the width varies along the stroke
 	Completed bool        // Whether the stroke is finished
+	Owner     string      // User who drew the stroke, empty for the local user
+	Start     time.Time   // Time of the first point, zero if unknown
+	End       time.Time   // Time of the last point once completed
+	// SpeedThinning is the speed in canvas units per second at which the
+	// pressure-dependent part of the width halves; 0 ignores speed
+	SpeedThinning float64
 }
 
 // NewStroke creates a new stroke with the specified color and width range
@@ -26,17 +42,45 @@ func NewStroke() *Stroke {
 		Color:     color.RGBA{0, 0, 0, 255}, // Black
 		MinWidth:  6.0,                      // 6 pixels minimum width
 		MaxWidth:  8.0,                      // 8 pixels maximum width
+		Brush:     BrushRound,
 		Completed: false,
 	}
 }
 
+// NewEraserStroke creates a wide stroke that paints over others with the
+// background colour
+func NewEraserStroke(background color.Color) *Stroke {
+	s := NewStroke()
+	s.Color = background
+	s.MinWidth, s.MaxWidth = eraserMinWidth, eraserMaxWidth
+	return s
+}
+
+// NewBrushStroke creates a new stroke drawn with the given brush
+func NewBrushStroke(brush Brush) *Stroke {
+	s := NewStroke()
+	s.Brush = brush
+	if brush == BrushChisel {
+		s.MinWidth, s.MaxWidth = chiselMinWidth, chiselMaxWidth
+	}
+	return s
+}
+
 // AddPoint adds a new point to the stroke
 func (s *Stroke) AddPoint(point Point) {
+	if len(s.Points) == 0 {
+		s.Start = point.Time
+	}
 	s.Points = append(s.Points, point)
 }
 
-// GetWidth calculates the line width at a given pressure
-func (s *Stroke) GetWidth(pressure float64) float64 {
+// GetWidth calculates the line width at a given pressure and speed in
+// canvas units per second. Like a real marker, the line gets thinner the
+// faster the pen moves if SpeedThinning is set.
+func (s *Stroke) GetWidth(pressure, speed float64) float64 {
+	if s.SpeedThinning > 0 && speed > 0 {
+		pressure *= s.SpeedThinning / (s.SpeedThinning + speed)
+	}
 	// Linear interpolation between min and max width based on pressure
 	return s.MinWidth + (s.MaxWidth-s.MinWidth)*pressure
 }
@@ -44,6 +88,40 @@ func (s *Stroke) GetWidth(pressure float64) float64 {
 // Complete marks the stroke as finished
 func (s *Stroke) Complete() {
 	s.Completed = true
+	if n := len(s.Points); n > 0 {
+		s.End = s.Points[n-1].Time
+	}
+}
+
+// Duration returns how long the stroke took to draw, or 0 if unknown
+func (s *Stroke) Duration() time.Duration {
+	if s.Start.IsZero() || s.End.IsZero() {
+		return 0
+	}
+	return s.End.Sub(s.Start)
+}
+
+// VelocityAt returns the speed of the pen at the point with the given index
+// in canvas units per second, or 0 if the points carry no times
+func (s *Stroke) VelocityAt(i int) float64 {
+	prev, next := s.Points[max(i-1, 0)], s.Points[min(i+1, len(s.Points)-1)]
+	if prev.Time.IsZero() || next.Time.IsZero() {
+		return 0
+	}
+	dt := next.Time.Sub(prev.Time).Seconds()
+	if dt <= 0 {
+		return 0
+	}
+	return math.Hypot(next.X-prev.X, next.Y-prev.Y) / dt
+}
+
+// Bounds returns the area covered by the stroke including its width
+func (s *Stroke) Bounds() Rect {
+	var bounds Rect
+	for _, p := range s.Points {
+		bounds = bounds.Union(PointRect(p, s.MaxWidth/2))
+	}
+	return bounds
 }
 
 // IsEmpty returns true if the stroke has no points
@@ -51,13 +129,25 @@ func (s *Stroke) IsEmpty() bool {
 	return len(s.Points) == 0
 }
 
-// Canvas represents the drawing surface
+// Canvas represents the drawing surface.
+// The embedded mutex must be held when the canvas is shared between the
+// tablet input goroutine and the UI.
 type Canvas struct {
+	sync.Mutex
 	Strokes       []*Stroke
 	CurrentStroke *Stroke
-	Width         float64
-	Height        float64
+	Width         float64 // Width of the board in canvas units
+	Height        float64 // Height of the board in canvas units
 	Background    color.Color
+	Brush         Brush       // Brush used for new strokes
+	Color         color.Color // Colour of new strokes
+	Owner         string      // Owner of new strokes; Undo only removes the owner's strokes
+	Eraser        bool        // New strokes paint with the background colour
+	SpeedThinning float64     // Speed thinning of new strokes, see Stroke
+	redo          []*Stroke   // Undone strokes, most recent last
+	revision      uint64      // Incremented whenever existing strokes change
+	dirty         Rect        // Area changed since the last call to TakeDirty
+	observers     []*observer
 }
 
 // NewCanvas creates a new canvas with the specified dimensions
@@ -68,19 +158,56 @@ func NewCanvas(width, height float64) *Canvas {
 		Width:         width,
 		Height:        height,
 		Background:    color.RGBA{255, 255, 255, 255}, // White background
+		Brush:         BrushRound,
+		Color:         color.RGBA{0, 0, 0, 255},
 	}
 }
 
 // StartStroke begins a new stroke at the given point
 func (c *Canvas) StartStroke(point Point) {
-	c.CurrentStroke = NewStroke()
+	if c.Eraser {
+		c.StartEraserStroke(point)
+		return
+	}
+	c.CurrentStroke = NewBrushStroke(c.Brush)
+	c.CurrentStroke.SpeedThinning = c.SpeedThinning
+	c.CurrentStroke.Owner = c.Owner
+	if c.Color != nil {
+		c.CurrentStroke.Color = c.Color
+	}
+	c.CurrentStroke.AddPoint(point)
+	c.markDirty(point)
+	c.emit(Event{Kind: EventBegin, Stroke: c.CurrentStroke, Point: point})
+}
+
+// NextStrokeWidth returns the widest line the next stroke can draw, e.g.
+// to size a cursor. The eraser is used if eraser is set or the canvas is in
+// eraser mode.
+func (c *Canvas) NextStrokeWidth(eraser bool) float64 {
+	if eraser || c.Eraser {
+		return eraserMaxWidth
+	}
+	return NewBrushStroke(c.Brush).MaxWidth
+}
+
+// StartEraserStroke begins a new eraser stroke at the given point
+func (c *Canvas) StartEraserStroke(point Point) {
+	c.CurrentStroke = NewEraserStroke(c.Background)
+	c.CurrentStroke.Owner = c.Owner
 	c.CurrentStroke.AddPoint(point)
+	c.markDirty(point)
+	c.emit(Event{Kind: EventBegin, Stroke: c.CurrentStroke, Point: point})
 }
 
 // AddPointToCurrentStroke adds a point to the current stroke
 func (c *Canvas) AddPointToCurrentStroke(point Point) {
 	if c.CurrentStroke != nil {
+		// The new segment and the join at the previous point lie within the
+		// circles around both points
+		c.markDirty(c.CurrentStroke.Points[len(c.CurrentStroke.Points)-1])
 		c.CurrentStroke.AddPoint(point)
+		c.markDirty(point)
+		c.emit(Event{Kind: EventPoint, Stroke: c.CurrentStroke, Point: point})
 	}
 }
 
@@ -89,14 +216,134 @@ func (c *Canvas) FinishStroke() {
 	if c.CurrentStroke != nil && !c.CurrentStroke.IsEmpty() {
 		c.CurrentStroke.Complete()
 		c.Strokes = append(c.Strokes, c.CurrentStroke)
+		c.dirty = c.dirty.Union(c.CurrentStroke.Bounds())
+		c.redo = nil
+		c.emit(Event{Kind: EventEnd, Stroke: c.CurrentStroke})
 	}
 	c.CurrentStroke = nil
 }
 
+// Undo removes the most recently finished stroke of the canvas owner,
+// leaving strokes of other users alone. It returns false if there is
+// nothing to undo.
+func (c *Canvas) Undo() bool {
+	i := len(c.Strokes) - 1
+	for i >= 0 && c.Strokes[i].Owner != c.Owner {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	last := c.Strokes[i]
+	c.Strokes = append(c.Strokes[:i:i], c.Strokes[i+1:]...)
+	c.redo = append(c.redo, last)
+	c.dirty = c.dirty.Union(last.Bounds())
+	c.revision++
+	c.emit(Event{Kind: EventUndo, Stroke: last, Index: i})
+	return true
+}
+
+// Redo restores the most recently undone stroke. It returns false if
+// there is nothing to redo.
+func (c *Canvas) Redo() bool {
+	if len(c.redo) == 0 {
+		return false
+	}
+	stroke := c.redo[len(c.redo)-1]
+	c.redo = c.redo[:len(c.redo)-1]
+
+	// Restoring a stroke on top is just like finishing it again
+	c.Strokes = append(c.Strokes, stroke)
+	c.dirty = c.dirty.Union(stroke.Bounds())
+	c.emit(Event{Kind: EventRedo, Stroke: stroke})
+	return true
+}
+
 // Clear removes all strokes from the canvas
 func (c *Canvas) Clear() {
+	c.dirty = c.dirty.Union(Rect{MaxX: c.Width, MaxY: c.Height})
+	for _, stroke := range c.GetAllStrokes() {
+		c.dirty = c.dirty.Union(stroke.Bounds())
+	}
+
 	c.Strokes = make([]*Stroke, 0)
 	c.CurrentStroke = nil
+	c.redo = nil
+	c.revision++
+	c.emit(Event{Kind: EventClear})
+}
+
+// Replace swaps the contents of the canvas for those of another canvas,
+// e.g. one loaded from a file
+func (c *Canvas) Replace(other *Canvas) {
+	c.Clear()
+	c.Strokes = other.Strokes
+	c.Width = other.Width
+	c.Height = other.Height
+	c.Background = other.Background
+	c.dirty = c.dirty.Union(Rect{MaxX: c.Width, MaxY: c.Height})
+	c.emit(Event{Kind: EventReplace})
+}
+
+// Resize changes the size of the canvas. Strokes keep their coordinates,
+// so growing the canvas adds room to the right and at the bottom.
+func (c *Canvas) Resize(width, height float64) {
+	if width == c.Width && height == c.Height {
+		return
+	}
+	c.Width = width
+	c.Height = height
+	c.revision++
+	c.dirty = c.dirty.Union(Rect{MaxX: c.Width, MaxY: c.Height})
+	c.emit(Event{Kind: EventResize})
+}
+
+// Invalidate marks the whole canvas as changed so that it is drawn again
+func (c *Canvas) Invalidate() {
+	c.dirty = c.dirty.Union(Rect{MaxX: c.Width, MaxY: c.Height})
+}
+
+// AddStroke puts a finished stroke on top, e.g. one drawn by another user
+func (c *Canvas) AddStroke(stroke *Stroke) {
+	c.Strokes = append(c.Strokes, stroke)
+	c.dirty = c.dirty.Union(stroke.Bounds())
+	c.emit(Event{Kind: EventAdd, Stroke: stroke})
+}
+
+// SetStrokes replaces the finished strokes, keeping the stroke in progress
+// and the undo history
+func (c *Canvas) SetStrokes(strokes []*Stroke) {
+	for _, stroke := range c.Strokes {
+		c.dirty = c.dirty.Union(stroke.Bounds())
+	}
+	for _, stroke := range strokes {
+		c.dirty = c.dirty.Union(stroke.Bounds())
+	}
+	c.Strokes = strokes
+	c.revision++
+	c.emit(Event{Kind: EventReplace})
+}
+
+// Copy returns a canvas with the same strokes that can be read without
+// holding the lock, e.g. to render it in the background. Finished strokes
+// never change, so they are shared; the stroke in progress is copied.
+func (c *Canvas) Copy() *Canvas {
+	copied := NewCanvas(c.Width, c.Height)
+	copied.Background = c.Background
+	copied.Strokes = slices.Clone(c.Strokes)
+	if c.CurrentStroke != nil {
+		current := *c.CurrentStroke
+		current.Points = slices.Clone(current.Points)
+		copied.CurrentStroke = &current
+	}
+	return copied
+}
+
+// Revision returns a counter that changes whenever previously finished
+// strokes are modified or removed. Finishing a new stroke does not change it,
+// which lets renderers draw new strokes on top of a cached image.
+func (c *Canvas) Revision() uint64 {
+	return c.revision
 }
 
 // GetAllStrokes returns all completed strokes plus the current stroke if active
@@ -110,3 +357,32 @@ func (c *Canvas) GetAllStrokes() []*Stroke {
 
 	return allStrokes
 }
+
+// IsDirty returns true if the canvas changed since the last call to TakeDirty
+func (c *Canvas) IsDirty() bool {
+	return !c.dirty.Empty()
+}
+
+// TakeDirty returns the area changed since the previous call and resets it
+func (c *Canvas) TakeDirty() Rect {
+	dirty := c.dirty
+	c.dirty = Rect{}
+	return dirty
+}
+
+// markDirty records the area around a point of the current stroke as changed
+func (c *Canvas) markDirty(point Point) {
+	c.dirty = c.dirty.Union(PointRect(point, c.CurrentStroke.MaxWidth/2))
+}
+
+// ParseColor parses a colour written as "#rrggbb" or "#rrggbbaa"
+func ParseColor(s string) (color.Color, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || (len(b) != 3 && len(b) != 4) {
+		return nil, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+	if len(b) == 3 {
+		b = append(b, 0xff)
+	}
+	return color.NRGBA{b[0], b[1], b[2], b[3]}, nil
+}
@@ -0,0 +1,210 @@
+package drawing
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"time"
+)
+
+const (
+	// DocumentVersion is the version of the native file format written by Save
+	DocumentVersion = 2
+
+	// FileExtension is the extension used for native whiteboard documents
+	FileExtension = ".scrawl"
+)
+
+// Coordinate units stored in a document
+const (
+	UnitsNormalized = "normalized" // Version 1: X/Y in 0.0-1.0 relative to the window
+	UnitsCanvas     = "canvas"     // Version 2: X/Y in canvas units
+)
+
+// document is the on-disk representation of a canvas
+type document struct {
+	Version int              `json:"version"`
+	Units   string           `json:"units,omitempty"`
+	Width   float64          `json:"width"`
+	Height  float64          `json:"height"`
+	Strokes []documentStroke `json:"strokes"`
+}
+
+// documentStroke is the on-disk representation of a stroke
+type documentStroke struct {
+	Color    [4]uint8        `json:"color"`
+	MinWidth float64         `json:"minWidth"`
+	MaxWidth float64         `json:"maxWidth"`
+	Brush    Brush           `json:"brush,omitempty"` // Round if empty
+	Owner    string          `json:"owner,omitempty"`
+	Thinning float64         `json:"thinning,omitempty"`
+	Start    time.Time       `json:"start,omitzero"` // Absent if the points carry no times
+	End      time.Time       `json:"end,omitzero"`
+	Points   []documentPoint `json:"points"`
+}
+
+// documentPoint is the on-disk representation of a point
+type documentPoint struct {
+	X        float64     `json:"x"`
+	Y        float64     `json:"y"`
+	Pressure float64     `json:"p"`
+	Tilt     *[2]float64 `json:"tilt,omitempty"` // X and Y tilt in degrees, absent without tilt
+	Time     float64     `json:"t,omitempty"`    // Milliseconds since the start of the stroke
+}
+
+// Save writes the completed strokes of the canvas in the native file format
+func (c *Canvas) Save(w io.Writer) error {
+	doc := document{
+		Version: DocumentVersion,
+		Units:   UnitsCanvas,
+		Width:   c.Width,
+		Height:  c.Height,
+		Strokes: make([]documentStroke, 0, len(c.Strokes)),
+	}
+
+	for _, stroke := range c.Strokes {
+		doc.Strokes = append(doc.Strokes, encodeStroke(stroke))
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode document: %w", err)
+	}
+	return nil
+}
+
+// Load reads a canvas from the native file format.
+// Documents written with normalized coordinates are migrated to canvas units.
+func Load(r io.Reader) (*Canvas, error) {
+	var doc document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	if doc.Version < 1 || doc.Version > DocumentVersion {
+		return nil, fmt.Errorf("unsupported document version %d", doc.Version)
+	}
+
+	// Version 1 documents have no units field and are always normalized
+	units := doc.Units
+	if units == "" {
+		units = UnitsCanvas
+		if doc.Version == 1 {
+			units = UnitsNormalized
+		}
+	}
+
+	width, height := doc.Width, doc.Height
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid document size %gx%g", width, height)
+	}
+
+	var scaleX, scaleY float64
+	switch units {
+	case UnitsCanvas:
+		scaleX, scaleY = 1, 1
+	case UnitsNormalized:
+		scaleX, scaleY = width, height
+	default:
+		return nil, fmt.Errorf("unknown document units %q", units)
+	}
+
+	c := NewCanvas(width, height)
+	for _, ds := range doc.Strokes {
+		stroke, err := decodeStroke(ds, scaleX, scaleY)
+		if err != nil {
+			return nil, err
+		}
+		if stroke.IsEmpty() {
+			continue
+		}
+		c.Strokes = append(c.Strokes, stroke)
+	}
+
+	return c, nil
+}
+
+// encodeStroke converts a stroke to its on-disk representation
+func encodeStroke(stroke *Stroke) documentStroke {
+	r, g, b, a := stroke.Color.RGBA()
+	ds := documentStroke{
+		Color:    [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)},
+		MinWidth: stroke.MinWidth,
+		MaxWidth: stroke.MaxWidth,
+		Owner:    stroke.Owner,
+		Thinning: stroke.SpeedThinning,
+		Start:    stroke.Start,
+		End:      stroke.End,
+		Points:   make([]documentPoint, len(stroke.Points)),
+	}
+	if stroke.Brush != BrushRound {
+		ds.Brush = stroke.Brush
+	}
+	for i, p := range stroke.Points {
+		ds.Points[i] = documentPoint{X: p.X, Y: p.Y, Pressure: p.Pressure}
+		if p.Tilt != nil {
+			ds.Points[i].Tilt = &[2]float64{p.Tilt.X, p.Tilt.Y}
+		}
+		if !stroke.Start.IsZero() && !p.Time.IsZero() {
+			ds.Points[i].Time = float64(p.Time.Sub(stroke.Start)) / float64(time.Millisecond)
+		}
+	}
+	return ds
+}
+
+// decodeStroke converts an on-disk stroke into a completed stroke, scaling
+// its coordinates to canvas units
+func decodeStroke(ds documentStroke, scaleX, scaleY float64) (*Stroke, error) {
+	stroke := NewStroke()
+	stroke.Color = color.RGBA{ds.Color[0], ds.Color[1], ds.Color[2], ds.Color[3]}
+	stroke.MinWidth = ds.MinWidth
+	stroke.MaxWidth = ds.MaxWidth
+	stroke.Owner = ds.Owner
+	stroke.SpeedThinning = ds.Thinning
+	switch ds.Brush {
+	case "", BrushRound:
+	case BrushChisel:
+		stroke.Brush = ds.Brush
+	default:
+		return nil, fmt.Errorf("unknown brush %q", ds.Brush)
+	}
+	for _, p := range ds.Points {
+		point := Point{
+			X:        p.X * scaleX,
+			Y:        p.Y * scaleY,
+			Pressure: p.Pressure,
+		}
+		if p.Tilt != nil {
+			point.Tilt = &Tilt{X: p.Tilt[0], Y: p.Tilt[1]}
+		}
+		if !ds.Start.IsZero() {
+			point.Time = ds.Start.Add(time.Duration(p.Time * float64(time.Millisecond)))
+		}
+		stroke.AddPoint(point)
+	}
+	stroke.Complete()
+	if !ds.End.IsZero() {
+		stroke.End = ds.End
+	}
+	return stroke, nil
+}
+
+// MarshalJSON encodes a stroke the way it is stored in documents
+func (s *Stroke) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeStroke(s))
+}
+
+// UnmarshalJSON decodes a completed stroke in canvas units
+func (s *Stroke) UnmarshalJSON(data []byte) error {
+	var ds documentStroke
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return err
+	}
+	stroke, err := decodeStroke(ds, 1, 1)
+	if err != nil {
+		return err
+	}
+	*s = *stroke
+	return nil
+}
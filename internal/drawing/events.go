@@ -0,0 +1,50 @@
+package drawing
+
+import "slices"
+
+// EventKind identifies a change to a canvas
+type EventKind string
+
+const (
+	EventBegin   EventKind = "begin"   // A stroke was started; Stroke is the new current stroke
+	EventPoint   EventKind = "point"   // Point was added to the current stroke
+	EventEnd     EventKind = "end"     // The current stroke was finished; Stroke is the finished stroke
+	EventClear   EventKind = "clear"   // All strokes were removed
+	EventUndo    EventKind = "undo"    // Stroke was removed from Index by Undo
+	EventRedo    EventKind = "redo"    // Stroke was restored on top
+	EventAdd     EventKind = "add"     // Stroke was put on top, e.g. from another user
+	EventReplace EventKind = "replace" // The finished strokes were replaced, e.g. by opening a file
+	EventResize  EventKind = "resize"  // The canvas changed size; the strokes stay where they are
+)
+
+// Event describes a change to a canvas
+type Event struct {
+	Kind   EventKind
+	Stroke *Stroke
+	Point  Point
+	Index  int // Position of the stroke in the finished strokes, for EventUndo
+}
+
+// observer is a function registered with Observe
+type observer struct {
+	fn func(Event)
+}
+
+// Observe registers a function that is called after every change to the
+// canvas. It is called with the canvas lock held, so it must not block or
+// call back into the canvas. The returned function unregisters it; it too
+// must be called with the lock held.
+func (c *Canvas) Observe(fn func(Event)) (stop func()) {
+	o := &observer{fn}
+	c.observers = append(c.observers, o)
+	return func() {
+		c.observers = slices.DeleteFunc(c.observers, func(other *observer) bool { return other == o })
+	}
+}
+
+// emit passes an event to all observers
+func (c *Canvas) emit(event Event) {
+	for _, o := range c.observers {
+		o.fn(event)
+	}
+}
@@ -0,0 +1,40 @@
+package drawing
+
+import "math"
+
+// Rect is an axis-aligned rectangle in canvas units
+type Rect struct {
+	MinX, MinY float64
+	MaxX, MaxY float64
+}
+
+// PointRect returns the rectangle covered by a circle around the point
+func PointRect(p Point, radius float64) Rect {
+	return Rect{
+		MinX: p.X - radius,
+		MinY: p.Y - radius,
+		MaxX: p.X + radius,
+		MaxY: p.Y + radius,
+	}
+}
+
+// Empty returns true if the rectangle covers no area
+func (r Rect) Empty() bool {
+	return r.MaxX <= r.MinX || r.MaxY <= r.MinY
+}
+
+// Union returns the smallest rectangle containing both rectangles
+func (r Rect) Union(other Rect) Rect {
+	if r.Empty() {
+		return other
+	}
+	if other.Empty() {
+		return r
+	}
+	return Rect{
+		MinX: math.Min(r.MinX, other.MinX),
+		MinY: math.Min(r.MinY, other.MinY),
+		MaxX: math.Max(r.MaxX, other.MaxX),
+		MaxY: math.Max(r.MaxY, other.MaxY),
+	}
+}
@@ -0,0 +1,181 @@
+package drawing
+
+import (
+	"image/color"
+	"sort"
+	"time"
+)
+
+const (
+	// maxReplayGap is the longest pause between two strokes in a replay;
+	// longer breaks in a session are shortened to it
+	maxReplayGap = 2 * time.Second
+
+	// untimedPointInterval paces points that were saved without times
+	untimedPointInterval = 10 * time.Millisecond
+
+	// untimedStrokeGap separates strokes that were saved without times
+	untimedStrokeGap = 200 * time.Millisecond
+)
+
+// Replay plays the strokes of a canvas back in the order and at the pace
+// they were drawn
+type Replay struct {
+	width, height float64
+	background    color.Color
+	strokes       []*Stroke
+	times         [][]time.Duration // Offset of every point from the start of the replay
+	duration      time.Duration
+}
+
+// NewReplay creates a replay of the finished strokes of the canvas. The
+// canvas lock must be held while it is called.
+func NewReplay(c *Canvas) *Replay {
+	r := &Replay{
+		width:      c.Width,
+		height:     c.Height,
+		background: c.Background,
+	}
+
+	var clock time.Duration
+	var lastEnd time.Time // End of the previous stroke, zero if it had no times
+	for _, stroke := range c.Strokes {
+		if stroke.IsEmpty() {
+			continue
+		}
+
+		gap := untimedStrokeGap
+		if len(r.strokes) == 0 {
+			gap = 0
+		} else if !stroke.Start.IsZero() && !lastEnd.IsZero() {
+			gap = max(0, min(stroke.Start.Sub(lastEnd), maxReplayGap))
+		}
+		base := clock + gap
+
+		times := make([]time.Duration, len(stroke.Points))
+		for j, p := range stroke.Points {
+			if stroke.Start.IsZero() || p.Time.IsZero() {
+				times[j] = base + time.Duration(j)*untimedPointInterval
+			} else {
+				times[j] = base + p.Time.Sub(stroke.Start)
+			}
+			// Samples can arrive out of order across interfaces
+			if j > 0 && times[j] < times[j-1] {
+				times[j] = times[j-1]
+			}
+		}
+
+		clock = times[len(times)-1]
+		lastEnd = stroke.Points[len(stroke.Points)-1].Time
+		if stroke.Start.IsZero() {
+			lastEnd = time.Time{}
+		}
+
+		r.strokes = append(r.strokes, stroke)
+		r.times = append(r.times, times)
+	}
+	r.duration = clock
+	return r
+}
+
+// Duration returns the length of the replay
+func (r *Replay) Duration() time.Duration {
+	return r.duration
+}
+
+// NewCanvas creates an empty canvas with the size and background of the
+// replayed one, for Render to draw into
+func (r *Replay) NewCanvas() *Canvas {
+	c := NewCanvas(r.width, r.height)
+	c.Background = r.background
+	return c
+}
+
+// At returns a new canvas showing the board at time t
+func (r *Replay) At(t time.Duration) *Canvas {
+	c := r.NewCanvas()
+	r.Render(c, t)
+	return c
+}
+
+// Render updates the canvas to show the board at time t, with the stroke
+// being drawn at that moment as its current stroke. Moving forward only
+// appends strokes, so renderers keep their cached layers while playing.
+// The canvas lock must be held while it is called.
+func (r *Replay) Render(dst *Canvas, t time.Duration) {
+	// Strokes are laid out one after another, so the finished ones form a prefix
+	finished := sort.Search(len(r.strokes), func(i int) bool {
+		times := r.times[i]
+		return times[len(times)-1] > t
+	})
+
+	shown := len(dst.Strokes)
+	if shown > finished || (shown > 0 && dst.Strokes[shown-1] != r.strokes[shown-1]) {
+		// Seeking backwards starts over
+		dst.Clear()
+		shown = 0
+	}
+	for _, stroke := range r.strokes[shown:finished] {
+		dst.Strokes = append(dst.Strokes, stroke)
+		dst.dirty = dst.dirty.Union(stroke.Bounds())
+	}
+
+	// The stroke in progress shows the points drawn up to t
+	var current *Stroke
+	if finished < len(r.strokes) {
+		times := r.times[finished]
+		n := sort.Search(len(times), func(j int) bool { return times[j] > t })
+		if n > 0 {
+			stroke := r.strokes[finished]
+			if previous := dst.CurrentStroke; previous != nil && len(previous.Points) == n &&
+				&previous.Points[0] == &stroke.Points[0] {
+				return // Nothing changed since the last call
+			}
+			partial := *stroke
+			partial.Points = stroke.Points[:n:n]
+			partial.Completed = false
+			current = &partial
+		}
+	}
+
+	if dst.CurrentStroke != nil {
+		dst.dirty = dst.dirty.Union(dst.CurrentStroke.Bounds())
+	}
+	dst.CurrentStroke = current
+	if current != nil {
+		dst.dirty = dst.dirty.Union(current.Bounds())
+	}
+}
+
+// PenAt returns where the pen is at time t and the stroke it is drawing or
+// last drew. Between strokes the pen moves in a straight line from the end
+// of one stroke to the start of the next, as if hovering. It returns false
+// if there are no strokes.
+func (r *Replay) PenAt(t time.Duration) (Point, *Stroke, bool) {
+	if len(r.strokes) == 0 {
+		return Point{}, nil, false
+	}
+
+	// First stroke that has not finished at t
+	i := sort.Search(len(r.strokes), func(i int) bool {
+		times := r.times[i]
+		return times[len(times)-1] > t
+	})
+	if i == len(r.strokes) {
+		last := r.strokes[i-1]
+		return last.Points[len(last.Points)-1], last, true
+	}
+
+	stroke, times := r.strokes[i], r.times[i]
+	if t >= times[0] || i == 0 {
+		n := sort.Search(len(times), func(j int) bool { return times[j] > t })
+		return stroke.Points[max(n-1, 0)], stroke, true
+	}
+
+	// Hovering from the previous stroke to this one
+	prev, prevTimes := r.strokes[i-1], r.times[i-1]
+	from, to := prev.Points[len(prev.Points)-1], stroke.Points[0]
+	start, end := prevTimes[len(prevTimes)-1], times[0]
+	f := float64(t-start) / float64(end-start)
+	return Point{X: from.X + (to.X-from.X)*f, Y: from.Y + (to.Y-from.Y)*f}, prev, true
+}
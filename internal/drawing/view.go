@@ -0,0 +1,62 @@
+package drawing
+
+// View maps canvas coordinates onto a display area of arbitrary size.
+// The canvas is scaled uniformly and centred, so strokes keep their
+// proportions when the window is resized.
+type View struct {
+	Scale   float64 // Display units per canvas unit
+	OffsetX float64 // Horizontal offset of the canvas origin in display units
+	OffsetY float64 // Vertical offset of the canvas origin in display units
+}
+
+// FitView creates a view that fits the whole canvas inside the display area
+func FitView(canvasWidth, canvasHeight, viewWidth, viewHeight float64) View {
+	if canvasWidth <= 0 || canvasHeight <= 0 || viewWidth <= 0 || viewHeight <= 0 {
+		return View{Scale: 1}
+	}
+
+	// Use the smaller scale factor so the canvas is never stretched
+	scale := viewWidth / canvasWidth
+	if s := viewHeight / canvasHeight; s < scale {
+		scale = s
+	}
+
+	return View{
+		Scale:   scale,
+		OffsetX: (viewWidth - canvasWidth*scale) / 2,
+		OffsetY: (viewHeight - canvasHeight*scale) / 2,
+	}
+}
+
+// ToScreen converts canvas coordinates to display coordinates
+func (v View) ToScreen(x, y float64) (float64, float64) {
+	return x*v.Scale + v.OffsetX, y*v.Scale + v.OffsetY
+}
+
+// ToCanvas converts display coordinates to canvas coordinates
+func (v View) ToCanvas(x, y float64) (float64, float64) {
+	if v.Scale == 0 {
+		return x, y
+	}
+	return (x - v.OffsetX) / v.Scale, (y - v.OffsetY) / v.Scale
+}
+
+// Scaled returns the view with all display coordinates multiplied by factor,
+// e.g. to convert from device-independent units to device pixels
+func (v View) Scaled(factor float64) View {
+	return View{
+		Scale:   v.Scale * factor,
+		OffsetX: v.OffsetX * factor,
+		OffsetY: v.OffsetY * factor,
+	}
+}
+
+// ZoomedAt returns the view magnified by factor around the display point
+// (x, y), which stays in place
+func (v View) ZoomedAt(factor, x, y float64) View {
+	return View{
+		Scale:   v.Scale * factor,
+		OffsetX: x - (x-v.OffsetX)*factor,
+		OffsetY: y - (y-v.OffsetY)*factor,
+	}
+}
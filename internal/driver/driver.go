@@ -0,0 +1,215 @@
+// Package driver forwards processed pen input to a virtual tablet so that
+// every application receives it, not only the whiteboard.
+package driver
+
+import (
+	"fmt"
+	"math"
+
+	"xp-pen-controller/internal/input"
+	"xp-pen-controller/internal/logging"
+	"xp-pen-controller/internal/tablet"
+)
+
+var logger = logging.For(logging.Input)
+
+// Sample is a processed pen sample
+type Sample struct {
+	X, Y         float64 // Position from 0.0 to 1.0 across the output area
+	Pressure     float64 // Pressure from 0.0 to 1.0 after the pressure curve
+	TiltX, TiltY int     // Tilt in degrees, valid if HasTilt
+	HasTilt      bool
+	InRange      bool
+	Touch        bool
+	Eraser       bool
+	Button1      bool
+	Button2      bool
+}
+
+// Axes are the ranges of the virtual tablet
+type Axes struct {
+	MaxX, MaxY  int
+	MaxPressure int
+	MaxTilt     int // Largest tilt in degrees, 0 if tilt is not reported
+	Resolution  int // Position units per millimetre
+}
+
+// DefaultAxes are the ranges of the virtual tablet, independent of the
+// physical one since samples are normalized
+var DefaultAxes = Axes{
+	MaxX:        32767,
+	MaxY:        32767,
+	MaxPressure: 8191,
+	MaxTilt:     90,
+	Resolution:  100,
+}
+
+// Sink receives input events, such as a uinput device
+type Sink interface {
+	WriteEvents(events []input.Event) error
+	Close() error
+}
+
+// Processor applies the coordinate mapping, pressure curve and smoothing to
+// raw pen data
+type Processor struct {
+	mapper   *tablet.CoordinateMapper
+	smoother *tablet.Smoother
+}
+
+// NewProcessor creates a processor for samples from the source
+func NewProcessor(source tablet.PenSource, pressureCurve, smoothing float64) *Processor {
+	maxX, maxY := source.GetTabletDimensions()
+	mapper := tablet.NewCoordinateMapper(maxX, maxY, 1, 1)
+	mapper.SetMaxPressure(source.GetMaxPressure())
+	mapper.SetPressureCurve(pressureCurve)
+	return &Processor{
+		mapper:   mapper,
+		smoother: tablet.NewSmoother(smoothing),
+	}
+}
+
+// Process converts raw pen data into a sample
+func (p *Processor) Process(pen *tablet.PenData) Sample {
+	pen = p.smoother.Smooth(pen)
+	x, y := p.mapper.TabletToScreen(pen.X, pen.Y)
+	return Sample{
+		X:        x,
+		Y:        y,
+		Pressure: p.mapper.NormalizePressure(pen.Pressure),
+		TiltX:    pen.TiltX,
+		TiltY:    pen.TiltY,
+		HasTilt:  pen.HasTilt,
+		InRange:  pen.InRange || pen.PenDown,
+		Touch:    pen.PenDown,
+		Eraser:   pen.Eraser,
+		Button1:  pen.Button1,
+		Button2:  pen.Button2,
+	}
+}
+
+// eventKey identifies an axis or button
+type eventKey struct {
+	typ, code uint16
+}
+
+// VirtualTablet translates samples into the input events of a pen tablet.
+// Only values that changed are sent, followed by a sync event.
+type VirtualTablet struct {
+	sink   Sink
+	axes   Axes
+	state  map[eventKey]int32 // Last value sent for each axis and button
+	tool   uint16             // Tool in proximity, 0 for none
+	events []input.Event
+}
+
+// NewVirtualTablet creates a virtual tablet that writes to the sink
+func NewVirtualTablet(sink Sink, axes Axes) *VirtualTablet {
+	return &VirtualTablet{
+		sink:  sink,
+		axes:  axes,
+		state: map[eventKey]int32{},
+	}
+}
+
+// Send translates a sample into events and writes them to the sink
+func (vt *VirtualTablet) Send(s Sample) error {
+	vt.events = vt.events[:0]
+
+	tool := uint16(0)
+	if s.InRange {
+		tool = input.BtnToolPen
+		if s.Eraser {
+			tool = input.BtnToolRubber
+		}
+	}
+
+	// A tool change is a proximity out of the old tool and in of the new
+	if tool != vt.tool {
+		if vt.tool != 0 {
+			vt.releaseAll()
+			vt.set(input.EvKey, vt.tool, 0)
+		}
+		vt.tool = tool
+	}
+	if tool == 0 {
+		return vt.flush()
+	}
+
+	vt.set(input.EvAbs, input.AbsX, scale(s.X, vt.axes.MaxX))
+	vt.set(input.EvAbs, input.AbsY, scale(s.Y, vt.axes.MaxY))
+	pressure := 0.0
+	if s.Touch {
+		pressure = s.Pressure
+	}
+	vt.set(input.EvAbs, input.AbsPressure, scale(pressure, vt.axes.MaxPressure))
+	if s.HasTilt && vt.axes.MaxTilt > 0 {
+		vt.set(input.EvAbs, input.AbsTiltX, int32(clamp(s.TiltX, vt.axes.MaxTilt)))
+		vt.set(input.EvAbs, input.AbsTiltY, int32(clamp(s.TiltY, vt.axes.MaxTilt)))
+	}
+
+	// The tool comes after the position so it appears where the pen is
+	vt.set(input.EvKey, tool, 1)
+	vt.set(input.EvKey, input.BtnTouch, boolValue(s.Touch))
+	vt.set(input.EvKey, input.BtnStylus, boolValue(s.Button1))
+	vt.set(input.EvKey, input.BtnStylus2, boolValue(s.Button2))
+
+	return vt.flush()
+}
+
+// Close lifts the pen out of proximity and closes the sink
+func (vt *VirtualTablet) Close() error {
+	err := vt.Send(Sample{})
+	if closeErr := vt.sink.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// releaseAll lifts the pen and releases every button before the tool leaves
+func (vt *VirtualTablet) releaseAll() {
+	vt.set(input.EvAbs, input.AbsPressure, 0)
+	vt.set(input.EvKey, input.BtnTouch, 0)
+	vt.set(input.EvKey, input.BtnStylus, 0)
+	vt.set(input.EvKey, input.BtnStylus2, 0)
+}
+
+// set queues an event if the value differs from the last one sent.
+// Buttons start released, so releasing one that was never pressed is skipped.
+func (vt *VirtualTablet) set(typ, code uint16, value int32) {
+	key := eventKey{typ, code}
+	last, sent := vt.state[key]
+	if last == value && (sent || typ == input.EvKey) {
+		return
+	}
+	vt.state[key] = value
+	vt.events = append(vt.events, input.Event{Type: typ, Code: code, Value: value})
+}
+
+// flush writes the queued events followed by a sync
+func (vt *VirtualTablet) flush() error {
+	if len(vt.events) == 0 {
+		return nil
+	}
+	vt.events = append(vt.events, input.Sync())
+	if err := vt.sink.WriteEvents(vt.events); err != nil {
+		return fmt.Errorf("failed to send pen events: %w", err)
+	}
+	return nil
+}
+
+// scale converts a normalized value to an axis value
+func scale(v float64, max int) int32 {
+	return int32(math.Round(math.Max(0, math.Min(1, v)) * float64(max)))
+}
+
+func clamp(v, limit int) int {
+	return max(-limit, min(limit, v))
+}
+
+func boolValue(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+package driver
+
+import (
+	"slices"
+	"testing"
+
+	"xp-pen-controller/internal/input"
+)
+
+// testAxes have round ranges so expected values are easy to read
+var testAxes = Axes{MaxX: 1000, MaxY: 1000, MaxPressure: 100, MaxTilt: 60}
+
+func absEvent(code uint16, value int32) input.Event {
+	return input.Event{Type: input.EvAbs, Code: code, Value: value}
+}
+
+func keyEvent(code uint16, value int32) input.Event {
+	return input.Event{Type: input.EvKey, Code: code, Value: value}
+}
+
+// sendAll sends the samples and returns the reports each one produced
+func sendAll(t *testing.T, vt *VirtualTablet, sink *MemorySink, samples ...Sample) [][]input.Event {
+	t.Helper()
+	var reports [][]input.Event
+	for _, s := range samples {
+		before := len(sink.Reports())
+		if err := vt.Send(s); err != nil {
+			t.Fatal(err)
+		}
+		after := sink.Reports()
+		switch len(after) - before {
+		case 0:
+			reports = append(reports, nil)
+		case 1:
+			reports = append(reports, after[before])
+		default:
+			t.Fatalf("one sample produced %d reports", len(after)-before)
+		}
+	}
+	return reports
+}
+
+// checkReports compares reports event by event
+func checkReports(t *testing.T, got, want [][]input.Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d reports, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("report %d:\ngot  %v\nwant %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPressureOnlyWhileTouching(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	reports := sendAll(t, vt, sink,
+		Sample{X: 0.5, Y: 0.25, Pressure: 0.3, InRange: true},
+		Sample{X: 0.5, Y: 0.25, Pressure: 0.3, InRange: true, Touch: true},
+		Sample{X: 0.6, Y: 0.25, Pressure: 0.7, InRange: true, Touch: true},
+		Sample{X: 0.6, Y: 0.25, Pressure: 0.7, InRange: true},
+		Sample{X: 0.6, Y: 0.25, Pressure: 0.7, InRange: true},
+	)
+	checkReports(t, reports, [][]input.Event{
+		// Hovering: pressure stays 0 whatever the sample says
+		{absEvent(input.AbsX, 500), absEvent(input.AbsY, 250), absEvent(input.AbsPressure, 0), keyEvent(input.BtnToolPen, 1)},
+		{absEvent(input.AbsPressure, 30), keyEvent(input.BtnTouch, 1)},
+		{absEvent(input.AbsX, 600), absEvent(input.AbsPressure, 70)},
+		{absEvent(input.AbsPressure, 0), keyEvent(input.BtnTouch, 0)},
+		// Nothing changed, nothing sent
+		nil,
+	})
+}
+
+func TestButtonEdges(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	reports := sendAll(t, vt, sink,
+		Sample{InRange: true},
+		Sample{InRange: true, Button1: true},
+		Sample{InRange: true, Button1: true, Button2: true},
+		Sample{InRange: true, Button1: true, Button2: true},
+		Sample{InRange: true, Button2: true},
+		Sample{InRange: true},
+	)
+	checkReports(t, reports[1:], [][]input.Event{
+		{keyEvent(input.BtnStylus, 1)},
+		{keyEvent(input.BtnStylus2, 1)},
+		nil,
+		{keyEvent(input.BtnStylus, 0)},
+		{keyEvent(input.BtnStylus2, 0)},
+	})
+}
+
+func TestToolChange(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	reports := sendAll(t, vt, sink,
+		Sample{X: 0.1, Y: 0.1, Pressure: 0.5, InRange: true, Touch: true, Button1: true},
+		Sample{X: 0.1, Y: 0.1, InRange: true, Eraser: true},
+	)
+	checkReports(t, reports[1:], [][]input.Event{{
+		// The pen is lifted and its buttons released before it leaves
+		absEvent(input.AbsPressure, 0),
+		keyEvent(input.BtnTouch, 0),
+		keyEvent(input.BtnStylus, 0),
+		keyEvent(input.BtnToolPen, 0),
+		keyEvent(input.BtnToolRubber, 1),
+	}})
+}
+
+func TestTiltIsClamped(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	reports := sendAll(t, vt, sink, Sample{InRange: true, HasTilt: true, TiltX: 75, TiltY: -20})
+	want := []input.Event{absEvent(input.AbsTiltX, 60), absEvent(input.AbsTiltY, -20)}
+	if !slices.Equal(reports[0][3:5], want) {
+		t.Errorf("got %v, want tilt %v", reports[0], want)
+	}
+}
+
+func TestCloseReleasesEverything(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	sendAll(t, vt, sink, Sample{X: 0.2, Y: 0.2, Pressure: 0.5, InRange: true, Touch: true, Button2: true})
+	if err := vt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := sink.Reports()
+	checkReports(t, reports[len(reports)-1:], [][]input.Event{{
+		absEvent(input.AbsPressure, 0),
+		keyEvent(input.BtnTouch, 0),
+		keyEvent(input.BtnStylus2, 0),
+		keyEvent(input.BtnToolPen, 0),
+	}})
+	if !sink.Closed {
+		t.Error("sink not closed")
+	}
+	if err := vt.Send(Sample{InRange: true}); err == nil {
+		t.Error("sending after close succeeded")
+	}
+}
+
+func TestOutOfRangeSendsNothing(t *testing.T) {
+	sink := &MemorySink{}
+	vt := NewVirtualTablet(sink, testAxes)
+
+	sendAll(t, vt, sink, Sample{}, Sample{Button1: true})
+	if len(sink.Events) != 0 {
+		t.Errorf("events without a tool in proximity: %v", sink.Events)
+	}
+}
@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"fmt"
+
+	"xp-pen-controller/internal/input"
+)
+
+// MemorySink records events in memory instead of sending them to the
+// kernel, for checking the translation without a uinput device
+type MemorySink struct {
+	Events []input.Event
+	Closed bool
+}
+
+// WriteEvents records the events
+func (ms *MemorySink) WriteEvents(events []input.Event) error {
+	if ms.Closed {
+		return fmt.Errorf("sink closed")
+	}
+	ms.Events = append(ms.Events, events...)
+	return nil
+}
+
+// Close marks the sink as closed
+func (ms *MemorySink) Close() error {
+	ms.Closed = true
+	return nil
+}
+
+// Reports splits the recorded events into groups ended by sync events
+func (ms *MemorySink) Reports() [][]input.Event {
+	var reports [][]input.Event
+	start := 0
+	for i, e := range ms.Events {
+		if e == input.Sync() {
+			reports = append(reports, ms.Events[start:i])
+			start = i + 1
+		}
+	}
+	return reports
+}
@@ -0,0 +1,132 @@
+//go:build linux
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"xp-pen-controller/internal/input"
+)
+
+// uinputPath is the device used to create virtual input devices
+const uinputPath = "/dev/uinput"
+
+// uinput ioctls, from linux/uinput.h
+const (
+	uinputIoctlType = 'U'
+	uiDevCreate     = 1
+	uiDevDestroy    = 2
+	uiDevSetup      = 3
+	uiAbsSetup      = 4
+	uiSetEvBit      = 100
+	uiSetKeyBit     = 101
+	uiSetAbsBit     = 103
+	uiSetPropBit    = 110
+
+	busVirtual = 0x06
+)
+
+// uinputSetup mirrors struct uinput_setup
+type uinputSetup struct {
+	Bustype, Vendor, Product, Version uint16
+	Name                              [80]byte
+	FFEffectsMax                      uint32
+}
+
+// uinputAbsSetup mirrors struct uinput_abs_setup
+type uinputAbsSetup struct {
+	Code uint16
+	_    uint16
+	Info input.AbsInfo
+}
+
+// UinputSink is a virtual pen tablet created through /dev/uinput
+type UinputSink struct {
+	f   *os.File
+	buf []byte
+}
+
+var _ Sink = (*UinputSink)(nil)
+
+// OpenUinput creates a virtual pen tablet with the given name and axes
+func OpenUinput(name string, axes Axes) (*UinputSink, error) {
+	f, err := os.OpenFile(uinputPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", uinputPath, err)
+	}
+	us := &UinputSink{f: f}
+	if err := us.setup(name, axes); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create virtual tablet: %w", err)
+	}
+
+	logger.Info("created virtual tablet", "name", name)
+	return us, nil
+}
+
+// setup declares the capabilities of the device and creates it
+func (us *UinputSink) setup(name string, axes Axes) error {
+	fd := us.f.Fd()
+	setBit := func(nr int, bit uintptr) error {
+		return input.Ioctl(fd, input.IOC(input.IocWrite, uinputIoctlType, nr, 4), bit)
+	}
+
+	for _, ev := range []uintptr{input.EvSyn, input.EvKey, input.EvAbs} {
+		if err := setBit(uiSetEvBit, ev); err != nil {
+			return err
+		}
+	}
+	for _, key := range []uintptr{input.BtnToolPen, input.BtnToolRubber, input.BtnTouch, input.BtnStylus, input.BtnStylus2} {
+		if err := setBit(uiSetKeyBit, key); err != nil {
+			return err
+		}
+	}
+	if err := setBit(uiSetPropBit, input.InputPropPointer); err != nil {
+		return err
+	}
+
+	abs := []uinputAbsSetup{
+		{Code: input.AbsX, Info: input.AbsInfo{Maximum: int32(axes.MaxX), Resolution: int32(axes.Resolution)}},
+		{Code: input.AbsY, Info: input.AbsInfo{Maximum: int32(axes.MaxY), Resolution: int32(axes.Resolution)}},
+		{Code: input.AbsPressure, Info: input.AbsInfo{Maximum: int32(axes.MaxPressure)}},
+	}
+	if axes.MaxTilt > 0 {
+		tilt := input.AbsInfo{Minimum: -int32(axes.MaxTilt), Maximum: int32(axes.MaxTilt), Resolution: 57} // Units per radian
+		abs = append(abs, uinputAbsSetup{Code: input.AbsTiltX, Info: tilt}, uinputAbsSetup{Code: input.AbsTiltY, Info: tilt})
+	}
+	for i := range abs {
+		if err := setBit(uiSetAbsBit, uintptr(abs[i].Code)); err != nil {
+			return err
+		}
+		req := input.IOC(input.IocWrite, uinputIoctlType, uiAbsSetup, int(unsafe.Sizeof(abs[i])))
+		if err := input.IoctlPtr(fd, req, unsafe.Pointer(&abs[i])); err != nil {
+			return err
+		}
+	}
+
+	setup := uinputSetup{Bustype: busVirtual, Version: 1}
+	copy(setup.Name[:len(setup.Name)-1], name)
+	req := input.IOC(input.IocWrite, uinputIoctlType, uiDevSetup, int(unsafe.Sizeof(setup)))
+	if err := input.IoctlPtr(fd, req, unsafe.Pointer(&setup)); err != nil {
+		return err
+	}
+	return input.Ioctl(fd, input.IOC(input.IocNone, uinputIoctlType, uiDevCreate, 0), 0)
+}
+
+// WriteEvents sends events to the kernel
+func (us *UinputSink) WriteEvents(events []input.Event) error {
+	us.buf = us.buf[:0]
+	for _, e := range events {
+		us.buf = input.Append(us.buf, e)
+	}
+	_, err := us.f.Write(us.buf)
+	return err
+}
+
+// Close removes the virtual tablet
+func (us *UinputSink) Close() error {
+	input.Ioctl(us.f.Fd(), input.IOC(input.IocNone, uinputIoctlType, uiDevDestroy, 0), 0)
+	return us.f.Close()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package driver
+
+import "fmt"
+
+// UinputSink is a virtual pen tablet, which is only available on Linux
+type UinputSink struct{ Sink }
+
+// OpenUinput creates a virtual pen tablet, which is only available on Linux
+func OpenUinput(name string, axes Axes) (*UinputSink, error) {
+	return nil, fmt.Errorf("virtual tablets are only available on Linux")
+}
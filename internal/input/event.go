@@ -0,0 +1,77 @@
+// Package input encodes and decodes Linux input events, as read from
+// /dev/input/event* devices and written to /dev/uinput.
+package input
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Event types and codes used by pen tablets, from linux/input-event-codes.h
+const (
+	EvSyn = 0x00
+	EvKey = 0x01
+	EvAbs = 0x03
+
+	SynReport  = 0x00
+	SynDropped = 0x03
+
+	AbsX        = 0x00
+	AbsY        = 0x01
+	AbsPressure = 0x18
+	AbsTiltX    = 0x1a
+	AbsTiltY    = 0x1b
+
+	BtnToolPen    = 0x140
+	BtnToolRubber = 0x141
+	BtnTouch      = 0x14a
+	BtnStylus     = 0x14b
+	BtnStylus2    = 0x14c
+
+	// InputPropPointer marks a device that moves an on-screen pointer,
+	// as opposed to a touchscreen
+	InputPropPointer = 0x00
+)
+
+// EventSize is the size of struct input_event: a struct timeval of two
+// longs followed by type, code and value
+var EventSize = 2*strconv.IntSize/8 + 8
+
+// Event is a single input event. The timestamp is left to the kernel.
+type Event struct {
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// Sync returns the event that ends a group of changes
+func Sync() Event {
+	return Event{Type: EvSyn, Code: SynReport}
+}
+
+// Read reads one event from r, using buf of EventSize bytes as scratch space
+func Read(r io.Reader, buf []byte) (Event, error) {
+	if _, err := io.ReadFull(r, buf[:EventSize]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Event{}, fmt.Errorf("failed to read input event: %w", err)
+	}
+
+	tail := buf[EventSize-8 : EventSize]
+	return Event{
+		Type:  binary.NativeEndian.Uint16(tail[0:]),
+		Code:  binary.NativeEndian.Uint16(tail[2:]),
+		Value: int32(binary.NativeEndian.Uint32(tail[4:])),
+	}, nil
+}
+
+// Append encodes the event with a zero timestamp and appends it to buf
+func Append(buf []byte, e Event) []byte {
+	buf = append(buf, make([]byte, EventSize-8)...)
+	buf = binary.NativeEndian.AppendUint16(buf, e.Type)
+	buf = binary.NativeEndian.AppendUint16(buf, e.Code)
+	return binary.NativeEndian.AppendUint32(buf, uint32(e.Value))
+}
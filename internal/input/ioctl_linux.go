@@ -0,0 +1,52 @@
+//go:build linux
+
+package input
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// ioctl directions, from asm-generic/ioctl.h
+const (
+	IocNone  = 0
+	IocWrite = 1
+	IocRead  = 2
+)
+
+// AbsInfo mirrors struct input_absinfo
+type AbsInfo struct {
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// AbsInfoSize is the size of struct input_absinfo
+const AbsInfoSize = int(unsafe.Sizeof(AbsInfo{}))
+
+// IOC builds an ioctl request number like the _IOC macro
+func IOC(dir int, typ byte, nr, size int) uintptr {
+	return uintptr(dir<<30 | size<<16 | int(typ)<<8 | nr)
+}
+
+// Ioctl performs an ioctl on a file descriptor
+func Ioctl(fd uintptr, req uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// IoctlPtr performs an ioctl whose argument points to a buffer
+func IoctlPtr(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	return Ioctl(fd, req, uintptr(arg))
+}
+
+// IoctlLen performs an ioctl whose argument points to a buffer and returns
+// its result, such as the number of bytes transferred
+func IoctlLen(fd uintptr, req uintptr, arg unsafe.Pointer) (int, error) {
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
@@ -0,0 +1,43 @@
+//go:build !race
+
+// The race detector allocates on its own, so allocations are only counted
+// without it
+
+package logging
+
+import (
+	"io"
+	"testing"
+)
+
+func TestHandleDoesNotAllocate(t *testing.T) {
+	if err := Setup(Options{Level: "debug", Console: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	logger := For("test").With("a", 1).WithGroup("g").With("b", 2)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("message")
+	})
+	if allocs > 0 {
+		t.Errorf("%v allocations per record", allocs)
+	}
+}
+
+func TestDisabledLevelDoesNotAllocate(t *testing.T) {
+	if err := Setup(Options{Level: "info,tablet=warn", Console: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	logger := For(Tablet).With("a", 1)
+	x, y := 1200, 900
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Debug("pen data", "x", x, "y", y, "penDown", true)
+		logger.Info("connected")
+	})
+	if allocs > 0 {
+		t.Errorf("%v allocations per disabled record", allocs)
+	}
+}
@@ -0,0 +1,301 @@
+// Package logging provides leveled, structured logging for the whiteboard.
+//
+// Every part of the application logs through a subsystem logger (tablet,
+// render, input, io). Levels can be set globally or per subsystem, e.g.
+// "info" or "warn,tablet=debug". Loggers are created once at package level
+// and pick up configuration changes made later by Setup.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Subsystem names
+const (
+	Tablet = "tablet" // HID communication and report decoding
+	Render = "render" // Drawing area and rasterization
+	Input  = "input"  // Pen and mouse input handling
+	IO     = "io"     // Loading, saving and exporting
+	Net    = "net"    // Web mirror and other network services
+)
+
+// Environment variables read by SetupFromEnv
+const (
+	LevelEnv = "SCRAWL_LOG_LEVEL" // Level spec, e.g. "info,tablet=debug"
+	FileEnv  = "SCRAWL_LOG_FILE"  // Path of an optional JSON log file
+)
+
+// DefaultLevel is used for subsystems without an explicit level
+const DefaultLevel = slog.LevelInfo
+
+// Options configures logging output
+type Options struct {
+	Level    string    // Level spec, e.g. "info" or "warn,render=debug"
+	JSONFile string    // Optional path; when set, records are also written there as JSON
+	Console  io.Writer // Text output, defaults to stderr
+}
+
+var (
+	mu      sync.Mutex
+	levels  = map[string]*slog.LevelVar{}
+	logFile *os.File
+	global  = new(slog.LevelVar) // Level for subsystems without their own level
+	current atomic.Pointer[output]
+)
+
+// output is the handler configured by Setup. Every Setup stores a new one,
+// so its address tells loggers when their cached handler is stale.
+type output struct {
+	handler slog.Handler
+}
+
+func init() {
+	global.Set(DefaultLevel)
+	current.Store(&output{stderrHandler()})
+}
+
+// stderrHandler is the output before Setup and after Close
+func stderrHandler() slog.Handler {
+	return slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+// For returns the logger for a subsystem. Records below the subsystem's
+// level are discarded before any attributes are formatted, so guarded debug
+// logging in hot paths costs a single atomic load when disabled.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{
+		subsystem: subsystem,
+		level:     levelFor(subsystem),
+	}).With(slog.String("subsystem", subsystem))
+}
+
+// Setup configures levels and outputs for all subsystem loggers
+func Setup(opts Options) error {
+	defaultLevel, subsystemLevels, err := ParseLevelSpec(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	console := opts.Console
+	if console == nil {
+		console = os.Stderr
+	}
+
+	// Levels are filtered per subsystem, so the handlers accept everything
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler = slog.NewTextHandler(console, handlerOpts)
+
+	var file *os.File
+	if opts.JSONFile != "" {
+		file, err = os.OpenFile(opts.JSONFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		h = teeHandler{h, slog.NewJSONHandler(file, handlerOpts)}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	current.Store(&output{h})
+
+	global.Set(defaultLevel)
+	for name, level := range levels {
+		if l, ok := subsystemLevels[name]; ok {
+			level.Set(l)
+		} else {
+			level.Set(defaultLevel)
+		}
+	}
+	for name, l := range subsystemLevels {
+		if _, ok := levels[name]; !ok {
+			lv := new(slog.LevelVar)
+			lv.Set(l)
+			levels[name] = lv
+		}
+	}
+
+	slog.SetDefault(slog.New(&subsystemHandler{level: global}))
+	return nil
+}
+
+// SetupFromEnv configures logging from SCRAWL_LOG_LEVEL and SCRAWL_LOG_FILE.
+// Non-empty arguments take precedence over the environment.
+func SetupFromEnv(level, jsonFile string) error {
+	if level == "" {
+		level = os.Getenv(LevelEnv)
+	}
+	if jsonFile == "" {
+		jsonFile = os.Getenv(FileEnv)
+	}
+	return Setup(Options{Level: level, JSONFile: jsonFile})
+}
+
+// ParseLevelSpec parses a level spec such as "info" or "warn,tablet=debug"
+// into a default level and per-subsystem overrides
+func ParseLevelSpec(spec string) (slog.Level, map[string]slog.Level, error) {
+	defaultLevel := DefaultLevel
+	subsystems := map[string]slog.Level{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, hasName := strings.Cut(part, "=")
+		if !hasName {
+			value = name
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+			return 0, nil, fmt.Errorf("invalid log level %q", value)
+		}
+
+		if hasName {
+			subsystems[strings.TrimSpace(name)] = level
+		} else {
+			defaultLevel = level
+		}
+	}
+
+	return defaultLevel, subsystems, nil
+}
+
+// Close flushes and closes the JSON log file, if any
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logFile == nil {
+		return nil
+	}
+	err := logFile.Close()
+	logFile = nil
+	current.Store(&output{stderrHandler()})
+	return err
+}
+
+// levelFor returns the level variable of a subsystem, creating it if needed
+func levelFor(subsystem string) *slog.LevelVar {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if level, ok := levels[subsystem]; ok {
+		return level
+	}
+	level := new(slog.LevelVar)
+	level.Set(global.Level())
+	levels[subsystem] = level
+	return level
+}
+
+// subsystemHandler filters records by the subsystem level and forwards them
+// to the current output handler. Attributes and groups are kept in the
+// order they were added and applied to the output handler once per Setup,
+// not once per record.
+type subsystemHandler struct {
+	subsystem string
+	level     *slog.LevelVar
+	ops       []handlerOp
+	wrapped   atomic.Pointer[wrappedOutput]
+}
+
+// handlerOp is one WithAttrs or WithGroup call
+type handlerOp struct {
+	attrs []slog.Attr
+	group string // Used when attrs is nil
+}
+
+// wrappedOutput is an output handler with the attributes and groups applied
+type wrappedOutput struct {
+	base    *output
+	handler slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.output().Handle(ctx, record)
+}
+
+// output returns the current output handler with the attributes and groups
+// applied, building it only when Setup has replaced the output
+func (h *subsystemHandler) output() slog.Handler {
+	base := current.Load()
+	if w := h.wrapped.Load(); w != nil && w.base == base {
+		return w.handler
+	}
+
+	out := base.handler
+	for _, op := range h.ops {
+		if op.attrs != nil {
+			out = out.WithAttrs(op.attrs)
+		} else {
+			out = out.WithGroup(op.group)
+		}
+	}
+	h.wrapped.Store(&wrappedOutput{base, out})
+	return out
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(handlerOp{attrs: attrs})
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(handlerOp{group: name})
+}
+
+// with returns a copy of the handler with one more operation
+func (h *subsystemHandler) with(op handlerOp) *subsystemHandler {
+	return &subsystemHandler{
+		subsystem: h.subsystem,
+		level:     h.level,
+		ops:       append(h.ops[:len(h.ops):len(h.ops)], op),
+	}
+}
+
+// teeHandler sends every record to two handlers
+type teeHandler [2]slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return t[0].Enabled(ctx, level) || t[1].Enabled(ctx, level)
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	err0 := t[0].Handle(ctx, record.Clone())
+	err1 := t[1].Handle(ctx, record)
+	if err0 != nil {
+		return err0
+	}
+	return err1
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{t[0].WithAttrs(attrs), t[1].WithAttrs(attrs)}
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{t[0].WithGroup(name), t[1].WithGroup(name)}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// setupBuffer sends text output to a buffer for the rest of the test
+func setupBuffer(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Setup(Options{Level: level, Console: &buf}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	return &buf
+}
+
+func TestAttrsAndGroupsKeepTheirOrder(t *testing.T) {
+	buf := setupBuffer(t, "debug")
+
+	For("test").With("a", 1).WithGroup("g").With("b", 2).Info("message", "c", 3)
+
+	line := buf.String()
+	want := "subsystem=test a=1 g.b=2 g.c=3"
+	if !strings.Contains(line, want) {
+		t.Errorf("got %q, want it to contain %q", line, want)
+	}
+}
+
+func TestOutputIsWrappedOncePerSetup(t *testing.T) {
+	setupBuffer(t, "debug")
+	logger := For("test").With("a", 1).WithGroup("g")
+	h := logger.Handler().(*subsystemHandler)
+
+	logger.Info("first")
+	first := h.wrapped.Load()
+	logger.Info("second")
+	if h.wrapped.Load() != first {
+		t.Error("the output handler was wrapped again without a new Setup")
+	}
+
+	buf := setupBuffer(t, "debug")
+	logger.Info("third")
+	if h.wrapped.Load() == first {
+		t.Error("the output handler was not rebuilt after Setup")
+	}
+	if !strings.Contains(buf.String(), "a=1") {
+		t.Errorf("record %q did not reach the new output", buf.String())
+	}
+}
+
+func TestSubsystemLevels(t *testing.T) {
+	buf := setupBuffer(t, "warn,tablet=debug")
+
+	For(Tablet).Debug("shown")
+	For(Render).Info("hidden")
+	For(Render).Warn("also shown")
+
+	out := buf.String()
+	if !strings.Contains(out, "shown") || !strings.Contains(out, "also shown") || strings.Contains(out, "hidden") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestParseLevelSpec(t *testing.T) {
+	level, subsystems, err := ParseLevelSpec(" warn , tablet=debug,render = error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != slog.LevelWarn || subsystems[Tablet] != slog.LevelDebug || subsystems[Render] != slog.LevelError {
+		t.Errorf("got %v %v", level, subsystems)
+	}
+
+	if _, _, err := ParseLevelSpec("loud"); err == nil {
+		t.Error("an unknown level was accepted")
+	}
+}
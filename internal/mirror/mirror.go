@@ -0,0 +1,248 @@
+// Package mirror serves a live, read-only view of a whiteboard to web
+// browsers.
+//
+// The page at / draws the board in vector form from a stream of
+// Server-Sent Events at /events. A browser that connects mid-session first
+// receives a snapshot of the board and then every change as it happens.
+//
+// For streaming tools such as OBS, /snapshot.png serves the board as an
+// image and /stream.mjpeg as a motion JPEG stream. Both take width, height,
+// transparent and crop query parameters, and the stream also takes fps.
+package mirror
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/logging"
+)
+
+var logger = logging.For(logging.Net)
+
+// clientBuffer is the number of messages queued for a browser. A browser
+// that falls further behind is dropped; it reconnects and resyncs from a
+// snapshot.
+const clientBuffer = 4096
+
+// keepAliveInterval is how often an idle stream sends a comment so that
+// proxies do not close it
+const keepAliveInterval = 15 * time.Second
+
+//go:embed index.html
+var indexHTML []byte
+
+// Server mirrors a canvas to any number of browsers. It is an http.Handler.
+type Server struct {
+	canvas *drawing.Canvas
+	mux    *http.ServeMux
+
+	mu      sync.Mutex
+	clients map[chan message]struct{}
+
+	version atomic.Uint64 // Counts changes to the canvas
+	cache   frameCache
+}
+
+// NewServer creates a mirror of the canvas
+func NewServer(c *drawing.Canvas) *Server {
+	s := &Server{
+		canvas:  c,
+		mux:     http.NewServeMux(),
+		clients: make(map[chan message]struct{}),
+	}
+	s.mux.HandleFunc("GET /{$}", s.serveIndex)
+	s.mux.HandleFunc("GET /events", s.serveEvents)
+	s.mux.HandleFunc("GET /snapshot.png", s.serveSnapshot)
+	s.mux.HandleFunc("GET /stream.mjpeg", s.serveStream)
+
+	c.Lock()
+	c.Observe(s.observe)
+	c.Unlock()
+	return s
+}
+
+// ServeHTTP serves the page, the event stream and the images
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Clients returns the number of connected browsers
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// serveIndex serves the page that renders the board
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// serveEvents streams the snapshot and all following changes
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Taking the snapshot and subscribing under the canvas lock makes sure
+	// no change falls between the two
+	events := make(chan message, clientBuffer)
+	s.canvas.Lock()
+	first := snapshot(s.canvas)
+	s.mu.Lock()
+	s.clients[events] = struct{}{}
+	s.mu.Unlock()
+	s.canvas.Unlock()
+
+	defer s.unsubscribe(events)
+	logger.Info("mirror client connected", "remote", r.RemoteAddr, "clients", s.Clients())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := writeEvent(w, first); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logger.Info("mirror client disconnected", "remote", r.RemoteAddr)
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case msg, ok := <-events:
+			if !ok {
+				logger.Warn("mirror client fell behind, dropping it", "remote", r.RemoteAddr)
+				return
+			}
+			for _, msg := range coalesce(msg, events) {
+				if err := writeEvent(w, msg); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// unsubscribe stops sending events to a browser
+func (s *Server) unsubscribe(events chan message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[events]; ok {
+		delete(s.clients, events)
+		close(events)
+	}
+}
+
+// observe turns canvas changes into messages. It runs with the canvas lock
+// held, so it only queues them.
+func (s *Server) observe(event drawing.Event) {
+	s.version.Add(1)
+
+	var msg message
+	switch event.Kind {
+	case drawing.EventBegin:
+		stroke := toWire(event.Stroke)
+		msg = message{Type: typeBegin, Stroke: &stroke}
+	case drawing.EventPoint:
+		msg = message{Type: typePoints, Points: [][3]float64{lastPoint(event.Stroke)}}
+	case drawing.EventEnd:
+		// The final widths can differ from the live ones, so the whole
+		// stroke is sent again
+		stroke := toWire(event.Stroke)
+		msg = message{Type: typeEnd, Stroke: &stroke}
+	case drawing.EventClear:
+		msg = message{Type: typeClear}
+	case drawing.EventUndo:
+		msg = message{Type: typeUndo, Index: event.Index}
+	case drawing.EventRedo, drawing.EventAdd:
+		stroke := toWire(event.Stroke)
+		msg = message{Type: typeRedo, Stroke: &stroke}
+	case drawing.EventReplace, drawing.EventResize:
+		msg = snapshot(s.canvas)
+	default:
+		return
+	}
+	s.broadcast(msg)
+}
+
+// broadcast queues a message for every browser, dropping those whose queue
+// is full
+func (s *Server) broadcast(msg message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for events := range s.clients {
+		select {
+		case events <- msg:
+		default:
+			delete(s.clients, events)
+			close(events)
+		}
+	}
+}
+
+// coalesce merges the queued messages after msg, joining runs of points
+// into a single message so a slow browser catches up in fewer writes
+func coalesce(msg message, events chan message) []message {
+	batch := []message{msg}
+	for {
+		select {
+		case next, ok := <-events:
+			if !ok {
+				return batch
+			}
+			last := &batch[len(batch)-1]
+			if next.Type == typePoints && last.Type == typePoints {
+				last.Points = append(last.Points, next.Points...)
+			} else {
+				batch = append(batch, next)
+			}
+		default:
+			return batch
+		}
+	}
+}
+
+// writeEvent writes a message as a Server-Sent Event
+func writeEvent(w http.ResponseWriter, msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Serve serves the mirror on the listener until it fails
+func (s *Server) Serve(listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("mirror server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// drawStroke draws a finished stroke through the points
+func drawStroke(c *drawing.Canvas, points ...drawing.Point) {
+	c.Lock()
+	defer c.Unlock()
+	c.StartStroke(points[0])
+	for _, p := range points[1:] {
+		c.AddPointToCurrentStroke(p)
+	}
+	c.FinishStroke()
+}
+
+// eventReader reads the messages of a Server-Sent Events stream
+type eventReader struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+}
+
+// openEvents connects to the event stream of the server. The stream is
+// closed before the server when the test ends.
+func openEvents(t *testing.T, url string) *eventReader {
+	t.Helper()
+	resp, err := http.Get(url + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	return &eventReader{t: t, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the next message, skipping comments
+func (er *eventReader) next() message {
+	er.t.Helper()
+	for er.scanner.Scan() {
+		data, ok := strings.CutPrefix(er.scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			er.t.Fatalf("invalid event %q: %v", data, err)
+		}
+		return msg
+	}
+	er.t.Fatalf("stream ended: %v", er.scanner.Err())
+	return message{}
+}
+
+func TestEventsSendSnapshotThenChanges(t *testing.T) {
+	c := drawing.NewCanvas(800, 600)
+	drawStroke(c, drawing.Point{X: 10, Y: 10, Pressure: 0.5}, drawing.Point{X: 20, Y: 20, Pressure: 0.5})
+
+	server := NewServer(c)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	events := openEvents(t, ts.URL)
+
+	first := events.next()
+	if first.Type != typeSnapshot || first.Width != 800 || first.Height != 600 || len(first.Strokes) != 1 {
+		t.Fatalf("first message %+v, want a snapshot with one stroke", first)
+	}
+	if len(first.Strokes[0].Points) != 2 {
+		t.Errorf("snapshot stroke has %d points, want 2", len(first.Strokes[0].Points))
+	}
+
+	drawStroke(c,
+		drawing.Point{X: 100, Y: 100, Pressure: 0.5},
+		drawing.Point{X: 110, Y: 100, Pressure: 0.6},
+		drawing.Point{X: 120, Y: 100, Pressure: 0.7},
+	)
+	c.Lock()
+	c.Undo()
+	c.Clear()
+	c.Unlock()
+
+	// Runs of points may arrive merged into one message
+	var types []string
+	points := 0
+	for {
+		msg := events.next()
+		if msg.Type == typePoints {
+			points += len(msg.Points)
+			if types[len(types)-1] == typePoints {
+				continue
+			}
+		}
+		types = append(types, msg.Type)
+
+		switch msg.Type {
+		case typeBegin:
+			if msg.Stroke == nil || len(msg.Stroke.Points) != 1 || msg.Stroke.Points[0][0] != 100 {
+				t.Errorf("begin %+v does not start at the first point", msg.Stroke)
+			}
+		case typeEnd:
+			if msg.Stroke == nil || len(msg.Stroke.Points) != 3 {
+				t.Errorf("end %+v does not carry the whole stroke", msg.Stroke)
+			}
+		case typeUndo:
+			if msg.Index != 1 {
+				t.Errorf("undo of stroke %d, want 1", msg.Index)
+			}
+		}
+		if msg.Type == typeClear {
+			break
+		}
+	}
+
+	want := []string{typeBegin, typePoints, typeEnd, typeUndo, typeClear}
+	if strings.Join(types, " ") != strings.Join(want, " ") {
+		t.Errorf("messages %v, want %v", types, want)
+	}
+	if points != 2 {
+		t.Errorf("%d points streamed, want 2", points)
+	}
+}
+
+func TestEventsSnapshotIncludesCurrentStroke(t *testing.T) {
+	c := drawing.NewCanvas(800, 600)
+	c.Lock()
+	c.StartStroke(drawing.Point{X: 50, Y: 50, Pressure: 0.5})
+	c.AddPointToCurrentStroke(drawing.Point{X: 60, Y: 50, Pressure: 0.5})
+	c.Unlock()
+
+	ts := httptest.NewServer(NewServer(c))
+	t.Cleanup(ts.Close)
+	first := openEvents(t, ts.URL).next()
+	if first.Type != typeSnapshot || first.Current == nil || len(first.Current.Points) != 2 {
+		t.Errorf("snapshot %+v does not include the stroke being drawn", first)
+	}
+}
+
+func TestEventsClientIsRemovedOnDisconnect(t *testing.T) {
+	c := drawing.NewCanvas(800, 600)
+	server := NewServer(c)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Clients() != 1 {
+		t.Errorf("%d clients, want 1", server.Clients())
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Clients() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client still subscribed after disconnecting")
+		}
+		// A change makes the server notice the closed connection
+		drawStroke(c, drawing.Point{X: 1, Y: 1, Pressure: 0.5})
+		time.Sleep(10 * time.Millisecond)
+	}
+}
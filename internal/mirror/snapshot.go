@@ -0,0 +1,310 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"xp-pen-controller/internal/render"
+)
+
+// Limits of the snapshot endpoints
+const (
+	defaultStreamRate = 10
+	maxStreamRate     = 60
+	maxImageSize      = 8192
+
+	// maxImageScale bounds the pixels of an image to this many times those
+	// of the canvas, however the size was asked for
+	maxImageScale = 4
+
+	// jpegQuality balances sharp lines against stream bandwidth
+	jpegQuality = 85
+
+	// streamRepeat is how often an unchanged stream repeats its frame, for
+	// clients that give up on a silent stream
+	streamRepeat = time.Second
+
+	// maxCachedFrames bounds the number of encoded variants kept
+	maxCachedFrames = 16
+)
+
+// Image formats
+const (
+	formatPNG  = "png"
+	formatJPEG = "jpeg"
+)
+
+// frameKey identifies one way of rendering the board
+type frameKey struct {
+	format string
+	opts   render.SnapshotOptions
+}
+
+// encodedFrame is a rendered and encoded board
+type encodedFrame struct {
+	version uint64
+	data    []byte
+}
+
+// errTooLarge reports an image size beyond maxImageScale
+var errTooLarge = errors.New("image too large")
+
+// frameCache keeps the last encoding of every variant, so that any number
+// of viewers cost one encode per change
+type frameCache struct {
+	mu     sync.Mutex
+	frames map[frameKey]*cachedFrame
+	uses   uint64 // Counts lookups, to find the least recently used variant
+}
+
+// cachedFrame is a cache entry and when it was last used
+type cachedFrame struct {
+	frame *encodedFrame
+	used  uint64
+}
+
+// get returns the last encoding of a variant, or nil
+func (fc *frameCache) get(key frameKey) *encodedFrame {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry := fc.frames[key]
+	if entry == nil {
+		return nil
+	}
+	fc.uses++
+	entry.used = fc.uses
+	return entry.frame
+}
+
+// put stores the encoding of a variant. When the cache is full it forgets
+// the variant used least recently, so that a client trying many sizes
+// cannot flush the frames every other viewer is using.
+func (fc *frameCache) put(key frameKey, frame *encodedFrame) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.frames == nil {
+		fc.frames = make(map[frameKey]*cachedFrame)
+	}
+	if _, ok := fc.frames[key]; !ok && len(fc.frames) >= maxCachedFrames {
+		var oldest frameKey
+		var oldestUse uint64
+		for k, entry := range fc.frames {
+			if oldestUse == 0 || entry.used < oldestUse {
+				oldest, oldestUse = k, entry.used
+			}
+		}
+		delete(fc.frames, oldest)
+	}
+	fc.uses++
+	fc.frames[key] = &cachedFrame{frame: frame, used: fc.uses}
+}
+
+// frame returns the board encoded as asked, encoding it only if it changed
+// since the last time
+func (s *Server) frame(key frameKey) (*encodedFrame, error) {
+	if cached := s.cache.get(key); cached != nil && cached.version == s.version.Load() {
+		return cached, nil
+	}
+
+	// Rendering a copy keeps the pen responsive
+	s.canvas.Lock()
+	version := s.version.Load()
+	board := s.canvas.Copy()
+	s.canvas.Unlock()
+
+	// Cropping decides the size too, so it is only known now
+	width, height := render.SnapshotSize(board, key.opts)
+	limit := maxImageScale * math.Ceil(board.Width) * math.Ceil(board.Height)
+	if float64(width)*float64(height) > limit {
+		return nil, fmt.Errorf("%w: %dx%d is more than %d times the board", errTooLarge, width, height, maxImageScale)
+	}
+
+	img := render.Snapshot(board, key.opts)
+	var buf bytes.Buffer
+	var err error
+	if key.format == formatJPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	frame := &encodedFrame{version: version, data: buf.Bytes()}
+	s.cache.put(key, frame)
+	return frame, nil
+}
+
+// frameError answers a request whose frame could not be made
+func frameError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Error("snapshot failed", "err", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseSnapshotOptions reads width, height, transparent and crop from the
+// query
+func parseSnapshotOptions(r *http.Request) (render.SnapshotOptions, error) {
+	var opts render.SnapshotOptions
+	var err error
+	query := r.URL.Query()
+	if opts.Width, err = queryInt(query.Get("width"), 0, maxImageSize); err != nil {
+		return opts, fmt.Errorf("width: %w", err)
+	}
+	if opts.Height, err = queryInt(query.Get("height"), 0, maxImageSize); err != nil {
+		return opts, fmt.Errorf("height: %w", err)
+	}
+	if opts.Transparent, err = queryBool(query.Get("transparent")); err != nil {
+		return opts, fmt.Errorf("transparent: %w", err)
+	}
+	if opts.Crop, err = queryBool(query.Get("crop")); err != nil {
+		return opts, fmt.Errorf("crop: %w", err)
+	}
+	return opts, nil
+}
+
+// queryInt parses an optional number within a range
+func queryInt(value string, min, max int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("expected a number from %d to %d", min, max)
+	}
+	return n, nil
+}
+
+// queryBool parses an optional flag such as "1" or "true"
+func queryBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("expected true or false")
+	}
+	return b, nil
+}
+
+// serveSnapshot serves the board as a PNG image
+func (s *Server) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseSnapshotOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The version tells a polling client that nothing changed, without
+	// even looking for the image
+	w.Header().Set("Cache-Control", "no-cache")
+	if etag := versionTag(s.version.Load()); r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	frame, err := s.frame(frameKey{format: formatPNG, opts: opts})
+	if err != nil {
+		frameError(w, err)
+		return
+	}
+	w.Header().Set("ETag", versionTag(frame.version))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(frame.data)))
+	w.Write(frame.data)
+}
+
+// versionTag is the ETag of a version of the board
+func versionTag(version uint64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// serveStream serves the board as a motion JPEG stream, or a stream of PNG
+// images if it is transparent, sending a frame whenever the board changes
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	opts, err := parseSnapshotOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate, err := queryInt(r.URL.Query().Get("fps"), 1, maxStreamRate)
+	if err != nil {
+		http.Error(w, "fps: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rate == 0 {
+		rate = defaultStreamRate
+	}
+
+	// JPEG has no alpha channel
+	key := frameKey{format: formatJPEG, opts: opts}
+	contentType := "image/jpeg"
+	if opts.Transparent {
+		key.format = formatPNG
+		contentType = "image/png"
+	}
+
+	parts := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+parts.Boundary())
+	w.Header().Set("Cache-Control", "no-cache")
+	logger.Info("stream client connected", "remote", r.RemoteAddr, "fps", rate, "format", key.format)
+
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+	var sent uint64
+	var lastSent time.Time
+	for first := true; ; first = false {
+		if !first {
+			select {
+			case <-r.Context().Done():
+				logger.Info("stream client disconnected", "remote", r.RemoteAddr)
+				return
+			case <-ticker.C:
+			}
+		}
+
+		if !first && s.version.Load() == sent && time.Since(lastSent) < streamRepeat {
+			continue
+		}
+		frame, err := s.frame(key)
+		if err != nil {
+			if first {
+				frameError(w, err)
+			} else {
+				logger.Error("stream frame failed", "err", err)
+			}
+			return
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", strconv.Itoa(len(frame.data)))
+		part, err := parts.CreatePart(header)
+		if err != nil {
+			return
+		}
+		if _, err := part.Write(frame.data); err != nil {
+			return
+		}
+		flusher.Flush()
+		sent, lastSent = frame.version, time.Now()
+	}
+}
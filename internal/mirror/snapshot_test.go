@@ -0,0 +1,118 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/render"
+)
+
+// getSnapshot fetches the snapshot, optionally only if it changed
+func getSnapshot(t *testing.T, url, etag string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestSnapshotNotModified(t *testing.T) {
+	c := drawing.NewCanvas(800, 600)
+	drawStroke(c, drawing.Point{X: 10, Y: 10, Pressure: 0.5}, drawing.Point{X: 20, Y: 20, Pressure: 0.5})
+	server := NewServer(c)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	url := ts.URL + "/snapshot.png"
+
+	resp, body := getSnapshot(t, url, "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" || len(body) == 0 {
+		t.Fatalf("status %d, ETag %q, %d bytes", resp.StatusCode, etag, len(body))
+	}
+	key := frameKey{format: formatPNG}
+	encoded := server.cache.get(key)
+
+	resp, body = getSnapshot(t, url, etag)
+	if resp.StatusCode != http.StatusNotModified || len(body) != 0 || resp.Header.Get("ETag") != etag {
+		t.Errorf("unchanged board: status %d, ETag %q, %d bytes", resp.StatusCode, resp.Header.Get("ETag"), len(body))
+	}
+	// Another viewer without the ETag gets the frame encoded before
+	if resp, _ := getSnapshot(t, url, ""); resp.StatusCode != http.StatusOK || server.cache.get(key) != encoded {
+		t.Error("the unchanged board was encoded again")
+	}
+
+	drawStroke(c, drawing.Point{X: 30, Y: 30, Pressure: 0.5})
+	resp, _ = getSnapshot(t, url, etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("changed board: status %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if server.cache.get(key) == encoded {
+		t.Error("the changed board was not encoded again")
+	}
+}
+
+func TestSnapshotSizeIsCapped(t *testing.T) {
+	c := drawing.NewCanvas(800, 600)
+	// A tall, narrow drawing: cropped to it at full width it gets very high
+	drawStroke(c, drawing.Point{X: 400, Y: 10, Pressure: 0.5}, drawing.Point{X: 400, Y: 590, Pressure: 0.5})
+	ts := httptest.NewServer(NewServer(c))
+	t.Cleanup(ts.Close)
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"width=1600&height=1200", http.StatusOK},
+		{"width=8192&height=8192", http.StatusBadRequest},
+		{"width=8192&crop=1", http.StatusBadRequest},
+		{"width=9000", http.StatusBadRequest},
+	} {
+		for _, path := range []string{"/snapshot.png", "/stream.mjpeg"} {
+			if tc.want == http.StatusOK && path == "/stream.mjpeg" {
+				continue // The stream does not end
+			}
+			resp, _ := getSnapshot(t, ts.URL+path+"?"+tc.query, "")
+			if resp.StatusCode != tc.want {
+				t.Errorf("%s?%s: status %d, want %d", path, tc.query, resp.StatusCode, tc.want)
+			}
+		}
+	}
+}
+
+func TestFrameCacheKeepsRecentlyUsedFrames(t *testing.T) {
+	var cache frameCache
+	busy := frameKey{format: formatJPEG}
+	cache.put(busy, &encodedFrame{})
+
+	// A client trying every size only pushes out its own variants
+	for width := 1; width <= 2*maxCachedFrames; width++ {
+		cache.get(busy)
+		cache.put(frameKey{format: formatPNG, opts: render.SnapshotOptions{Width: width}}, &encodedFrame{})
+	}
+	if cache.get(busy) == nil {
+		t.Error("the variant in use was evicted")
+	}
+	if n := len(cache.frames); n > maxCachedFrames {
+		t.Errorf("%d frames cached, want at most %d", n, maxCachedFrames)
+	}
+	last := frameKey{format: formatPNG, opts: render.SnapshotOptions{Width: 2 * maxCachedFrames}}
+	if cache.get(last) == nil {
+		t.Errorf("the newest variant %v was evicted", last.opts)
+	}
+}
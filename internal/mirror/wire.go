@@ -0,0 +1,84 @@
+package mirror
+
+import (
+	"fmt"
+	"image/color"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// message is one event sent to the browsers. Points are [x, y, width] in
+// canvas units, so browsers need no knowledge of brushes.
+type message struct {
+	Type       string       `json:"type"`
+	Width      float64      `json:"width,omitempty"`      // snapshot
+	Height     float64      `json:"height,omitempty"`     // snapshot
+	Background string       `json:"background,omitempty"` // snapshot
+	Strokes    []wireStroke `json:"strokes,omitempty"`    // snapshot
+	Current    *wireStroke  `json:"current,omitempty"`    // snapshot
+	Stroke     *wireStroke  `json:"stroke,omitempty"`     // begin, end, redo
+	Points     [][3]float64 `json:"points,omitempty"`     // points
+	Index      int          `json:"index,omitempty"`      // undo
+}
+
+// wireStroke is a stroke as sent to the browsers
+type wireStroke struct {
+	Color  string       `json:"color"`
+	Points [][3]float64 `json:"points"`
+}
+
+// Message types
+const (
+	typeSnapshot = "snapshot"
+	typeBegin    = "begin"
+	typePoints   = "points"
+	typeEnd      = "end"
+	typeClear    = "clear"
+	typeUndo     = "undo"
+	typeRedo     = "redo" // Also strokes added by other users
+)
+
+// snapshot describes the whole canvas for a browser that just connected.
+// The canvas lock must be held.
+func snapshot(c *drawing.Canvas) message {
+	msg := message{
+		Type:       typeSnapshot,
+		Width:      c.Width,
+		Height:     c.Height,
+		Background: cssColor(c.Background),
+		Strokes:    make([]wireStroke, 0, len(c.Strokes)),
+	}
+	for _, stroke := range c.Strokes {
+		msg.Strokes = append(msg.Strokes, toWire(stroke))
+	}
+	if c.CurrentStroke != nil && !c.CurrentStroke.IsEmpty() {
+		current := toWire(c.CurrentStroke)
+		msg.Current = &current
+	}
+	return msg
+}
+
+// toWire converts a stroke with the width of every point
+func toWire(stroke *drawing.Stroke) wireStroke {
+	ws := wireStroke{
+		Color:  cssColor(stroke.Color),
+		Points: make([][3]float64, len(stroke.Points)),
+	}
+	for i, p := range stroke.Points {
+		ws.Points[i] = [3]float64{p.X, p.Y, stroke.WidthAt(i)}
+	}
+	return ws
+}
+
+// lastPoint converts the newest point of a stroke
+func lastPoint(stroke *drawing.Stroke) [3]float64 {
+	i := len(stroke.Points) - 1
+	p := stroke.Points[i]
+	return [3]float64{p.X, p.Y, stroke.WidthAt(i)}
+}
+
+// cssColor formats a colour for the browser
+func cssColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3f)", n.R, n.G, n.B, float64(n.A)/0xff)
+}
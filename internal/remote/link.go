@@ -0,0 +1,123 @@
+package remote
+
+import (
+	"sync"
+	"time"
+)
+
+// pingInterval is how often each end measures the round trip
+const pingInterval = time.Second
+
+// Stats describe the quality of a remote pen link
+type Stats struct {
+	Samples   uint64        // Samples sent or received
+	Lost      uint64        // Samples that never arrived, as far as the receiver can tell
+	RoundTrip time.Duration // Smoothed time for a ping and its answer, 0 until measured
+	Delay     time.Duration // Smoothed time from reading a sample to receiving it; receiver only
+}
+
+// link keeps the measurements of a connection. It is safe for concurrent
+// use.
+type link struct {
+	clock clock
+
+	mu       sync.Mutex
+	stats    Stats
+	offset   int64 // Remote clock minus local clock
+	synced   bool  // Whether offset was measured
+	lastPing int64
+}
+
+// newLink creates the measurements for a new connection
+func newLink() *link {
+	return &link{clock: newClock()}
+}
+
+// pingDue reports whether it is time to send another ping
+func (l *link) pingDue(now int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lastPing != 0 && now-l.lastPing < int64(pingInterval) {
+		return false
+	}
+	l.lastPing = now
+	return true
+}
+
+// pong records the answer to a ping sent at origin, which the other end
+// answered when its clock read remote
+func (l *link) pong(origin, remote, now int64) {
+	rtt := now - origin
+	if rtt < 0 {
+		return
+	}
+
+	// Assuming the answer took as long as the ping, the other end read its
+	// clock halfway through the round trip
+	offset := remote - (origin+now)/2
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.synced {
+		l.stats.RoundTrip = time.Duration(rtt)
+		l.offset = offset
+		l.synced = true
+		return
+	}
+	l.stats.RoundTrip = smooth(l.stats.RoundTrip, time.Duration(rtt))
+	l.offset += (offset - l.offset) / 8
+}
+
+// localTime converts a reading of the remote clock to local time, or
+// returns false if the clocks were not compared yet
+func (l *link) localTime(remote int64) (int64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return remote - l.offset, l.synced
+}
+
+// received counts a sample that arrived after lost others, and how long it
+// took if the clocks were compared
+func (l *link) received(lost uint64, delay time.Duration, measured bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Samples++
+	l.stats.Lost += lost
+	if measured {
+		if l.stats.Delay == 0 {
+			l.stats.Delay = delay
+		} else {
+			l.stats.Delay = smooth(l.stats.Delay, delay)
+		}
+	}
+}
+
+// sent counts a sample sent
+func (l *link) sent() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Samples++
+}
+
+// reset forgets all measurements, e.g. when a different sender appears
+func (l *link) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats = Stats{}
+	l.offset = 0
+	l.synced = false
+	l.lastPing = 0
+}
+
+// Stats returns the current measurements
+func (l *link) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// smooth moves an average an eighth of the way towards a new value, like
+// TCP's round-trip estimate
+func smooth(average, value time.Duration) time.Duration {
+	return average + (value-average)/8
+}
@@ -0,0 +1,304 @@
+// Package remote streams pen samples from a tablet on one machine to a
+// whiteboard on another.
+//
+// Samples travel as UDP datagrams. Each one carries the whole pen state, so
+// a lost datagram costs one point and never a stuck button: a change of
+// proximity or contact is sent several times, the sender repeats the last
+// state while the pen is near the tablet, and the receiver lifts the pen if
+// the sender goes quiet. Both ends exchange pings to measure the round trip
+// and to map the sender's timestamps onto the receiver's clock.
+//
+// With a shared token, every packet ends in an HMAC of its contents, and
+// the receiver ignores packets without a valid one. Without a token the
+// receiver only listens on a loopback address.
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// Positions and pressure are sent normalized to these ranges, so the
+// receiver needs no knowledge of the tablet
+const (
+	MaxPosition = 1<<20 - 1
+	MaxPressure = 1<<16 - 1
+)
+
+// DefaultPort is the UDP port used when an address does not name one
+const DefaultPort = "7071"
+
+const (
+	magic   = "SCRP"
+	version = 2
+
+	kindSample = 1
+	kindPing   = 2
+	kindPong   = 3
+
+	headerSize = 10
+	sampleSize = headerSize + 26
+	pingSize   = headerSize + 8
+	pongSize   = headerSize + 16
+
+	// macSize is the length of the HMAC ending packets of a stream with a
+	// token
+	macSize = 16
+)
+
+// Sample flags
+const (
+	flagInRange = 1 << iota
+	flagPenDown
+	flagButton1
+	flagButton2
+	flagEraser
+	flagHasTilt
+)
+
+var errBadPacket = errors.New("not a remote pen packet")
+
+// header starts every packet. Stream is a random ID of the sender, so a
+// restarted sender is recognized even though its sequence starts over.
+type header struct {
+	kind   byte
+	stream uint32
+}
+
+// sample is a pen state as sent over the network. Sent is the time the
+// sample was read in nanoseconds of the sender's clock.
+type sample struct {
+	flags    byte
+	seq      uint32
+	sent     int64
+	x, y     uint32
+	pressure uint16
+	tiltX    int8
+	tiltY    int8
+}
+
+// newStream returns a random stream ID
+func newStream() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// putHeader writes the header at the start of b
+func putHeader(b []byte, h header) {
+	copy(b, magic)
+	b[4] = version
+	b[5] = h.kind
+	binary.BigEndian.PutUint32(b[6:], h.stream)
+}
+
+// parseHeader checks and decodes the header of a packet
+func parseHeader(b []byte) (header, error) {
+	if len(b) < headerSize || string(b[:4]) != magic || b[4] != version {
+		return header{}, errBadPacket
+	}
+	h := header{kind: b[5], stream: binary.BigEndian.Uint32(b[6:])}
+	var size int
+	switch h.kind {
+	case kindSample:
+		size = sampleSize
+	case kindPing:
+		size = pingSize
+	case kindPong:
+		size = pongSize
+	}
+	if size == 0 || len(b) < size {
+		return header{}, errBadPacket
+	}
+	return h, nil
+}
+
+// packetKey derives the key that signs packets from a shared token, or
+// returns nil if there is none
+func packetKey(token string) []byte {
+	if token == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte("scrawl remote pen\x00" + token))
+	return key[:]
+}
+
+// sign appends the HMAC of a packet if there is a key
+func sign(packet, key []byte) []byte {
+	if key == nil {
+		return packet
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(packet)
+	return mac.Sum(packet)[:len(packet)+macSize]
+}
+
+// verify checks the HMAC ending a packet and returns the packet without
+// it. Without a key every packet is accepted.
+func verify(packet, key []byte) ([]byte, bool) {
+	if key == nil {
+		return packet, true
+	}
+	if len(packet) < macSize {
+		return nil, false
+	}
+	body, got := packet[:len(packet)-macSize], packet[len(packet)-macSize:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return body, hmac.Equal(got, mac.Sum(nil)[:macSize])
+}
+
+// appendSample encodes a sample packet
+func appendSample(b []byte, stream uint32, s sample) []byte {
+	b = append(b, make([]byte, sampleSize)...)
+	p := b[len(b)-sampleSize:]
+	putHeader(p, header{kind: kindSample, stream: stream})
+	p[10] = s.flags
+	binary.BigEndian.PutUint32(p[12:], s.seq)
+	binary.BigEndian.PutUint64(p[16:], uint64(s.sent))
+	binary.BigEndian.PutUint32(p[24:], s.x)
+	binary.BigEndian.PutUint32(p[28:], s.y)
+	binary.BigEndian.PutUint16(p[32:], s.pressure)
+	p[34] = byte(s.tiltX)
+	p[35] = byte(s.tiltY)
+	return b
+}
+
+// parseSample decodes the body of a sample packet
+func parseSample(p []byte) sample {
+	return sample{
+		flags:    p[10],
+		seq:      binary.BigEndian.Uint32(p[12:]),
+		sent:     int64(binary.BigEndian.Uint64(p[16:])),
+		x:        binary.BigEndian.Uint32(p[24:]),
+		y:        binary.BigEndian.Uint32(p[28:]),
+		pressure: binary.BigEndian.Uint16(p[32:]),
+		tiltX:    int8(p[34]),
+		tiltY:    int8(p[35]),
+	}
+}
+
+// appendPing encodes a ping carrying the sender's clock
+func appendPing(b []byte, stream uint32, origin int64) []byte {
+	b = append(b, make([]byte, pingSize)...)
+	p := b[len(b)-pingSize:]
+	putHeader(p, header{kind: kindPing, stream: stream})
+	binary.BigEndian.PutUint64(p[10:], uint64(origin))
+	return b
+}
+
+// appendPong encodes the answer to a ping, echoing its time and adding the
+// answering side's clock
+func appendPong(b []byte, stream uint32, origin, now int64) []byte {
+	b = append(b, make([]byte, pongSize)...)
+	p := b[len(b)-pongSize:]
+	putHeader(p, header{kind: kindPong, stream: stream})
+	binary.BigEndian.PutUint64(p[10:], uint64(origin))
+	binary.BigEndian.PutUint64(p[18:], uint64(now))
+	return b
+}
+
+// parsePing returns the time carried by a ping or echoed by a pong, and
+// the clock of the side that answered a pong
+func parsePing(p []byte) (origin, remote int64) {
+	origin = int64(binary.BigEndian.Uint64(p[10:]))
+	if len(p) >= pongSize && p[5] == kindPong {
+		remote = int64(binary.BigEndian.Uint64(p[18:]))
+	}
+	return origin, remote
+}
+
+// encodePen normalizes a pen sample for sending
+func encodePen(pen *tablet.PenData, maxX, maxY, maxPressure int) sample {
+	s := sample{
+		x:        scale(pen.X, maxX, MaxPosition),
+		y:        scale(pen.Y, maxY, MaxPosition),
+		pressure: uint16(scale(pen.Pressure, maxPressure, MaxPressure)),
+	}
+	flags := []struct {
+		flag byte
+		set  bool
+	}{
+		{flagInRange, pen.InRange},
+		{flagPenDown, pen.PenDown},
+		{flagButton1, pen.Button1},
+		{flagButton2, pen.Button2},
+		{flagEraser, pen.Eraser},
+		{flagHasTilt, pen.HasTilt},
+	}
+	for _, f := range flags {
+		if f.set {
+			s.flags |= f.flag
+		}
+	}
+	if pen.HasTilt {
+		s.tiltX = int8(max(min(pen.TiltX, math.MaxInt8), math.MinInt8))
+		s.tiltY = int8(max(min(pen.TiltY, math.MaxInt8), math.MinInt8))
+	}
+	return s
+}
+
+// decodePen turns a received sample back into a pen sample
+func decodePen(s sample) *tablet.PenData {
+	return &tablet.PenData{
+		X:        int(s.x),
+		Y:        int(s.y),
+		Pressure: int(s.pressure),
+		InRange:  s.flags&flagInRange != 0,
+		PenDown:  s.flags&flagPenDown != 0,
+		Button1:  s.flags&flagButton1 != 0,
+		Button2:  s.flags&flagButton2 != 0,
+		Eraser:   s.flags&flagEraser != 0,
+		HasTilt:  s.flags&flagHasTilt != 0,
+		TiltX:    int(s.tiltX),
+		TiltY:    int(s.tiltY),
+	}
+}
+
+// scale maps v from 0..from onto 0..to, clamping it to the range
+func scale(v, from, to int) uint32 {
+	if from <= 0 {
+		return 0
+	}
+	v = max(min(v, from), 0)
+	return uint32((int64(v)*int64(to) + int64(from)/2) / int64(from))
+}
+
+// clock measures time in nanoseconds since it was created. Only differences
+// between two clocks' readings matter, so the monotonic clock is used.
+type clock struct {
+	epoch time.Time
+}
+
+// newClock starts a clock
+func newClock() clock {
+	return clock{epoch: time.Now()}
+}
+
+// at returns the clock reading for a time
+func (c clock) at(t time.Time) int64 {
+	return int64(t.Sub(c.epoch))
+}
+
+// now returns the current clock reading
+func (c clock) now() int64 {
+	return c.at(time.Now())
+}
+
+// time returns the time of a clock reading
+func (c clock) time(ns int64) time.Time {
+	return c.epoch.Add(time.Duration(ns))
+}
+
+// after reports whether sequence number a comes after b, allowing for
+// wrap-around
+func after(a, b uint32) bool {
+	return int32(a-b) > 0
+}
@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// heartbeatInterval is how often the sender repeats the pen state while
+// the pen is near the tablet but not moving
+const heartbeatInterval = 100 * time.Millisecond
+
+// transitionCopies is how many times a change of proximity or contact is
+// sent, so losing a datagram does not delay it
+const transitionCopies = 3
+
+// Sender forwards pen samples to a Source on another machine
+type Sender struct {
+	*link
+	conn   *net.UDPConn
+	stream uint32
+	key    []byte // Signs and checks packets, nil without a token
+
+	mu       sync.Mutex // Guards the fields below and writes
+	seq      uint32
+	last     sample
+	lastSent int64 // When a sample was last sent, 0 if never
+	buf      []byte
+}
+
+// Dial prepares to send samples to the receiver at the UDP address, e.g.
+// "laptop:7071", signed with the receiver's token if it has one
+func Dial(addr, token string) (*Sender, error) {
+	conn, err := net.Dial("udp", withPort(addr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach remote whiteboard: %w", err)
+	}
+	return NewSender(conn.(*net.UDPConn), token), nil
+}
+
+// NewSender sends samples over a connected UDP socket
+func NewSender(conn *net.UDPConn, token string) *Sender {
+	return &Sender{
+		link:   newLink(),
+		conn:   conn,
+		stream: newStream(),
+		key:    packetKey(token),
+	}
+}
+
+// Send forwards a pen sample from a tablet with the given ranges. UDP gives
+// no guarantees, so an error only means this sample was not sent.
+func (s *Sender) Send(pen *tablet.PenData, maxX, maxY, maxPressure int) error {
+	sample := encodePen(pen, maxX, maxY, maxPressure)
+	sample.sent = s.clock.now()
+	if !pen.Time.IsZero() {
+		sample.sent = s.clock.at(pen.Time)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	const transitions = flagInRange | flagPenDown
+	copies := 1
+	if s.lastSent == 0 || (sample.flags^s.last.flags)&transitions != 0 {
+		copies = transitionCopies
+	}
+	return s.write(sample, copies)
+}
+
+// write numbers and sends a sample. The lock must be held.
+func (s *Sender) write(sample sample, copies int) error {
+	s.seq++
+	sample.seq = s.seq
+	s.last = sample
+	s.lastSent = s.clock.now()
+	s.sent()
+
+	// Copies share the sequence number, so the receiver uses only one
+	s.buf = sign(appendSample(s.buf[:0], s.stream, sample), s.key)
+	for range copies {
+		if _, err := s.conn.Write(s.buf); err != nil {
+			return fmt.Errorf("failed to send pen sample: %w", err)
+		}
+	}
+	return nil
+}
+
+// heartbeat repeats the last state if the pen is near the tablet and
+// nothing was sent for a while, and measures the round trip
+func (s *Sender) heartbeat() {
+	now := s.clock.now()
+	if s.pingDue(now) {
+		s.conn.Write(sign(appendPing(nil, s.stream, now), s.key))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastSent != 0 && s.last.flags&flagInRange != 0 && now-s.lastSent >= int64(heartbeatInterval) {
+		// A repeat is a new sample of a pen that did not move
+		sample := s.last
+		sample.sent = now
+		s.write(sample, 1)
+	}
+}
+
+// receive answers pings and records pongs until the socket is closed
+func (s *Sender) receive() {
+	buf := make([]byte, 512)
+	for {
+		n, err := s.conn.Read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// Typically the receiver is not running yet
+			continue
+		}
+
+		packet, ok := verify(buf[:n], s.key)
+		if !ok {
+			continue
+		}
+		h, err := parseHeader(packet)
+		if err != nil {
+			continue
+		}
+		origin, remote := parsePing(packet)
+		switch h.kind {
+		case kindPing:
+			s.conn.Write(sign(appendPong(nil, s.stream, origin, s.clock.now()), s.key))
+		case kindPong:
+			s.pong(origin, remote, s.clock.now())
+		}
+	}
+}
+
+// Run forwards every sample of the source until it ends or is
+// disconnected, then lifts the pen on the receiver
+func (s *Sender) Run(source tablet.PenSource) error {
+	maxX, maxY := source.GetTabletDimensions()
+	maxPressure := source.GetMaxPressure()
+
+	go s.receive()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.heartbeat()
+			}
+		}
+	}()
+
+	for source.IsConnected() {
+		pen, err := source.ReadPenData()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		if err := s.Send(pen, maxX, maxY, maxPressure); err != nil {
+			logger.Debug("failed to send pen sample", "err", err)
+		}
+	}
+
+	return s.Send(&tablet.PenData{}, maxX, maxY, maxPressure)
+}
+
+// Close stops sending
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
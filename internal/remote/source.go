@@ -0,0 +1,244 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"xp-pen-controller/internal/logging"
+	"xp-pen-controller/internal/tablet"
+)
+
+var logger = logging.For(logging.Net)
+
+// penTimeout is how long the receiver waits for news of a pen near the
+// tablet before lifting it. Senders repeat the state well within it.
+const penTimeout = 500 * time.Millisecond
+
+// statsInterval is how often the receiver logs the link quality
+const statsInterval = 30 * time.Second
+
+// takeoverDelay is how long the sender must have been silent before
+// another stream takes over the pen. Senders ping every second, so a
+// restarted sender takes over soon, but no one can cut into a drawing.
+const takeoverDelay = 3 * pingInterval
+
+// Source receives pen samples from a Sender on another machine
+type Source struct {
+	*link
+	conn   *net.UDPConn
+	stream uint32 // Our stream ID, sent with pings
+	key    []byte // Signs and checks packets, nil without a token
+	buf    []byte
+	out    []byte
+
+	// Only used by ReadPenData
+	sender     *net.UDPAddr
+	senderID   uint32
+	seq        uint32
+	last       *tablet.PenData // Last sample returned
+	lastSample int64           // When the last sample arrived
+	lastHeard  int64           // When the sender last sent anything
+	lastStats  int64
+
+	mu     sync.Mutex // Guards active
+	active bool
+}
+
+var _ tablet.PenSource = (*Source)(nil)
+
+// Listen receives pen samples on the UDP address, e.g. ":7071", from
+// senders with the same token. Other machines can only send if a token is
+// set.
+func Listen(addr, token string) (*Source, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", withPort(addr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote pen address %q: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for a remote pen: %w", err)
+	}
+	if !conn.LocalAddr().(*net.UDPAddr).IP.IsLoopback() && token == "" {
+		conn.Close()
+		return nil, fmt.Errorf("a shared token is required to receive the pen from other machines on %s", addr)
+	}
+	return NewSource(conn, token), nil
+}
+
+// NewSource receives pen samples on a UDP socket. With a token, packets
+// without its signature are ignored.
+func NewSource(conn *net.UDPConn, token string) *Source {
+	return &Source{
+		link:   newLink(),
+		conn:   conn,
+		stream: newStream(),
+		key:    packetKey(token),
+		buf:    make([]byte, 512),
+		active: true,
+	}
+}
+
+// Addr returns the address samples are received on
+func (src *Source) Addr() net.Addr {
+	return src.conn.LocalAddr()
+}
+
+// ReadPenData waits for the next sample from the sender. If the pen was
+// near the tablet and the sender goes quiet, it returns a sample with the
+// pen out of range so that no stroke stays open.
+func (src *Source) ReadPenData() (*tablet.PenData, error) {
+	for {
+		var deadline time.Time
+		if src.last != nil && src.last.InRange {
+			deadline = src.clock.time(src.lastSample).Add(penTimeout)
+		}
+		src.conn.SetReadDeadline(deadline)
+
+		n, addr, err := src.conn.ReadFromUDP(src.buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			logger.Warn("remote pen went quiet, lifting it", "sender", src.sender)
+			lifted := tablet.PenData{X: src.last.X, Y: src.last.Y, Time: time.Now()}
+			src.last = &lifted
+			return &lifted, nil
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return nil, tablet.ErrDisconnected
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote pen: %w", err)
+		}
+
+		now := src.clock.now()
+		packet, ok := verify(src.buf[:n], src.key)
+		if !ok {
+			continue // Not from a sender with the token
+		}
+		h, err := parseHeader(packet)
+		if err != nil {
+			continue
+		}
+		// Only the sender of the pen is answered, so the receiver cannot
+		// be used to send packets to someone else
+		current := src.sender != nil && h.stream == src.senderID && addr.AddrPort() == src.sender.AddrPort()
+		if current {
+			src.lastHeard = now
+		}
+
+		switch h.kind {
+		case kindPing:
+			if current {
+				origin, _ := parsePing(packet)
+				src.send(addr, appendPong(src.out[:0], src.stream, origin, src.clock.now()))
+			}
+
+		case kindPong:
+			if current {
+				origin, remote := parsePing(packet)
+				src.pong(origin, remote, now)
+			}
+
+		case kindSample:
+			s := parseSample(packet)
+			var lost uint64
+			if !current {
+				if src.sender != nil && now-src.lastHeard < int64(takeoverDelay) {
+					logger.Debug("ignoring a second remote pen", "sender", addr)
+					continue
+				}
+				logger.Info("remote pen connected", "sender", addr)
+				src.reset()
+				src.senderID = h.stream
+				src.sender = addr
+				src.lastHeard = now
+			} else if !after(s.seq, src.seq) {
+				continue // Repeated or overtaken by a newer sample
+			} else {
+				lost = uint64(s.seq - src.seq - 1)
+			}
+			src.seq = s.seq
+
+			pen := decodePen(s)
+			local, synced := src.localTime(s.sent)
+			if synced {
+				// The clocks are compared only roughly, so a sample never
+				// appears to come from the future
+				local = min(local, now)
+				pen.Time = src.clock.time(local)
+			} else {
+				pen.Time = src.clock.time(now)
+			}
+			src.received(lost, time.Duration(now-local), synced)
+
+			if src.pingDue(now) {
+				src.send(addr, appendPing(src.out[:0], src.stream, now))
+			}
+			if now-src.lastStats >= int64(statsInterval) {
+				src.lastStats = now
+				src.logStats()
+			}
+
+			src.last = pen
+			src.lastSample = now
+			return pen, nil
+		}
+	}
+}
+
+// send writes a packet to the sender, which only costs a measurement if
+// it fails
+func (src *Source) send(addr *net.UDPAddr, packet []byte) {
+	packet = sign(packet, src.key)
+	src.out = packet
+	if _, err := src.conn.WriteToUDP(packet, addr); err != nil {
+		logger.Debug("failed to answer remote pen", "sender", addr, "err", err)
+	}
+}
+
+// logStats logs the quality of the link
+func (src *Source) logStats() {
+	stats := src.Stats()
+	logger.Info("remote pen link",
+		"sender", src.sender, "samples", stats.Samples, "lost", stats.Lost,
+		"roundTrip", stats.RoundTrip, "delay", stats.Delay)
+}
+
+// GetTabletDimensions returns the largest X and Y values of the samples
+func (src *Source) GetTabletDimensions() (int, int) {
+	return MaxPosition, MaxPosition
+}
+
+// GetMaxPressure returns the largest pressure value of the samples
+func (src *Source) GetMaxPressure() int {
+	return MaxPressure
+}
+
+// IsConnected returns whether the source is still listening
+func (src *Source) IsConnected() bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.active
+}
+
+// Disconnect stops listening
+func (src *Source) Disconnect() error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if !src.active {
+		return nil
+	}
+	src.active = false
+	return src.conn.Close()
+}
+
+// withPort adds the default port to an address without one
+func withPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, DefaultPort)
+	}
+	return addr
+}
@@ -0,0 +1,210 @@
+package remote
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+const testToken = "s3cret"
+
+// listen starts a receiver on a loopback port
+func listen(t *testing.T) *Source {
+	t.Helper()
+	src, err := Listen("127.0.0.1:0", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { src.Disconnect() })
+	return src
+}
+
+// dial connects a UDP socket to the receiver
+func dial(t *testing.T, src *Source) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, src.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// rawSender sends hand-made packets, to control sequence numbers and
+// signatures
+type rawSender struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	stream uint32
+	key    []byte
+}
+
+func newRawSender(t *testing.T, src *Source, token string) *rawSender {
+	return &rawSender{t: t, conn: dial(t, src), stream: newStream(), key: packetKey(token)}
+}
+
+// sample sends a sample of the pen at x, in range and touching
+func (rs *rawSender) sample(seq, x uint32) {
+	rs.t.Helper()
+	s := sample{seq: seq, x: x, flags: flagInRange | flagPenDown}
+	if _, err := rs.conn.Write(sign(appendSample(nil, rs.stream, s), rs.key)); err != nil {
+		rs.t.Fatal(err)
+	}
+}
+
+// ping sends a ping and reports whether it was answered
+func (rs *rawSender) ping() bool {
+	rs.t.Helper()
+	if _, err := rs.conn.Write(sign(appendPing(nil, rs.stream, 1), rs.key)); err != nil {
+		rs.t.Fatal(err)
+	}
+	rs.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err := rs.conn.Read(make([]byte, 512))
+	return err == nil
+}
+
+// read returns the next sample, failing the test if none arrives
+func read(t *testing.T, src *Source) *tablet.PenData {
+	t.Helper()
+	done := make(chan *tablet.PenData, 1)
+	go func() {
+		pen, err := src.ReadPenData()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- pen
+	}()
+	select {
+	case pen := <-done:
+		if pen == nil {
+			t.FailNow()
+		}
+		return pen
+	case <-time.After(3 * time.Second):
+		t.Fatal("no sample arrived")
+		return nil
+	}
+}
+
+func TestSequenceWrapsAroundAndCountsLoss(t *testing.T) {
+	src := listen(t)
+	rs := newRawSender(t, src, testToken)
+
+	rs.sample(0xfffffffe, 1)
+	rs.sample(0xffffffff, 2)
+	rs.sample(1, 3)          // 0 was lost
+	rs.sample(0xffffffff, 9) // Arrives late and is dropped
+	rs.sample(4, 4)          // 2 and 3 were lost
+
+	for want := range 4 {
+		if pen := read(t, src); pen.X != want+1 {
+			t.Errorf("sample %d at x=%d, want %d", want, pen.X, want+1)
+		}
+	}
+	if stats := src.Stats(); stats.Samples != 4 || stats.Lost != 3 {
+		t.Errorf("%d samples and %d lost, want 4 and 3", stats.Samples, stats.Lost)
+	}
+}
+
+func TestPenLiftedWhenSenderGoesQuiet(t *testing.T) {
+	src := listen(t)
+	rs := newRawSender(t, src, testToken)
+
+	rs.sample(1, 500)
+	if pen := read(t, src); !pen.PenDown {
+		t.Fatal("the pen is not down")
+	}
+
+	start := time.Now()
+	pen := read(t, src)
+	if elapsed := time.Since(start); elapsed < penTimeout-50*time.Millisecond {
+		t.Errorf("pen lifted after %v, before the timeout of %v", elapsed, penTimeout)
+	}
+	if pen.InRange || pen.PenDown || pen.X != 500 {
+		t.Errorf("sample %+v, want the pen lifted where it was", pen)
+	}
+}
+
+func TestTransitionCopiesAreAppliedOnce(t *testing.T) {
+	src := listen(t)
+	sender := NewSender(dial(t, src), testToken)
+
+	// Touching down is sent several times, moving once
+	if err := sender.Send(&tablet.PenData{X: 100, InRange: true, PenDown: true}, 1000, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(&tablet.PenData{X: 200, InRange: true, PenDown: true}, 1000, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := read(t, src), read(t, src)
+	if !first.PenDown || first.X != scaleTo(100) || second.X != scaleTo(200) {
+		t.Errorf("samples at x=%d and x=%d, want the touch down and then the move", first.X, second.X)
+	}
+	if stats := src.Stats(); stats.Samples != 2 || stats.Lost != 0 {
+		t.Errorf("%d samples and %d lost, want 2 and none", stats.Samples, stats.Lost)
+	}
+}
+
+// scaleTo is a position of a tablet 1000 wide as sent
+func scaleTo(x int) int {
+	return int(scale(x, 1000, MaxPosition))
+}
+
+func TestPacketsWithoutTheTokenAreIgnored(t *testing.T) {
+	src := listen(t)
+	stranger := newRawSender(t, src, "guess")
+	unsigned := newRawSender(t, src, "")
+	rs := newRawSender(t, src, testToken)
+
+	stranger.sample(1, 7)
+	unsigned.sample(1, 8)
+	rs.sample(1, 9)
+	if pen := read(t, src); pen.X != 9 {
+		t.Errorf("sample at x=%d, want only the signed one at 9", pen.X)
+	}
+
+	// Only the sender of the pen gets answers, so the receiver cannot be
+	// made to send packets elsewhere
+	if stranger.ping() {
+		t.Error("a ping without the token was answered")
+	}
+	if other := newRawSender(t, src, testToken); other.ping() {
+		t.Error("a ping from another sender was answered")
+	}
+	if !rs.ping() {
+		t.Error("the sender's ping was not answered")
+	}
+}
+
+func TestSecondSenderCannotTakeOver(t *testing.T) {
+	src := listen(t)
+	first := newRawSender(t, src, testToken)
+	second := newRawSender(t, src, testToken)
+
+	first.sample(1, 1)
+	read(t, src)
+	second.sample(1, 2)
+	first.sample(2, 3)
+	if pen := read(t, src); pen.X != 3 {
+		t.Errorf("sample at x=%d, want the first sender's at 3", pen.X)
+	}
+}
+
+func TestListenNeedsTokenOffLoopback(t *testing.T) {
+	if src, err := Listen("0.0.0.0:0", ""); err == nil {
+		src.Disconnect()
+		t.Error("listening on all interfaces without a token succeeded")
+	}
+	src, err := Listen("127.0.0.1:0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Disconnect()
+	if _, err := src.ReadPenData(); !errors.Is(err, tablet.ErrDisconnected) {
+		t.Errorf("read after Disconnect returned %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// AnimationOptions control how a replay is turned into an animation
+type AnimationOptions struct {
+	Width, Height int           // Frame size in pixels
+	FrameRate     int           // Frames per second of the animation
+	Speed         float64       // Playback speed relative to real time
+	Hold          time.Duration // How long the finished board stays on screen
+	Cursor        bool          // Show where the pen is
+}
+
+// DefaultAnimationOptions are used for any option left at zero
+var DefaultAnimationOptions = AnimationOptions{
+	FrameRate: 15,
+	Speed:     1,
+	Hold:      2 * time.Second,
+}
+
+// WriteGIF encodes the replay as an animated GIF. Each frame only stores the
+// area that changed, and frames without changes extend the previous one, so
+// pauses cost no space.
+func WriteGIF(w io.Writer, replay *drawing.Replay, opts AnimationOptions) error {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	// GIF delays are in hundredths of a second
+	delay := max(1, 100/opts.FrameRate)
+
+	rr := NewReplayRenderer(replay, opts.Width, opts.Height, opts.Cursor)
+	pal := color.Palette(palette.Plan9)
+
+	anim := &gif.GIF{Config: image.Config{ColorModel: pal, Width: opts.Width, Height: opts.Height}}
+	for _, t := range opts.frameTimes(replay) {
+		img, changed := rr.Frame(t)
+
+		// Frames without changes extend the previous one
+		if changed.Empty() {
+			anim.Delay[len(anim.Delay)-1] += delay
+			continue
+		}
+		frame := image.NewPaletted(changed, pal)
+		draw.Draw(frame, changed, img, changed.Min, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	anim.Delay[len(anim.Delay)-1] += int(opts.Hold / (10 * time.Millisecond))
+
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("failed to encode animation: %w", err)
+	}
+	return nil
+}
+
+// withDefaults fills in options left at zero and checks the frame size
+func (opts AnimationOptions) withDefaults() (AnimationOptions, error) {
+	if opts.FrameRate <= 0 {
+		opts.FrameRate = DefaultAnimationOptions.FrameRate
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = DefaultAnimationOptions.Speed
+	}
+	if opts.Hold <= 0 {
+		opts.Hold = DefaultAnimationOptions.Hold
+	}
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return opts, fmt.Errorf("invalid animation size %dx%d", opts.Width, opts.Height)
+	}
+	return opts, nil
+}
+
+// frameTimes returns the replay time of every frame, ending with a frame
+// of the finished board
+func (opts AnimationOptions) frameTimes(replay *drawing.Replay) []time.Duration {
+	step := time.Duration(float64(time.Second) / float64(opts.FrameRate) * opts.Speed)
+	var times []time.Duration
+	for t := time.Duration(0); t < replay.Duration(); t += step {
+		times = append(times, t)
+	}
+	return append(times, replay.Duration())
+}
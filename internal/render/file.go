@@ -0,0 +1,74 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// ImageSize picks the size of an image of the canvas, keeping the canvas
+// aspect ratio for any dimension that is zero
+func ImageSize(c *drawing.Canvas, width, height int) (int, int) {
+	return fitSize(c.Width, c.Height, width, height)
+}
+
+// WriteImage encodes the image in the format given by the file extension,
+// PNG or JPEG
+func WriteImage(path string, img image.Image) error {
+	var encode func(io.Writer, image.Image) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		encode = func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+		}
+	case ".png":
+		encode = png.Encode
+	default:
+		// Checked first so that a wrong name leaves no empty file behind
+		return fmt.Errorf("unsupported image format %q", filepath.Ext(path))
+	}
+
+	return WriteFile(path, func(w io.Writer) error {
+		if err := encode(w, img); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// WriteFile writes a file through a temporary file in the same directory
+// that replaces it once complete, so a failed write leaves any earlier
+// file as it was and no partial file behind
+func WriteFile(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	tmp := f.Name()
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// Temporary files are private, exported ones are not
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
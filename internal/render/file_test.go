@@ -0,0 +1,75 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirEntries lists the names of the files in a directory
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWriteImageKeepsFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "board.png")
+	if err := os.WriteFile(path, []byte("earlier export"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// PNG cannot encode an empty image
+	if err := WriteImage(path, image.NewRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Fatal("encoding an empty image succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "earlier export" {
+		t.Errorf("file holds %q after a failed export", data)
+	}
+	if names := dirEntries(t, dir); len(names) != 1 {
+		t.Errorf("directory holds %v, want only the earlier export", names)
+	}
+
+	if err := WriteImage(path, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil || img.Bounds().Dx() != 4 {
+		t.Errorf("exported image %v, %v", img, err)
+	}
+	if info, _ := f.Stat(); info.Mode().Perm() != 0o644 {
+		t.Errorf("exported image has mode %v", info.Mode())
+	}
+}
+
+func TestWriteFileLeavesNothingOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	failed := errors.New("replay failed")
+	err := WriteFile(filepath.Join(dir, "board.gif"), func(w io.Writer) error {
+		io.WriteString(w, "GIF89a")
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, want the error of the writer", err)
+	}
+	if names := dirEntries(t, dir); len(names) != 0 {
+		t.Errorf("directory holds %v after a failed write", names)
+	}
+}
@@ -0,0 +1,156 @@
+package render
+
+import (
+	"math"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// Vec is a point in display coordinates
+type Vec struct {
+	X, Y float64
+}
+
+// arcTolerance is the maximum distance in display units between a round
+// join or cap and its polygonal approximation
+const arcTolerance = 0.2
+
+// outlinePoint is a stroke point in display coordinates with its half width
+type outlinePoint struct {
+	Vec
+	radius float64
+}
+
+// Outline converts a stroke into a single closed polygon in display
+// coordinates. The polygon follows offset curves on both sides of the
+// stroke, with the width given by the brush at every point, and
+// has round caps and round joins. Inner joins may overlap, so the polygon
+// must be filled with the non-zero winding rule.
+func Outline(stroke *drawing.Stroke, view drawing.View) []Vec {
+	if stroke == nil || stroke.IsEmpty() {
+		return nil
+	}
+
+	points := outlinePoints(stroke, view)
+	if len(points) == 1 {
+		p := points[0]
+		return arc(p.Vec, p.radius, 0, -2*math.Pi, nil)
+	}
+
+	// Walk forward along the left side, round the end, walk back along the
+	// other side (the left side of the reversed stroke) and round the start
+	reversed := make([]outlinePoint, len(points))
+	for i, p := range points {
+		reversed[len(points)-1-i] = p
+	}
+
+	polygon := offsetSide(points, nil)
+	polygon = roundCap(points, polygon)
+	polygon = offsetSide(reversed, polygon)
+	polygon = roundCap(reversed, polygon)
+
+	return polygon
+}
+
+// outlinePoints converts the stroke to display coordinates, dropping points
+// that coincide with their predecessor since they have no direction
+func outlinePoints(stroke *drawing.Stroke, view drawing.View) []outlinePoint {
+	points := make([]outlinePoint, 0, len(stroke.Points))
+	for i, p := range stroke.Points {
+		x, y := view.ToScreen(p.X, p.Y)
+		op := outlinePoint{
+			Vec:    Vec{X: x, Y: y},
+			radius: stroke.WidthAt(i) * view.Scale / 2,
+		}
+
+		if n := len(points); n > 0 && math.Hypot(x-points[n-1].X, y-points[n-1].Y) < 1e-6 {
+			// Keep the widest radius so a width change in place is not lost
+			points[n-1].radius = math.Max(points[n-1].radius, op.radius)
+			continue
+		}
+		points = append(points, op)
+	}
+	return points
+}
+
+// offsetSide appends the left offset curve of the points to the polygon.
+// Outer joins get an arc; inner joins pivot through the centre point, which
+// keeps the outline continuous even for very sharp turns.
+func offsetSide(points []outlinePoint, polygon []Vec) []Vec {
+	for i := 0; i < len(points)-1; i++ {
+		p1, p2 := points[i], points[i+1]
+		n := normal(p1.Vec, p2.Vec)
+
+		polygon = append(polygon,
+			Vec{p1.X + n.X*p1.radius, p1.Y + n.Y*p1.radius},
+			Vec{p2.X + n.X*p2.radius, p2.Y + n.Y*p2.radius},
+		)
+
+		if i+2 >= len(points) {
+			break
+		}
+
+		// Join with the next segment
+		next := normal(p2.Vec, points[i+2].Vec)
+		turn := math.Atan2(cross(n, next), dot(n, next))
+		if turn < 0 {
+			// Turning away from this side: it is the outside of the bend
+			polygon = arc(p2.Vec, p2.radius, math.Atan2(n.Y, n.X), turn, polygon)
+		} else {
+			polygon = append(polygon, p2.Vec)
+		}
+	}
+	return polygon
+}
+
+// roundCap appends a round cap around the last point, sweeping from the left
+// side of the final segment to its right side
+func roundCap(points []outlinePoint, polygon []Vec) []Vec {
+	last := points[len(points)-1]
+	n := normal(points[len(points)-2].Vec, last.Vec)
+	return arc(last.Vec, last.radius, math.Atan2(n.Y, n.X), -math.Pi, polygon)
+}
+
+// arc appends the points of a circular arc to the polygon
+func arc(center Vec, radius, start, sweep float64, polygon []Vec) []Vec {
+	if radius <= 0 {
+		return append(polygon, center)
+	}
+
+	// Choose the step so the chord never strays further than the tolerance
+	step := math.Pi / 4
+	if radius > arcTolerance {
+		step = math.Min(step, 2*math.Acos(1-arcTolerance/radius))
+	}
+	segments := int(math.Ceil(math.Abs(sweep) / step))
+	if segments < 1 {
+		segments = 1
+	}
+
+	for i := 0; i <= segments; i++ {
+		angle := start + sweep*float64(i)/float64(segments)
+		polygon = append(polygon, Vec{
+			X: center.X + radius*math.Cos(angle),
+			Y: center.Y + radius*math.Sin(angle),
+		})
+	}
+	return polygon
+}
+
+// normal returns the unit vector perpendicular to the segment from a to b
+func normal(a, b Vec) Vec {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return Vec{}
+	}
+	return Vec{X: -dy / length, Y: dx / length}
+}
+
+func cross(a, b Vec) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+func dot(a, b Vec) float64 {
+	return a.X*b.X + a.Y*b.Y
+}
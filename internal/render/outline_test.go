@@ -0,0 +1,227 @@
+package render
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+var update = flag.Bool("update", false, "rewrite the reference images in testdata")
+
+// Tolerance of the comparison with reference images: anti-aliasing may
+// differ slightly between platforms, an actual change of shape may not
+const (
+	maxChannelDiff   = 24    // Largest difference of a colour channel that counts as equal
+	maxDifferentRate = 0.002 // Share of pixels allowed to differ by more
+)
+
+// testStroke builds a round stroke through the given points, each with its
+// pressure
+func testStroke(minWidth, maxWidth float64, points ...drawing.Point) *drawing.Stroke {
+	s := drawing.NewStroke()
+	s.MinWidth, s.MaxWidth = minWidth, maxWidth
+	for _, p := range points {
+		s.AddPoint(p)
+	}
+	s.Complete()
+	return s
+}
+
+// outlineCases are the strokes compared against reference images, drawn on
+// a 160x120 image at scale 1
+var outlineCases = []struct {
+	name   string
+	stroke *drawing.Stroke
+}{
+	{
+		// A hairpin: the inner join must not leave a notch or a gap
+		name: "sharp-turn",
+		stroke: testStroke(12, 12,
+			drawing.Point{X: 20, Y: 100, Pressure: 1},
+			drawing.Point{X: 80, Y: 20, Pressure: 1},
+			drawing.Point{X: 140, Y: 100, Pressure: 1},
+			drawing.Point{X: 90, Y: 40, Pressure: 1},
+		),
+	},
+	{
+		// Width grows smoothly from a thin start to a thick end
+		name:   "pressure-ramp",
+		stroke: pressureRamp(),
+	},
+	{
+		// A single point is a round dot
+		name:   "dot",
+		stroke: testStroke(30, 30, drawing.Point{X: 80, Y: 60, Pressure: 1}),
+	},
+	{
+		// Round caps at both ends and round outer joins along a zigzag
+		name: "caps-and-joins",
+		stroke: testStroke(4, 20,
+			drawing.Point{X: 20, Y: 90, Pressure: 1},
+			drawing.Point{X: 50, Y: 30, Pressure: 0.5},
+			drawing.Point{X: 80, Y: 90, Pressure: 1},
+			drawing.Point{X: 110, Y: 30, Pressure: 0.5},
+			drawing.Point{X: 140, Y: 90, Pressure: 1},
+		),
+	},
+}
+
+// pressureRamp is a straight stroke whose pressure rises from 0 to 1
+func pressureRamp() *drawing.Stroke {
+	var points []drawing.Point
+	for i := 0; i <= 20; i++ {
+		points = append(points, drawing.Point{X: 20 + float64(i)*6, Y: 60, Pressure: float64(i) / 20})
+	}
+	return testStroke(2, 30, points...)
+}
+
+// renderCase draws a stroke in black on white
+func renderCase(stroke *drawing.Stroke) *image.RGBA {
+	img := NewImage(160, 120, color.White)
+	DrawStroke(img, stroke, drawing.View{Scale: 1})
+	return img
+}
+
+func TestOutlineReferenceImages(t *testing.T) {
+	for _, tc := range outlineCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := renderCase(tc.stroke)
+			path := filepath.Join("testdata", "outline-"+tc.name+".png")
+			if *update {
+				writePNG(t, path, got)
+				return
+			}
+
+			want := readPNG(t, path)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("size %v, want %v", got.Bounds(), want.Bounds())
+			}
+			different := 0
+			for y := got.Bounds().Min.Y; y < got.Bounds().Max.Y; y++ {
+				for x := got.Bounds().Min.X; x < got.Bounds().Max.X; x++ {
+					if colorDiff(got.At(x, y), want.At(x, y)) > maxChannelDiff {
+						different++
+					}
+				}
+			}
+			if rate := float64(different) / float64(got.Bounds().Dx()*got.Bounds().Dy()); rate > maxDifferentRate {
+				writePNG(t, filepath.Join(t.TempDir(), "got.png"), got)
+				t.Errorf("%d pixels differ from %s (%.2f%%); rerun with -update if the change is intended",
+					different, path, rate*100)
+			}
+		})
+	}
+}
+
+// TestOutlineShapes checks properties the reference images should show, so
+// that a wrong image cannot be accepted with -update unnoticed
+func TestOutlineShapes(t *testing.T) {
+	t.Run("sharp turn is solid at the apex", func(t *testing.T) {
+		img := renderCase(outlineCases[0].stroke)
+		// Points on the centre line near both turns are fully covered
+		for _, p := range []image.Point{{80, 22}, {78, 25}, {138, 98}, {134, 96}} {
+			if !isInk(img.At(p.X, p.Y)) {
+				t.Errorf("pixel %v near a turn is not covered", p)
+			}
+		}
+	})
+
+	t.Run("pressure ramp widens steadily", func(t *testing.T) {
+		img := renderCase(pressureRamp())
+		previous := 0
+		for x := 30; x <= 130; x += 10 {
+			width := inkHeight(img, x)
+			if width < previous {
+				t.Errorf("width %d at x=%d is less than %d before it", width, x, previous)
+			}
+			previous = width
+		}
+		if thin, thick := inkHeight(img, 25), inkHeight(img, 135); thick < 3*thin {
+			t.Errorf("width only grows from %d to %d", thin, thick)
+		}
+	})
+
+	t.Run("dot is round", func(t *testing.T) {
+		img := renderCase(outlineCases[2].stroke)
+		if isInk(img.At(80-14, 60-14)) || !isInk(img.At(80-10, 60-10)) {
+			t.Error("the corner of the bounding square is covered, or the disc is too small")
+		}
+	})
+
+	t.Run("caps are round", func(t *testing.T) {
+		img := renderCase(outlineCases[3].stroke)
+		// The start cap bulges past the first point along the stroke, but
+		// not out to the corner of a square cap
+		if !isInk(img.At(17, 94)) {
+			t.Error("no cap beyond the first point")
+		}
+		if isInk(img.At(8, 94)) {
+			t.Error("the cap reaches out like a square")
+		}
+	})
+}
+
+// inkHeight counts the dark pixels in a column
+func inkHeight(img *image.RGBA, x int) int {
+	n := 0
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		if isInk(img.At(x, y)) {
+			n++
+		}
+	}
+	return n
+}
+
+// isInk reports whether a pixel is mostly covered by a black stroke
+func isInk(c color.Color) bool {
+	r, _, _, _ := c.RGBA()
+	return r < 0x8000
+}
+
+// colorDiff returns the largest difference of a channel in 8-bit steps
+func colorDiff(a, b color.Color) int {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	diff := 0
+	for _, d := range [][2]uint32{{ar, br}, {ag, bg}, {ab, bb}, {aa, ba}} {
+		diff = max(diff, int(math.Abs(float64(d[0]>>8)-float64(d[1]>>8))))
+	}
+	return diff
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("missing reference image, create it with -update: %v", err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("wrote %s", path)
+}
@@ -0,0 +1,102 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/vector"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// NewImage creates an image of the given size filled with the background color
+func NewImage(width, height int, background color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	Fill(img, background)
+	return img
+}
+
+// Fill paints the whole image with a single color
+func Fill(img *image.RGBA, c color.Color) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// Canvas renders all strokes of a drawing canvas into a new image.
+// The canvas is fitted into the image without distorting its aspect ratio.
+func Canvas(c *drawing.Canvas, width, height int) *image.RGBA {
+	img := NewImage(width, height, c.Background)
+	view := drawing.FitView(c.Width, c.Height, float64(width), float64(height))
+	DrawStrokes(img, c.GetAllStrokes(), view)
+	return img
+}
+
+// DrawStrokes draws the strokes on top of the image in order
+func DrawStrokes(dst *image.RGBA, strokes []*drawing.Stroke, view drawing.View) {
+	for _, stroke := range strokes {
+		DrawStroke(dst, stroke, view)
+	}
+}
+
+// DrawStroke draws a single stroke on top of the image.
+// Only the pixels covered by the stroke's bounding box are touched, so the
+// cost depends on the size of the stroke rather than the size of the image.
+func DrawStroke(dst *image.RGBA, stroke *drawing.Stroke, view drawing.View) {
+	DrawStrokeClipped(dst, stroke, view, dst.Bounds())
+}
+
+// DrawStrokeClipped draws a single stroke on top of the image, touching only
+// pixels inside the clip rectangle
+func DrawStrokeClipped(dst *image.RGBA, stroke *drawing.Stroke, view drawing.View, clip image.Rectangle) {
+	if stroke == nil || stroke.IsEmpty() {
+		return
+	}
+
+	bounds := StrokeBounds(stroke, view).Intersect(clip).Intersect(dst.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	// The rasterizer covers only the visible part of the stroke
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	addPolygon(z, Outline(stroke, view), float64(bounds.Min.X), float64(bounds.Min.Y))
+	z.Draw(dst, bounds, image.NewUniform(stroke.Color), image.Point{})
+}
+
+// StrokeBounds returns the pixel rectangle covered by a stroke in the given view
+func StrokeBounds(stroke *drawing.Stroke, view drawing.View) image.Rectangle {
+	if stroke == nil || stroke.IsEmpty() {
+		return image.Rectangle{}
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, p := range stroke.Points {
+		x, y := view.ToScreen(p.X, p.Y)
+		r := stroke.WidthAt(i) * view.Scale / 2
+		minX = math.Min(minX, x-r)
+		minY = math.Min(minY, y-r)
+		maxX = math.Max(maxX, x+r)
+		maxY = math.Max(maxY, y+r)
+	}
+
+	// Pad by a pixel for anti-aliasing
+	return image.Rect(
+		int(math.Floor(minX))-1, int(math.Floor(minY))-1,
+		int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1,
+	)
+}
+
+// addPolygon adds a closed polygon to the rasterizer, shifted by the offset
+func addPolygon(z *vector.Rasterizer, polygon []Vec, offsetX, offsetY float64) {
+	if len(polygon) < 3 {
+		return
+	}
+
+	z.MoveTo(float32(polygon[0].X-offsetX), float32(polygon[0].Y-offsetY))
+	for _, p := range polygon[1:] {
+		z.LineTo(float32(p.X-offsetX), float32(p.Y-offsetY))
+	}
+	z.ClosePath()
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"time"
+
+	"golang.org/x/image/vector"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// cursorColor is the outline of the pen cursor drawn into replays
+var cursorColor = color.RGBA{0, 0, 0, 160}
+
+// minCursorRadius keeps the cursor visible for thin strokes, in pixels
+const minCursorRadius = 3
+
+// ReplayRenderer renders the frames of a replay in order. Time only moves
+// forward, so finished strokes are drawn once into a base image and every
+// frame only redraws the area that changed.
+type ReplayRenderer struct {
+	replay *drawing.Replay
+	canvas *drawing.Canvas
+	view   drawing.View
+	base   *image.RGBA // Finished strokes
+	img    *image.RGBA // Current frame
+	drawn  int         // Number of finished strokes in base
+	first  bool
+
+	cursor     bool            // Draw the pen cursor
+	lastCursor image.Rectangle // Pixels covered by the cursor in the last frame
+}
+
+// NewReplayRenderer creates a renderer for frames of the given size. With
+// cursor set, every frame shows where the pen is.
+func NewReplayRenderer(replay *drawing.Replay, width, height int, cursor bool) *ReplayRenderer {
+	c := replay.NewCanvas()
+	return &ReplayRenderer{
+		replay: replay,
+		canvas: c,
+		view:   drawing.FitView(c.Width, c.Height, float64(width), float64(height)),
+		base:   NewImage(width, height, c.Background),
+		img:    image.NewRGBA(image.Rect(0, 0, width, height)),
+		first:  true,
+		cursor: cursor,
+	}
+}
+
+// Frame renders the board at time t, which must not be earlier than the
+// time of the previous frame. It returns the frame, which is reused by the
+// next call, and the part that changed since the previous frame.
+func (rr *ReplayRenderer) Frame(t time.Duration) (*image.RGBA, image.Rectangle) {
+	c := rr.canvas
+	rr.replay.Render(c, t)
+	DrawStrokes(rr.base, c.Strokes[rr.drawn:], rr.view)
+	rr.drawn = len(c.Strokes)
+
+	bounds := rr.img.Bounds()
+	changed := pixelBounds(c.TakeDirty(), rr.view)
+
+	var cursor image.Rectangle
+	var center Vec
+	var radius float64
+	if rr.cursor {
+		if point, stroke, ok := rr.replay.PenAt(t); ok {
+			x, y := rr.view.ToScreen(point.X, point.Y)
+			center = Vec{X: x, Y: y}
+			radius = math.Max(stroke.MaxWidth*rr.view.Scale/2, minCursorRadius)
+			cursor = image.Rect(
+				int(math.Floor(x-radius))-1, int(math.Floor(y-radius))-1,
+				int(math.Ceil(x+radius))+1, int(math.Ceil(y+radius))+1,
+			)
+		}
+		changed = changed.Union(rr.lastCursor).Union(cursor)
+		rr.lastCursor = cursor
+	}
+
+	if rr.first {
+		changed = bounds
+		rr.first = false
+	}
+	changed = changed.Intersect(bounds)
+	if changed.Empty() {
+		return rr.img, changed
+	}
+
+	draw.Draw(rr.img, changed, rr.base, changed.Min, draw.Src)
+	DrawStrokeClipped(rr.img, c.CurrentStroke, rr.view, changed)
+	if !cursor.Empty() {
+		drawRing(rr.img, center, radius, cursor.Intersect(changed))
+	}
+	return rr.img, changed
+}
+
+// drawRing draws a one pixel wide circle outline, touching only pixels
+// inside the clip rectangle
+func drawRing(dst *image.RGBA, center Vec, radius float64, clip image.Rectangle) {
+	if clip.Empty() {
+		return
+	}
+
+	// The inner circle runs the other way, which leaves a hole in its place
+	outer := arc(center, radius+0.5, 0, 2*math.Pi, nil)
+	inner := arc(center, radius-0.5, 0, -2*math.Pi, nil)
+
+	z := vector.NewRasterizer(clip.Dx(), clip.Dy())
+	addPolygon(z, outer, float64(clip.Min.X), float64(clip.Min.Y))
+	addPolygon(z, inner, float64(clip.Min.X), float64(clip.Min.Y))
+	z.Draw(dst, clip, image.NewUniform(cursorColor), image.Point{})
+}
+
+// pixelBounds returns the pixels covered by a canvas rectangle in the view
+func pixelBounds(r drawing.Rect, view drawing.View) image.Rectangle {
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+	minX, minY := view.ToScreen(r.MinX, r.MinY)
+	maxX, maxY := view.ToScreen(r.MaxX, r.MaxY)
+
+	// Pad by a pixel for anti-aliasing
+	return image.Rect(
+		int(math.Floor(minX))-1, int(math.Floor(minY))-1,
+		int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1,
+	)
+}
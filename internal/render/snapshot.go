@@ -0,0 +1,121 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/vector"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// cropMargin is the space kept around the strokes when cropping, in canvas
+// units
+const cropMargin = 16
+
+// SnapshotOptions control how Snapshot renders a canvas
+type SnapshotOptions struct {
+	Width, Height int  // Image size; zero keeps the aspect ratio
+	Transparent   bool // Leave out the background; eraser strokes clear
+	Crop          bool // Show only the area with strokes
+}
+
+// Snapshot renders a canvas for streaming and overlays. The canvas lock
+// must be held or the canvas must not be shared.
+func Snapshot(c *drawing.Canvas, opts SnapshotOptions) *image.RGBA {
+	strokes := c.GetAllStrokes()
+	area := snapshotArea(c, strokes, opts.Crop)
+	areaWidth, areaHeight := area.MaxX-area.MinX, area.MaxY-area.MinY
+	width, height := fitSize(areaWidth, areaHeight, opts.Width, opts.Height)
+	view := drawing.FitView(areaWidth, areaHeight, float64(width), float64(height))
+	view.OffsetX -= area.MinX * view.Scale
+	view.OffsetY -= area.MinY * view.Scale
+
+	if !opts.Transparent {
+		img := NewImage(width, height, c.Background)
+		DrawStrokes(img, strokes, view)
+		return img
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := color.RGBAModel.Convert(c.Background)
+	for _, stroke := range strokes {
+		if color.RGBAModel.Convert(stroke.Color) == background {
+			eraseStroke(img, stroke, view)
+		} else {
+			DrawStroke(img, stroke, view)
+		}
+	}
+	return img
+}
+
+// SnapshotSize returns the size of the image Snapshot would render. The
+// canvas lock must be held or the canvas must not be shared.
+func SnapshotSize(c *drawing.Canvas, opts SnapshotOptions) (int, int) {
+	area := snapshotArea(c, c.GetAllStrokes(), opts.Crop)
+	return fitSize(area.MaxX-area.MinX, area.MaxY-area.MinY, opts.Width, opts.Height)
+}
+
+// snapshotArea returns the part of the canvas a snapshot shows: all of it,
+// or the strokes and a margin when cropping
+func snapshotArea(c *drawing.Canvas, strokes []*drawing.Stroke, crop bool) drawing.Rect {
+	area := drawing.Rect{MaxX: c.Width, MaxY: c.Height}
+	if !crop {
+		return area
+	}
+	var content drawing.Rect
+	for _, stroke := range strokes {
+		content = content.Union(stroke.Bounds())
+	}
+	if content.Empty() {
+		return area
+	}
+	return drawing.Rect{
+		MinX: content.MinX - cropMargin, MinY: content.MinY - cropMargin,
+		MaxX: content.MaxX + cropMargin, MaxY: content.MaxY + cropMargin,
+	}
+}
+
+// eraseStroke makes the pixels under a stroke transparent, keeping the
+// anti-aliased edge soft
+func eraseStroke(dst *image.RGBA, stroke *drawing.Stroke, view drawing.View) {
+	bounds := StrokeBounds(stroke, view).Intersect(dst.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	addPolygon(z, Outline(stroke, view), float64(bounds.Min.X), float64(bounds.Min.Y))
+	coverage := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	z.Draw(coverage, coverage.Bounds(), image.Opaque, image.Point{})
+
+	// Colours are premultiplied, so scaling every channel removes paint
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			keep := 255 - uint32(coverage.AlphaAt(x, y).A)
+			if keep == 255 {
+				continue
+			}
+			i := dst.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			for _, j := range [4]int{i, i + 1, i + 2, i + 3} {
+				dst.Pix[j] = uint8((uint32(dst.Pix[j])*keep + 127) / 255)
+			}
+		}
+	}
+}
+
+// fitSize picks an image size for an area, keeping its aspect ratio for
+// any dimension that is zero
+func fitSize(areaWidth, areaHeight float64, width, height int) (int, int) {
+	switch {
+	case width > 0 && height > 0:
+		return width, height
+	case width > 0:
+		return width, max(int(math.Round(float64(width)*areaHeight/areaWidth)), 1)
+	case height > 0:
+		return max(int(math.Round(float64(height)*areaWidth/areaHeight)), 1), height
+	default:
+		return max(int(math.Ceil(areaWidth)), 1), max(int(math.Ceil(areaHeight)), 1)
+	}
+}
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// WriteFrames renders the replay as a sequence of full frames at the frame
+// rate, followed by the finished board for the hold time, and passes each
+// frame to write. The frame is reused after write returns.
+func WriteFrames(replay *drawing.Replay, opts AnimationOptions, write func(*image.RGBA) error) error {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	rr := NewReplayRenderer(replay, opts.Width, opts.Height, opts.Cursor)
+	var img *image.RGBA
+	for _, t := range opts.frameTimes(replay) {
+		img, _ = rr.Frame(t)
+		if err := write(img); err != nil {
+			return err
+		}
+	}
+
+	hold := int(opts.Hold * time.Duration(opts.FrameRate) / time.Second)
+	for range hold {
+		if err := write(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Y4MWriter writes frames as an uncompressed YUV4MPEG2 stream with 4:2:0
+// chroma, which most video encoders accept on standard input
+type Y4MWriter struct {
+	w             *bufio.Writer
+	width, height int
+	y, cb, cr     []byte // Planes of one frame
+}
+
+// NewY4MWriter writes the stream header. Both dimensions must be even.
+func NewY4MWriter(w io.Writer, width, height, frameRate int) (*Y4MWriter, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return nil, fmt.Errorf("y4m frames need an even size, got %dx%d", width, height)
+	}
+
+	yw := &Y4MWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		y:      make([]byte, width*height),
+		cb:     make([]byte, width*height/4),
+		cr:     make([]byte, width*height/4),
+	}
+	if _, err := fmt.Fprintf(yw.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C420jpeg\n", width, height, frameRate); err != nil {
+		return nil, fmt.Errorf("failed to write y4m header: %w", err)
+	}
+	return yw, nil
+}
+
+// WriteFrame converts the image to YCbCr and appends it to the stream
+func (yw *Y4MWriter) WriteFrame(img *image.RGBA) error {
+	if img.Bounds().Dx() != yw.width || img.Bounds().Dy() != yw.height {
+		return fmt.Errorf("frame size %v does not match the stream", img.Bounds().Size())
+	}
+
+	origin := img.Bounds().Min
+	for y := 0; y < yw.height; y += 2 {
+		for x := 0; x < yw.width; x += 2 {
+			// Chroma is the average of each 2x2 block
+			var sumCb, sumCr int
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					c := img.RGBAAt(origin.X+x+dx, origin.Y+y+dy)
+					luma, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+					yw.y[(y+dy)*yw.width+x+dx] = luma
+					sumCb += int(cb)
+					sumCr += int(cr)
+				}
+			}
+			i := (y/2)*(yw.width/2) + x/2
+			yw.cb[i] = byte((sumCb + 2) / 4)
+			yw.cr[i] = byte((sumCr + 2) / 4)
+		}
+	}
+
+	for _, part := range [][]byte{[]byte("FRAME\n"), yw.y, yw.cb, yw.cr} {
+		if _, err := yw.w.Write(part); err != nil {
+			return fmt.Errorf("failed to write y4m frame: %w", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying writer
+func (yw *Y4MWriter) Flush() error {
+	if err := yw.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write y4m frame: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package tablet
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureHeader starts every capture file
+const captureHeader = "# scrawl capture v1"
+
+// CapturedReport is a raw report together with its arrival time
+type CapturedReport struct {
+	Offset time.Duration // Time since the start of the capture
+	Data   []byte
+}
+
+// CaptureWriter records raw reports with their arrival times.
+// Each report is written as a line "<nanoseconds> <hex bytes>".
+type CaptureWriter struct {
+	w     *bufio.Writer
+	start time.Time
+}
+
+// NewCaptureWriter writes the capture header and returns a writer for reports
+func NewCaptureWriter(w io.Writer, profile string) (*CaptureWriter, error) {
+	cw := &CaptureWriter{
+		w:     bufio.NewWriter(w),
+		start: time.Now(),
+	}
+	if _, err := fmt.Fprintf(cw.w, "%s profile=%s\n", captureHeader, profile); err != nil {
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+	return cw, nil
+}
+
+// WriteReport records a report received now
+func (cw *CaptureWriter) WriteReport(data []byte) error {
+	offset := time.Since(cw.start)
+	if _, err := fmt.Fprintf(cw.w, "%d %s\n", offset.Nanoseconds(), hex.EncodeToString(data)); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered reports to the underlying writer
+func (cw *CaptureWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// ReadCapture parses a capture file and returns its reports and the name of
+// the profile it was recorded with
+func ReadCapture(r io.Reader) ([]CapturedReport, string, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, "", fmt.Errorf("empty capture")
+	}
+
+	header := scanner.Text()
+	if !strings.HasPrefix(header, captureHeader) {
+		return nil, "", fmt.Errorf("not a capture file")
+	}
+	profile := ""
+	for _, field := range strings.Fields(strings.TrimPrefix(header, captureHeader)) {
+		if name, ok := strings.CutPrefix(field, "profile="); ok {
+			profile = name
+		}
+	}
+
+	var reports []CapturedReport
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		offsetText, dataText, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, "", fmt.Errorf("line %d: missing report data", line)
+		}
+		nanos, err := strconv.ParseInt(offsetText, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: invalid time offset: %w", line, err)
+		}
+		data, err := hex.DecodeString(dataText)
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: invalid report data: %w", line, err)
+		}
+
+		reports = append(reports, CapturedReport{Offset: time.Duration(nanos), Data: data})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to read capture: %w", err)
+	}
+
+	return reports, profile, nil
+}
+
+// ReplayDevice plays back captured reports as if they came from a tablet
+type ReplayDevice struct {
+	mu      sync.Mutex
+	reports []CapturedReport
+	next    int
+	speed   float64 // Playback speed, 0 replays as fast as possible
+	start   time.Time
+	closed  bool
+}
+
+// NewReplayDevice creates a device that replays the reports at the given
+// speed relative to the original timing
+func NewReplayDevice(reports []CapturedReport, speed float64) *ReplayDevice {
+	return &ReplayDevice{
+		reports: reports,
+		speed:   speed,
+	}
+}
+
+// Read returns the next report once its time has come, or io.EOF after the
+// last report
+func (rd *ReplayDevice) Read(b []byte) (int, error) {
+	rd.mu.Lock()
+	if rd.closed {
+		rd.mu.Unlock()
+		return 0, fmt.Errorf("replay device closed")
+	}
+	if rd.next >= len(rd.reports) {
+		rd.mu.Unlock()
+		return 0, io.EOF
+	}
+	if rd.start.IsZero() {
+		rd.start = time.Now()
+	}
+	report := rd.reports[rd.next]
+	rd.next++
+	start := rd.start
+	rd.mu.Unlock()
+
+	if rd.speed > 0 {
+		due := start.Add(time.Duration(float64(report.Offset) / rd.speed))
+		time.Sleep(time.Until(due))
+	}
+
+	return copy(b, report.Data), nil
+}
+
+// Write discards output reports; a replay has nothing to configure
+func (rd *ReplayDevice) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Close stops the replay
+func (rd *ReplayDevice) Close() error {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.closed = true
+	return nil
+}
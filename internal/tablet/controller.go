@@ -1,11 +1,22 @@
 package tablet
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/karalabe/hid"
+
+	"xp-pen-controller/internal/logging"
 )
 
+var logger = logging.For(logging.Tablet)
+
 const (
 	// XP-Pen Star G640 identifiers
 	VendorID  = 0x28bd // XP-Pen vendor ID
@@ -14,153 +25,356 @@ const (
 
 // PenData represents the state of the pen at a given moment
 type PenData struct {
-	X        int  // X coordinate (0-32767)
-	Y        int  // Y coordinate (0-32767)
-	Pressure int  // Pressure level (0-8191)
-	PenDown  bool // Whether pen is touching the tablet
-	InRange  bool // Whether pen is in proximity to tablet
-	Button1  bool // First pen button pressed
-	Button2  bool // Second pen button pressed
+	X        int       // X coordinate (0-32767)
+	Y        int       // Y coordinate (0-32767)
+	Pressure int       // Pressure level (0-8191)
+	PenDown  bool      // Whether pen is touching the tablet
+	InRange  bool      // Whether pen is in proximity to tablet
+	Button1  bool      // First pen button pressed
+	Button2  bool      // Second pen button pressed
+	TiltX    int       // Tilt to the right in degrees, valid if HasTilt
+	TiltY    int       // Tilt towards the user in degrees, valid if HasTilt
+	HasTilt  bool      // Whether the pen reports tilt
+	Eraser   bool      // Whether the eraser end of the pen is in use
+	Time     time.Time // When the report was read, with a monotonic clock reading
+}
+
+// ReportDevice is a source of raw HID reports, such as an open HID device
+// or a recorded capture being replayed
+type ReportDevice interface {
+	Read(b []byte) (int, error)
+	Write(b []byte) (int, error)
+	Close() error
 }
 
 // TabletController handles communication with the XP-Pen tablet
 type TabletController struct {
-	device *hid.Device
-	active bool
+	mu         sync.Mutex   // Guards active
+	device     ReportDevice // Pen interface, which receives the handshake
+	devices    []ReportDevice
+	active     bool
+	profile    Profile
+	devicePath string         // Optional HID path that overrides enumeration
+	info       hid.DeviceInfo // Device opened by Connect
+	params     *DeviceParams  // Ranges read from the device, if available
+
+	reports chan readResult // Reports from all open interfaces
+	done    chan struct{}   // Closed on disconnect to stop the readers
+	stats   ReportStats     // Guarded by mu
+
+	keys       []bool // Express keys held down
+	keyHandler func(KeyEvent)
+}
+
+// readResult is a report or error read from one interface
+type readResult struct {
+	data    []byte
+	err     error
+	primary bool      // Read from the pen interface
+	time    time.Time // When the read returned
 }
 
 // NewTabletController creates a new tablet controller
 func NewTabletController() *TabletController {
 	return &TabletController{
-		active: false,
+		active:  false,
+		profile: DefaultProfile,
 	}
 }
 
-// Connect establishes connection to the XP-Pen tablet
+// SetProfile selects the tablet model to connect to and decode.
+// It must be called before Connect.
+func (tc *TabletController) SetProfile(profile Profile) {
+	tc.profile = profile
+}
+
+// Profile returns the profile used to decode reports
+func (tc *TabletController) Profile() Profile {
+	return tc.profile
+}
+
+// SetDevicePath restricts Connect to the HID device with the given path
+func (tc *TabletController) SetDevicePath(path string) {
+	tc.devicePath = path
+}
+
+// ConnectDevice uses an already opened report device instead of
+// enumerating HID devices, e.g. to replay a capture
+func (tc *TabletController) ConnectDevice(device ReportDevice) {
+	tc.start([]ReportDevice{device})
+}
+
+// Connect opens every interface of the XP-Pen tablet. The pen and the
+// express keys may report on different interfaces, so all of them are read
+// concurrently.
 func (tc *TabletController) Connect() error {
-	devices := hid.Enumerate(VendorID, ProductID)
+	var devices []hid.DeviceInfo
+	if tc.devicePath != "" {
+		// An explicit path may belong to a model without a profile yet.
+		// The other interfaces of the same tablet are opened as well.
+		devices = siblingInterfaces(hid.Enumerate(0, 0), tc.devicePath)
+	} else {
+		devices = hid.Enumerate(tc.profile.VendorID, tc.profile.ProductID)
+	}
 	if len(devices) == 0 {
-		return fmt.Errorf("XP-Pen tablet not found")
+		return fmt.Errorf("XP-Pen tablet not found (profile %s)", tc.profile.Name)
 	}
 
-	fmt.Printf("DEBUG: Found %d tablet devices, trying to connect...\n", len(devices))
+	logger.Info("found tablet devices", "count", len(devices))
 
-	// Print detailed info about each device
+	// Log detailed info about each device
 	for i, deviceInfo := range devices {
-		fmt.Printf("DEBUG: Device %d details:\n", i+1)
-		fmt.Printf("  VendorID: 0x%04x\n", deviceInfo.VendorID)
-		fmt.Printf("  ProductID: 0x%04x\n", deviceInfo.ProductID)
-		fmt.Printf("  Manufacturer: '%s'\n", deviceInfo.Manufacturer)
-		fmt.Printf("  Product: '%s'\n", deviceInfo.Product)
-		fmt.Printf("  Serial: '%s'\n", deviceInfo.Serial)
-		fmt.Printf("  Path: '%s'\n", deviceInfo.Path)
-		fmt.Printf("  Interface: %d\n", deviceInfo.Interface)
-		fmt.Printf("  Usage Page: 0x%04x\n", deviceInfo.UsagePage)
-		fmt.Printf("  Usage: 0x%04x\n", deviceInfo.Usage)
-		fmt.Println()
-	}
-
-	// Try to open each device until we find one that works
-	// Prefer digitizer devices (Usage Page 0x000d) first
-	var lastError error
+		logger.Debug("tablet device",
+			"index", i+1,
+			"vendor", fmt.Sprintf("0x%04x", deviceInfo.VendorID),
+			"product", fmt.Sprintf("0x%04x", deviceInfo.ProductID),
+			"manufacturer", deviceInfo.Manufacturer,
+			"name", deviceInfo.Product,
+			"serial", deviceInfo.Serial,
+			"path", deviceInfo.Path,
+			"interface", deviceInfo.Interface,
+			"usagePage", fmt.Sprintf("0x%04x", deviceInfo.UsagePage),
+			"usage", fmt.Sprintf("0x%04x", deviceInfo.Usage),
+		)
+	}
+
+	// Open digitizer devices (Usage Page 0x000d) first so the pen interface
+	// becomes the primary device, unless a path was chosen explicitly
+	sort.SliceStable(devices, func(i, j int) bool {
+		if tc.devicePath != "" {
+			return devices[i].Path == tc.devicePath && devices[j].Path != tc.devicePath
+		}
+		return devices[i].UsagePage == 0x000d && devices[j].UsagePage != 0x000d
+	})
 
-	// First pass: try digitizer devices only
+	var opened []ReportDevice
+	var primary hid.DeviceInfo
+	var lastError error
+	seen := map[string]bool{}
 	for i, deviceInfo := range devices {
-		if deviceInfo.UsagePage == 0x000d { // Digitizer usage page
-			fmt.Printf("DEBUG: Trying DIGITIZER device %d (Interface %d, UsagePage 0x%04x, Usage 0x%04x)...\n",
-				i+1, deviceInfo.Interface, deviceInfo.UsagePage, deviceInfo.Usage)
+		// Some platforms list an interface once per top-level collection
+		if seen[deviceInfo.Path] {
+			continue
+		}
+		seen[deviceInfo.Path] = true
 
-			device, err := deviceInfo.Open()
-			if err != nil {
-				fmt.Printf("DEBUG: Failed to open digitizer device %d: %v\n", i+1, err)
-				lastError = err
-				continue
-			}
+		device, err := deviceInfo.Open()
+		if err != nil {
+			logger.Warn("failed to open device", "index", i+1, "interface", deviceInfo.Interface, "err", err)
+			lastError = err
+			continue
+		}
 
-			// Successfully opened
-			tc.device = device
-			tc.active = true
-			fmt.Printf("DEBUG: Successfully connected to DIGITIZER device %d\n", i+1)
-			return nil
+		if len(opened) == 0 {
+			primary = deviceInfo
 		}
+		opened = append(opened, hidDevice{device, deviceInfo.Path})
+		logger.Info("connected to device", "index", i+1, "interface", deviceInfo.Interface, "path", deviceInfo.Path)
+	}
+	if len(opened) == 0 {
+		return fmt.Errorf("failed to open any tablet device: %w", lastError)
 	}
 
-	// Second pass: try any remaining devices
-	for i, deviceInfo := range devices {
-		if deviceInfo.UsagePage != 0x000d { // Skip digitizer devices (already tried)
-			fmt.Printf("DEBUG: Trying OTHER device %d (Interface %d, UsagePage 0x%04x, Usage 0x%04x)...\n",
-				i+1, deviceInfo.Interface, deviceInfo.UsagePage, deviceInfo.Usage)
+	tc.info = primary
+	tc.params = nil
+	tc.start(opened)
+	tc.initialize()
+	return nil
+}
 
-			device, err := deviceInfo.Open()
-			if err != nil {
-				fmt.Printf("DEBUG: Failed to open device %d: %v\n", i+1, err)
-				lastError = err
-				continue
+// start begins reading reports from the devices. The first device is the
+// pen interface.
+func (tc *TabletController) start(devices []ReportDevice) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.device = devices[0]
+	tc.devices = devices
+	tc.keys = nil
+	tc.stats = ReportStats{}
+	tc.reports = make(chan readResult, 256)
+	tc.done = make(chan struct{})
+	tc.active = true
+
+	for i, device := range devices {
+		go tc.readLoop(device, i == 0, tc.reports, tc.done)
+	}
+}
+
+// readLoop forwards the reports of one device until disconnected. It stops
+// at the end of a capture and once the device is gone, which is reported
+// as ErrDisconnected.
+func (tc *TabletController) readLoop(device ReportDevice, primary bool, reports chan<- readResult, done <-chan struct{}) {
+	failures := 0
+	for {
+		// XP-Pen reports are typically 8-12 bytes
+		data := make([]byte, 64)
+		n, err := device.Read(data)
+		result := readResult{data: data[:n], err: err, primary: primary, time: time.Now()}
+		last := false
+		if err != nil {
+			result.data = nil
+			failures++
+			switch {
+			case errors.Is(err, io.EOF):
+				last = true
+			case deviceGone(err) || failures >= maxReadErrors:
+				// An unplugged tablet fails every read from now on
+				result.err = fmt.Errorf("%w: %w", ErrDisconnected, err)
+				last = true
 			}
+		} else {
+			failures = 0
+		}
 
-			// Successfully opened
-			tc.device = device
-			tc.active = true
-			fmt.Printf("DEBUG: Successfully connected to device %d\n", i+1)
-			return nil
+		select {
+		case reports <- result:
+		case <-done:
+			return
+		}
+		if last {
+			return
 		}
 	}
+}
+
+// DeviceParams returns the ranges reported by the device during the
+// handshake, or nil if it did not report any
+func (tc *TabletController) DeviceParams() *DeviceParams {
+	return tc.params
+}
 
-	return fmt.Errorf("failed to open any tablet device: %w", lastError)
+// DeviceInfo describes the HID device opened by Connect. It is empty for
+// devices connected with ConnectDevice.
+func (tc *TabletController) DeviceInfo() hid.DeviceInfo {
+	return tc.info
 }
 
 // Disconnect closes the connection to the tablet
 func (tc *TabletController) Disconnect() error {
-	if tc.device != nil {
-		tc.active = false
-		return tc.device.Close()
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.active {
+		return nil
 	}
-	return nil
+	tc.active = false
+	close(tc.done)
+
+	var firstErr error
+	for _, device := range tc.devices {
+		if err := device.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // IsConnected returns whether the tablet is currently connected
 func (tc *TabletController) IsConnected() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 	return tc.active && tc.device != nil
 }
 
-// ReadPenData reads the current pen state from the tablet
-func (tc *TabletController) ReadPenData() (*PenData, error) {
+// ReadReport reads the next raw report from any interface of the tablet
+func (tc *TabletController) ReadReport() ([]byte, error) {
+	result, err := tc.nextReport()
+	if err != nil {
+		return nil, err
+	}
+	return result.data, nil
+}
+
+// nextReport waits for the next report from any interface
+func (tc *TabletController) nextReport() (readResult, error) {
 	if !tc.IsConnected() {
-		return nil, fmt.Errorf("tablet not connected")
+		return readResult{}, ErrDisconnected
 	}
 
-	// Read raw data from the tablet
-	data := make([]byte, 12) // XP-Pen reports are typically 8-12 bytes
-	n, err := tc.device.Read(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read from tablet: %w", err)
+	var result readResult
+	select {
+	case result = <-tc.reports:
+	case <-tc.done:
+		return readResult{}, ErrDisconnected
+	}
+	if errors.Is(result.err, ErrDisconnected) {
+		logger.Warn("tablet stopped responding, disconnecting", "err", result.err)
+		tc.Disconnect()
+		return readResult{}, result.err
+	}
+	if result.err != nil {
+		return readResult{}, fmt.Errorf("failed to read from tablet: %w", result.err)
 	}
 
-	if n < 8 {
-		return nil, fmt.Errorf("insufficient data received: %d bytes", n)
+	// Per-report logging is guarded so it costs nothing when disabled
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		logger.Debug("raw report", "bytes", len(result.data), "primary", result.primary, "data", fmt.Sprintf("% x", result.data))
 	}
 
-	// Debug: Print raw data bytes
-	fmt.Printf("DEBUG: Raw tablet data (%d bytes): %02x %02x %02x %02x %02x %02x %02x %02x\n",
-		n, data[0], data[1], data[2], data[3], data[4], data[5], data[6], data[7])
+	return result, nil
+}
 
-	// Parse the pen data based on XP-Pen protocol
-	// Note: This parsing may need adjustment based on actual tablet output
-	penData := &PenData{
-		X:        int(data[2]) | (int(data[3]) << 8),
-		Y:        int(data[4]) | (int(data[5]) << 8),
-		Pressure: int(data[6]) | (int(data[7]) << 8),
-		PenDown:  (data[1] & 0x01) != 0,
-		InRange:  (data[1] & 0x02) != 0,
-		Button1:  (data[1] & 0x04) != 0, // Check bit 2 for button 1
-		Button2:  (data[1] & 0x08) != 0, // Check bit 3 for button 2
-	}
+// ReadPenData reads the current pen state from the tablet. Express key
+// reports received in between are passed to the key handler, and reports
+// no decoder claims are counted and skipped.
+func (tc *TabletController) ReadPenData() (*PenData, error) {
+	for {
+		result, err := tc.nextReport()
+		if err != nil {
+			return nil, err
+		}
 
-	return penData, nil
+		switch tc.classify(result) {
+		case reportKeys:
+			tc.count(reportKeys, result.data)
+			tc.handleKeys(tc.profile.Keys.Decode(result.data))
+		case reportPen:
+			tc.count(reportPen, result.data)
+			// Parse the pen data using the report layout of the profile
+			pen, err := tc.profile.Layout.Decode(result.data)
+			if err != nil {
+				return nil, err
+			}
+			pen.Time = result.time
+			return pen, nil
+		default:
+			tc.count(reportUnknown, result.data)
+		}
+	}
 }
 
 // GetTabletDimensions returns the tablet's maximum coordinates
 func (tc *TabletController) GetTabletDimensions() (int, int) {
-	// XP-Pen Star G640 specifications
-	return 32767, 32767 // Maximum X, Y coordinates
+	return tc.profile.MaxX, tc.profile.MaxY
+}
+
+// GetMaxPressure returns the tablet's maximum pressure level
+func (tc *TabletController) GetMaxPressure() int {
+	return tc.profile.MaxPressure
+}
+
+// siblingInterfaces returns the device with the given path together with
+// the other interfaces of the same physical tablet, recognised by their
+// vendor, product and serial number
+func siblingInterfaces(devices []hid.DeviceInfo, path string) []hid.DeviceInfo {
+	var target *hid.DeviceInfo
+	for i := range devices {
+		if devices[i].Path == path {
+			target = &devices[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+
+	var matching []hid.DeviceInfo
+	for _, device := range devices {
+		if device.Path == path || (device.VendorID == target.VendorID &&
+			device.ProductID == target.ProductID && device.Serial == target.Serial) {
+			matching = append(matching, device)
+		}
+	}
+	return matching
 }
@@ -0,0 +1,117 @@
+package tablet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unpluggedDevice returns its reports, then fails every read the way
+// hidapi does once the tablet is pulled out: with an error that does not
+// say why
+type unpluggedDevice struct {
+	mu      sync.Mutex
+	reports [][]byte
+	failed  int // Reads that failed
+	closed  bool
+}
+
+func (d *unpluggedDevice) Read(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.reports) > 0 {
+		n := copy(b, d.reports[0])
+		d.reports = d.reports[1:]
+		return n, nil
+	}
+	d.failed++
+	return 0, errors.New("hidapi: read error")
+}
+
+func (d *unpluggedDevice) Write(b []byte) (int, error) { return len(b), nil }
+
+func (d *unpluggedDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+// g640Report is a Star G640 pen report
+func g640Report(x, y, pressure int, flags byte) []byte {
+	return []byte{0x07, flags, byte(x), byte(x >> 8), byte(y), byte(y >> 8), byte(pressure), byte(pressure >> 8)}
+}
+
+// readWithin reads the next sample, failing the test if it blocks
+func readWithin(t *testing.T, source PenSource) (*PenData, error) {
+	t.Helper()
+	type result struct {
+		pen *PenData
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		pen, err := source.ReadPenData()
+		done <- result{pen, err}
+	}()
+	select {
+	case r := <-done:
+		return r.pen, r.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the pen blocked")
+		return nil, nil
+	}
+}
+
+func TestUnpluggedMidStrokeDisconnects(t *testing.T) {
+	device := &unpluggedDevice{reports: [][]byte{
+		g640Report(100, 100, 0, 0x02),
+		g640Report(110, 100, 2000, 0x03),
+		g640Report(120, 100, 2500, 0x03),
+	}}
+	tc := NewTabletController()
+	tc.ConnectDevice(device)
+	tracker := NewPenTracker(0)
+
+	for range 3 {
+		pen, err := readWithin(t, tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.Update(pen)
+	}
+	if tracker.State() != PenContact {
+		t.Fatalf("state %v before unplugging, want contact", tracker.State())
+	}
+
+	// The failing reads end in a disconnect instead of errors forever
+	var err error
+	for range maxReadErrors {
+		if _, err = readWithin(t, tc); err == nil || errors.Is(err, ErrDisconnected) {
+			break
+		}
+	}
+	if !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("read after unplugging returned %v, want ErrDisconnected", err)
+	}
+	tracker.Reset()
+	if tracker.State() != PenOut {
+		t.Errorf("state %v after the disconnect, want out", tracker.State())
+	}
+	if tc.IsConnected() {
+		t.Error("controller still connected")
+	}
+	if _, err := readWithin(t, tc); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("read after the disconnect returned %v, want ErrDisconnected", err)
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	if !device.closed {
+		t.Error("device not closed")
+	}
+	if device.failed != maxReadErrors {
+		t.Errorf("device read %d times after failing, want %d", device.failed, maxReadErrors)
+	}
+}
@@ -1,20 +1,43 @@
 package tablet
 
-import "xp-pen-controller/internal/drawing"
+import (
+	"math"
+
+	"xp-pen-controller/internal/drawing"
+)
 
 // CoordinateMapper handles transformation between tablet and screen coordinates
 type CoordinateMapper struct {
 	tabletMaxX, tabletMaxY    int     // Tablet coordinate bounds
-	screenWidth, screenHeight float64 // Screen dimensions
+	screenWidth, screenHeight float64 // Canvas dimensions the tablet surface maps onto
+	maxPressure               int     // Tablet pressure range
+	pressureCurve             float64 // Exponent applied to normalized pressure
 }
 
 // NewCoordinateMapper creates a new coordinate mapper
 func NewCoordinateMapper(tabletMaxX, tabletMaxY int, screenWidth, screenHeight float64) *CoordinateMapper {
 	return &CoordinateMapper{
-		tabletMaxX:   tabletMaxX,
-		tabletMaxY:   tabletMaxY,
-		screenWidth:  screenWidth,
-		screenHeight: screenHeight,
+		tabletMaxX:    tabletMaxX,
+		tabletMaxY:    tabletMaxY,
+		screenWidth:   screenWidth,
+		screenHeight:  screenHeight,
+		maxPressure:   DefaultProfile.MaxPressure,
+		pressureCurve: 1,
+	}
+}
+
+// SetPressureCurve shapes the pressure response: values above 1 need a
+// firmer touch for the same width, values below 1 a lighter one
+func (cm *CoordinateMapper) SetPressureCurve(exponent float64) {
+	if exponent > 0 {
+		cm.pressureCurve = exponent
+	}
+}
+
+// SetMaxPressure sets the largest pressure value reported by the tablet
+func (cm *CoordinateMapper) SetMaxPressure(maxPressure int) {
+	if maxPressure > 0 {
+		cm.maxPressure = maxPressure
 	}
 }
 
@@ -42,10 +65,7 @@ func (cm *CoordinateMapper) TabletToScreen(tabletX, tabletY int) (float64, float
 
 // NormalizePressure converts raw pressure to normalized 0.0-1.0 range
 func (cm *CoordinateMapper) NormalizePressure(rawPressure int) float64 {
-	// XP-Pen tablets typically have pressure range 0-8191
-	const maxPressure = 8191
-
-	pressure := float64(rawPressure) / float64(maxPressure)
+	pressure := float64(rawPressure) / float64(cm.maxPressure)
 
 	// Clamp to valid range
 	if pressure < 0 {
@@ -54,17 +74,26 @@ func (cm *CoordinateMapper) NormalizePressure(rawPressure int) float64 {
 		pressure = 1
 	}
 
+	if cm.pressureCurve != 1 {
+		pressure = math.Pow(pressure, cm.pressureCurve)
+	}
 	return pressure
 }
 
-// PenDataToPoint converts raw pen data to a drawing point
+// PenDataToPoint converts raw pen data to a drawing point in canvas units
 func (cm *CoordinateMapper) PenDataToPoint(penData *PenData) drawing.Point {
 	x, y := cm.TabletToScreen(penData.X, penData.Y)
 	pressure := cm.NormalizePressure(penData.Pressure)
 
-	return drawing.Point{
-		X:        x,
-		Y:        y,
+	point := drawing.Point{
+		X:        x * cm.screenWidth,
+		Y:        y * cm.screenHeight,
 		Pressure: pressure,
+		Time:     penData.Time,
+	}
+	if penData.HasTilt {
+		// The canvas is not rotated relative to the tablet, so tilt carries over
+		point.Tilt = &drawing.Tilt{X: float64(penData.TiltX), Y: float64(penData.TiltY)}
 	}
+	return point
 }
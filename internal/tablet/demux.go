@@ -0,0 +1,87 @@
+package tablet
+
+// reportKind is the decoder a report is dispatched to
+type reportKind int
+
+const (
+	reportUnknown reportKind = iota
+	reportPen
+	reportKeys
+)
+
+// ReportStats counts the reports received, by the decoder that handled them
+type ReportStats struct {
+	Pen        int
+	Keys       int
+	Unknown    int
+	UnknownIDs map[uint8]int // Unknown reports by report ID (the first byte)
+}
+
+// classify decides which decoder handles a report. Express key reports are
+// recognised first since they often share the report ID of the pen. A pen
+// layout without a report ID only accepts reports from the pen interface,
+// so reports of other interfaces are never misread as pen data.
+func (tc *TabletController) classify(result readResult) reportKind {
+	data := result.data
+	if len(data) == 0 {
+		return reportUnknown
+	}
+
+	if keys := tc.profile.Keys; keys != nil && keys.Match.Matches(data) {
+		return reportKeys
+	}
+
+	layout := tc.profile.Layout
+	if layout.ReportID == 0 {
+		if result.primary {
+			return reportPen
+		}
+		return reportUnknown
+	}
+	if data[0] == layout.ReportID {
+		return reportPen
+	}
+	return reportUnknown
+}
+
+// count records a dispatched report
+func (tc *TabletController) count(kind reportKind, data []byte) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	switch kind {
+	case reportPen:
+		tc.stats.Pen++
+	case reportKeys:
+		tc.stats.Keys++
+	default:
+		tc.stats.Unknown++
+		id := uint8(0)
+		if len(data) > 0 {
+			id = data[0]
+		}
+		if tc.stats.UnknownIDs == nil {
+			tc.stats.UnknownIDs = map[uint8]int{}
+		}
+		tc.stats.UnknownIDs[id]++
+
+		// Warn once per report ID; the counter keeps track of the rest
+		if tc.stats.UnknownIDs[id] == 1 {
+			logger.Warn("ignoring reports with unknown report ID", "reportId", id, "bytes", len(data))
+		}
+	}
+}
+
+// ReportStats returns the number of reports handled by each decoder since
+// connecting
+func (tc *TabletController) ReportStats() ReportStats {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	stats := tc.stats
+	stats.UnknownIDs = make(map[uint8]int, len(tc.stats.UnknownIDs))
+	for id, n := range tc.stats.UnknownIDs {
+		stats.UnknownIDs[id] = n
+	}
+	return stats
+}
@@ -0,0 +1,245 @@
+package tablet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"xp-pen-controller/internal/input"
+)
+
+// AbsRange is the range of an absolute axis as reported by the kernel
+type AbsRange struct {
+	Min, Max int
+}
+
+// EvdevRanges are the axis ranges of an input device. Tilt ranges are nil
+// if the pen does not report tilt.
+type EvdevRanges struct {
+	X, Y, Pressure AbsRange
+	TiltX, TiltY   *AbsRange
+}
+
+// EvdevSource reads pen samples from a Linux input event device, for
+// tablets that the kernel driver has already claimed
+type EvdevSource struct {
+	mu     sync.Mutex // Guards active
+	r      io.ReadCloser
+	name   string
+	ranges EvdevRanges
+	active bool
+
+	state   PenData // Accumulated since the last sync
+	dropped bool    // Events were lost; resync at the next sync
+	query   evdevQuery
+	buf     []byte
+	failed  int // Failed reads in a row
+
+	grab    func(on bool) error // Grabs or releases the device, nil if it cannot
+	grabbed bool                // Guarded by mu
+}
+
+// evdevQuery reads the current state of an input device from the kernel,
+// to recover the events lost when its buffer overflowed
+type evdevQuery interface {
+	// Keys returns the bitmask of pressed keys, indexed by key code
+	Keys() ([]byte, error)
+	// Abs returns the current value of an absolute axis
+	Abs(code uint16) (int32, error)
+}
+
+var _ PenSource = (*EvdevSource)(nil)
+
+// NewEvdevSource reads input events from r, which is usually an open
+// /dev/input/event* device but may be any stream of input_event structs
+func NewEvdevSource(r io.ReadCloser, name string, ranges EvdevRanges) *EvdevSource {
+	return &EvdevSource{
+		r:      r,
+		name:   name,
+		ranges: ranges,
+		active: true,
+		state:  PenData{HasTilt: ranges.TiltX != nil && ranges.TiltY != nil},
+		buf:    make([]byte, input.EventSize),
+	}
+}
+
+// Name returns the name of the input device
+func (es *EvdevSource) Name() string {
+	return es.name
+}
+
+// ReadPenData reads events until the next sync and returns the pen state
+func (es *EvdevSource) ReadPenData() (*PenData, error) {
+	for {
+		event, err := input.Read(es.r, es.buf)
+		if err != nil {
+			es.failed++
+			if !errors.Is(err, io.EOF) && (deviceGone(err) || es.failed >= maxReadErrors) {
+				// The device was unplugged or closed
+				es.Disconnect()
+				return nil, fmt.Errorf("%w: %w", ErrDisconnected, err)
+			}
+			return nil, err
+		}
+		es.failed = 0
+
+		switch event.Type {
+		case input.EvSyn:
+			switch event.Code {
+			case input.SynReport:
+				if es.dropped {
+					// The events up to this sync are incomplete, so the
+					// state is read back from the kernel instead
+					es.dropped = false
+					if err := es.resync(); err != nil {
+						logger.Debug("cannot resync after dropped events", "device", es.name, "err", err)
+						continue
+					}
+				}
+				pen := es.state
+				pen.Time = time.Now()
+				return &pen, nil
+			case input.SynDropped:
+				es.dropped = true
+			}
+		case input.EvAbs:
+			if !es.dropped {
+				es.applyAbs(event.Code, event.Value)
+			}
+		case input.EvKey:
+			if !es.dropped {
+				es.applyKey(event.Code, event.Value != 0)
+			}
+		}
+	}
+}
+
+// resync replaces the state with the one the kernel reports, so that a
+// button release or lift lost with the dropped events does not leave the
+// pen stuck down
+func (es *EvdevSource) resync() error {
+	if es.query == nil {
+		return fmt.Errorf("device state cannot be queried")
+	}
+	keys, err := es.query.Keys()
+	if err != nil {
+		return fmt.Errorf("failed to read key state: %w", err)
+	}
+	pressed := func(code uint16) bool {
+		return int(code/8) < len(keys) && keys[code/8]&(1<<(code%8)) != 0
+	}
+
+	axes := []uint16{input.AbsX, input.AbsY, input.AbsPressure}
+	if es.state.HasTilt {
+		axes = append(axes, input.AbsTiltX, input.AbsTiltY)
+	}
+	values := make([]int32, len(axes))
+	for i, code := range axes {
+		if values[i], err = es.query.Abs(code); err != nil {
+			return fmt.Errorf("failed to read axis %#x: %w", code, err)
+		}
+	}
+
+	es.state.Eraser = pressed(input.BtnToolRubber)
+	es.state.InRange = pressed(input.BtnToolPen) || es.state.Eraser
+	es.state.PenDown = pressed(input.BtnTouch)
+	es.state.Button1 = pressed(input.BtnStylus)
+	es.state.Button2 = pressed(input.BtnStylus2)
+	for i, code := range axes {
+		es.applyAbs(code, values[i])
+	}
+	return nil
+}
+
+// applyAbs updates the state from an absolute axis event. Positions are
+// shifted so they start at zero like HID reports.
+func (es *EvdevSource) applyAbs(code uint16, value int32) {
+	v := int(value)
+	switch code {
+	case input.AbsX:
+		es.state.X = v - es.ranges.X.Min
+	case input.AbsY:
+		es.state.Y = v - es.ranges.Y.Min
+	case input.AbsPressure:
+		es.state.Pressure = v - es.ranges.Pressure.Min
+	case input.AbsTiltX:
+		es.state.TiltX = v
+	case input.AbsTiltY:
+		es.state.TiltY = v
+	}
+}
+
+// applyKey updates the state from a button or tool event
+func (es *EvdevSource) applyKey(code uint16, pressed bool) {
+	switch code {
+	case input.BtnToolPen:
+		es.state.InRange = pressed
+		if pressed {
+			es.state.Eraser = false
+		}
+	case input.BtnToolRubber:
+		es.state.InRange = pressed
+		es.state.Eraser = pressed
+	case input.BtnTouch:
+		es.state.PenDown = pressed
+	case input.BtnStylus:
+		es.state.Button1 = pressed
+	case input.BtnStylus2:
+		es.state.Button2 = pressed
+	}
+}
+
+// GetTabletDimensions returns the largest X and Y values of the samples
+func (es *EvdevSource) GetTabletDimensions() (int, int) {
+	return es.ranges.X.Max - es.ranges.X.Min, es.ranges.Y.Max - es.ranges.Y.Min
+}
+
+// GetMaxPressure returns the largest pressure value of the samples
+func (es *EvdevSource) GetMaxPressure() int {
+	return es.ranges.Pressure.Max - es.ranges.Pressure.Min
+}
+
+// IsConnected returns whether the device is still open
+func (es *EvdevSource) IsConnected() bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.active
+}
+
+// Grab makes the source the only reader of the input device, so that other
+// applications stop receiving the pen from the kernel. Disconnect releases
+// it.
+func (es *EvdevSource) Grab() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.grab == nil {
+		return fmt.Errorf("%s cannot be grabbed", es.name)
+	}
+	if !es.active {
+		return ErrDisconnected
+	}
+	if err := es.grab(true); err != nil {
+		return fmt.Errorf("failed to grab %s: %w", es.name, err)
+	}
+	es.grabbed = true
+	return nil
+}
+
+// Disconnect releases and closes the input device
+func (es *EvdevSource) Disconnect() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if !es.active {
+		return nil
+	}
+	es.active = false
+	if es.grabbed {
+		es.grab(false)
+		es.grabbed = false
+	}
+	return es.r.Close()
+}
@@ -0,0 +1,242 @@
+//go:build linux
+
+package tablet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"xp-pen-controller/internal/input"
+)
+
+// Input device ioctls, from linux/input.h
+const (
+	evdevIoctlType  = 'E'
+	eviocgnameNr    = 0x06
+	eviocgkeyNr     = 0x18
+	eviocgabsNr     = 0x40
+	eviocgrabNr     = 0x90
+	inputNameLength = 256
+	keyMax          = 0x2ff // Largest key code, KEY_MAX
+)
+
+// EvdevDevice describes an input event device
+type EvdevDevice struct {
+	Path string
+	Name string
+}
+
+// ListEvdev lists the input event devices and their names. Devices that
+// cannot be opened are listed with the name from sysfs.
+func ListEvdev() ([]EvdevDevice, error) {
+	paths, err := filepath.Glob("/dev/input/event*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list input devices: %w", err)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return eventNumber(paths[i]) < eventNumber(paths[j])
+	})
+
+	devices := make([]EvdevDevice, 0, len(paths))
+	for _, path := range paths {
+		name, _ := os.ReadFile(filepath.Join("/sys/class/input", filepath.Base(path), "device/name"))
+		devices = append(devices, EvdevDevice{Path: path, Name: strings.TrimSpace(string(name))})
+	}
+	return devices, nil
+}
+
+// FindEvdev returns the path of the pen input device whose name contains
+// the given text, ignoring case. The kernel registers a tablet as several
+// devices, so names mentioning "Pen" are preferred.
+func FindEvdev(name string) (string, error) {
+	devices, err := ListEvdev()
+	if err != nil {
+		return "", err
+	}
+
+	want := strings.ToLower(name)
+	var match string
+	for _, d := range devices {
+		lower := strings.ToLower(d.Name)
+		if !strings.Contains(lower, want) {
+			continue
+		}
+		if strings.Contains(lower, "pen") || strings.Contains(lower, "stylus") {
+			return d.Path, nil
+		}
+		if match == "" {
+			match = d.Path
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("no input device named %q", name)
+	}
+	return match, nil
+}
+
+// OpenEvdev opens an input event device, given by path or by name, and
+// reads its axis ranges from the kernel
+func OpenEvdev(nameOrPath string) (*EvdevSource, error) {
+	path := nameOrPath
+	if !strings.HasPrefix(nameOrPath, "/") {
+		found, err := FindEvdev(nameOrPath)
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input device: %w", err)
+	}
+
+	name, err := deviceName(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var ranges EvdevRanges
+	for _, axis := range []struct {
+		code uint16
+		dst  *AbsRange
+	}{{input.AbsX, &ranges.X}, {input.AbsY, &ranges.Y}, {input.AbsPressure, &ranges.Pressure}} {
+		info, err := axisInfo(f, axis.code)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s is not a pen tablet: %w", path, err)
+		}
+		*axis.dst = AbsRange{Min: int(info.Minimum), Max: int(info.Maximum)}
+	}
+	if ranges.X.Max <= ranges.X.Min || ranges.Y.Max <= ranges.Y.Min || ranges.Pressure.Max <= ranges.Pressure.Min {
+		f.Close()
+		return nil, fmt.Errorf("%s reports no pen position or pressure", path)
+	}
+
+	// Tilt is optional
+	tiltX, errX := axisInfo(f, input.AbsTiltX)
+	tiltY, errY := axisInfo(f, input.AbsTiltY)
+	if errX == nil && errY == nil && tiltX.Maximum > tiltX.Minimum && tiltY.Maximum > tiltY.Minimum {
+		ranges.TiltX = &AbsRange{Min: int(tiltX.Minimum), Max: int(tiltX.Maximum)}
+		ranges.TiltY = &AbsRange{Min: int(tiltY.Minimum), Max: int(tiltY.Maximum)}
+	}
+
+	logger.Info("opened input device", "path", path, "name", name,
+		"maxX", ranges.X.Max, "maxY", ranges.Y.Max, "maxPressure", ranges.Pressure.Max, "tilt", ranges.TiltX != nil)
+	source := NewEvdevSource(f, name, ranges)
+	source.query = evdevFile{f}
+	source.grab = evdevFile{f}.Grab
+	return source, nil
+}
+
+// GrabEvdevByID grabs every input device the kernel created for a USB
+// device, so that only the caller receives its events. The kernel's
+// tablet driver then no longer moves the pointer for programs reading the
+// raw HID reports. It returns the paths grabbed and a function releasing
+// them; having no such device is not an error.
+func GrabEvdevByID(vendor, product uint16) ([]string, func(), error) {
+	paths, err := filepath.Glob("/dev/input/event*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list input devices: %w", err)
+	}
+
+	var grabbed []*os.File
+	release := func() {
+		for _, f := range grabbed {
+			evdevFile{f}.Grab(false)
+			f.Close()
+		}
+	}
+	var names []string
+	for _, path := range paths {
+		id := filepath.Join("/sys/class/input", filepath.Base(path), "device/id")
+		if readHexID(filepath.Join(id, "vendor")) != vendor || readHexID(filepath.Join(id, "product")) != product {
+			continue
+		}
+		f, err := os.Open(path)
+		if err == nil {
+			if err = (evdevFile{f}).Grab(true); err != nil {
+				f.Close()
+			}
+		}
+		if err != nil {
+			release()
+			return nil, nil, fmt.Errorf("failed to grab %s: %w", path, err)
+		}
+		grabbed = append(grabbed, f)
+		names = append(names, path)
+	}
+	return names, release, nil
+}
+
+// readHexID reads a vendor or product ID from sysfs, or 0
+func readHexID(path string) uint16 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(id)
+}
+
+// evdevFile queries the state of an open input device
+type evdevFile struct {
+	f *os.File
+}
+
+func (d evdevFile) Keys() ([]byte, error) {
+	keys := make([]byte, keyMax/8+1)
+	req := input.IOC(input.IocRead, evdevIoctlType, eviocgkeyNr, len(keys))
+	if err := input.IoctlPtr(d.f.Fd(), req, unsafe.Pointer(&keys[0])); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Grab takes or releases exclusive access to the device
+func (d evdevFile) Grab(on bool) error {
+	var arg uintptr
+	if on {
+		arg = 1
+	}
+	return input.Ioctl(d.f.Fd(), input.IOC(input.IocWrite, evdevIoctlType, eviocgrabNr, int(unsafe.Sizeof(int32(0)))), arg)
+}
+
+func (d evdevFile) Abs(code uint16) (int32, error) {
+	info, err := axisInfo(d.f, code)
+	return info.Value, err
+}
+
+// deviceName reads the name of an input device
+func deviceName(f *os.File) (string, error) {
+	buf := make([]byte, inputNameLength)
+	req := input.IOC(input.IocRead, evdevIoctlType, eviocgnameNr, len(buf))
+	if err := input.IoctlPtr(f.Fd(), req, unsafe.Pointer(&buf[0])); err != nil {
+		return "", fmt.Errorf("%s is not an input device: %w", f.Name(), err)
+	}
+	return strings.TrimRight(string(buf), "\x00"), nil
+}
+
+// axisInfo reads the range of an absolute axis
+func axisInfo(f *os.File, code uint16) (input.AbsInfo, error) {
+	var info input.AbsInfo
+	req := input.IOC(input.IocRead, evdevIoctlType, eviocgabsNr+int(code), input.AbsInfoSize)
+	err := input.IoctlPtr(f.Fd(), req, unsafe.Pointer(&info))
+	return info, err
+}
+
+// eventNumber extracts N from /dev/input/eventN for sorting
+func eventNumber(path string) int {
+	n := 0
+	fmt.Sscanf(strings.TrimPrefix(filepath.Base(path), "event"), "%d", &n)
+	return n
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package tablet
+
+import "fmt"
+
+// EvdevDevice describes an input event device
+type EvdevDevice struct {
+	Path string
+	Name string
+}
+
+// ListEvdev lists the input event devices, which only exist on Linux
+func ListEvdev() ([]EvdevDevice, error) {
+	return nil, nil
+}
+
+// OpenEvdev opens an input event device, which only exist on Linux
+func OpenEvdev(nameOrPath string) (*EvdevSource, error) {
+	return nil, fmt.Errorf("input event devices are only available on Linux")
+}
+
+// GrabEvdevByID grabs the input devices of a USB device, which only exist
+// on Linux, so there is nothing to grab
+func GrabEvdevByID(vendor, product uint16) ([]string, func(), error) {
+	return nil, func() {}, nil
+}
@@ -0,0 +1,239 @@
+package tablet
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"xp-pen-controller/internal/input"
+)
+
+// testRanges are the axes of a tablet whose coordinates do not start at 0
+var testRanges = EvdevRanges{
+	X:        AbsRange{Min: 100, Max: 32100},
+	Y:        AbsRange{Min: 50, Max: 20050},
+	Pressure: AbsRange{Min: 0, Max: 8191},
+}
+
+// fakeQuery answers state queries like the kernel would
+type fakeQuery struct {
+	keys []uint16
+	abs  map[uint16]int32
+	err  error
+}
+
+func (q fakeQuery) Keys() ([]byte, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	mask := make([]byte, 0x300/8)
+	for _, code := range q.keys {
+		mask[code/8] |= 1 << (code % 8)
+	}
+	return mask, nil
+}
+
+func (q fakeQuery) Abs(code uint16) (int32, error) {
+	return q.abs[code], q.err
+}
+
+// pipeSource returns a source reading from a pipe and a function that
+// writes events to it
+func pipeSource(t *testing.T) (*EvdevSource, func(...input.Event)) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewEvdevSource(r, "test pen", testRanges)
+	t.Cleanup(func() {
+		w.Close()
+		source.Disconnect()
+	})
+
+	send := func(events ...input.Event) {
+		var buf []byte
+		for _, e := range events {
+			buf = input.Append(buf, e)
+		}
+		if _, err := w.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return source, send
+}
+
+func key(code uint16, pressed bool) input.Event {
+	value := int32(0)
+	if pressed {
+		value = 1
+	}
+	return input.Event{Type: input.EvKey, Code: code, Value: value}
+}
+
+func abs(code uint16, value int32) input.Event {
+	return input.Event{Type: input.EvAbs, Code: code, Value: value}
+}
+
+func dropped() input.Event {
+	return input.Event{Type: input.EvSyn, Code: input.SynDropped}
+}
+
+// readPen reads the next sample and compares the pen state, ignoring time
+func readPen(t *testing.T, source *EvdevSource, want PenData) {
+	t.Helper()
+	pen, err := source.ReadPenData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pen.Time = want.Time
+	if *pen != want {
+		t.Errorf("got %+v\nwant %+v", *pen, want)
+	}
+}
+
+func TestEvdevStroke(t *testing.T) {
+	source, send := pipeSource(t)
+
+	send(key(input.BtnToolPen, true), abs(input.AbsX, 1100), abs(input.AbsY, 2050), input.Sync())
+	readPen(t, source, PenData{X: 1000, Y: 2000, InRange: true})
+
+	send(key(input.BtnTouch, true), abs(input.AbsPressure, 4000), input.Sync())
+	readPen(t, source, PenData{X: 1000, Y: 2000, Pressure: 4000, InRange: true, PenDown: true})
+
+	// Only changed axes are sent; the others keep their values
+	send(abs(input.AbsX, 1200), key(input.BtnStylus, true), input.Sync())
+	readPen(t, source, PenData{X: 1100, Y: 2000, Pressure: 4000, InRange: true, PenDown: true, Button1: true})
+
+	send(key(input.BtnTouch, false), abs(input.AbsPressure, 0), key(input.BtnStylus, false), input.Sync())
+	readPen(t, source, PenData{X: 1100, Y: 2000, InRange: true})
+
+	send(key(input.BtnToolPen, false), input.Sync())
+	readPen(t, source, PenData{X: 1100, Y: 2000})
+}
+
+func TestEvdevEraser(t *testing.T) {
+	source, send := pipeSource(t)
+
+	send(key(input.BtnToolRubber, true), input.Sync())
+	readPen(t, source, PenData{InRange: true, Eraser: true})
+
+	send(key(input.BtnToolRubber, false), key(input.BtnToolPen, true), input.Sync())
+	readPen(t, source, PenData{InRange: true})
+}
+
+func TestEvdevDroppedWithoutQuery(t *testing.T) {
+	source, send := pipeSource(t)
+
+	send(key(input.BtnToolPen, true), input.Sync())
+	readPen(t, source, PenData{InRange: true})
+
+	// The partial group after the drop is skipped
+	send(dropped(), abs(input.AbsX, 5100), input.Sync(), abs(input.AbsY, 1050), input.Sync())
+	readPen(t, source, PenData{Y: 1000, InRange: true})
+}
+
+func TestEvdevDroppedLiftIsRecovered(t *testing.T) {
+	source, send := pipeSource(t)
+	source.query = fakeQuery{
+		keys: []uint16{input.BtnToolPen},
+		abs:  map[uint16]int32{input.AbsX: 3100, input.AbsY: 4050},
+	}
+
+	send(key(input.BtnToolPen, true), key(input.BtnTouch, true), abs(input.AbsPressure, 3000), input.Sync())
+	readPen(t, source, PenData{Pressure: 3000, InRange: true, PenDown: true})
+
+	// The release of BTN_TOUCH was lost with the overflowing buffer
+	send(dropped(), abs(input.AbsX, 2100), input.Sync())
+	readPen(t, source, PenData{X: 3000, Y: 4000, InRange: true})
+}
+
+func TestEvdevDroppedQueryFails(t *testing.T) {
+	source, send := pipeSource(t)
+	source.query = fakeQuery{err: errors.New("no such device")}
+
+	send(dropped(), abs(input.AbsX, 2100), input.Sync(), abs(input.AbsY, 1050), input.Sync())
+	readPen(t, source, PenData{Y: 1000})
+}
+
+func TestEvdevClosed(t *testing.T) {
+	source, send := pipeSource(t)
+	send(key(input.BtnToolPen, true))
+	source.Disconnect()
+
+	if _, err := source.ReadPenData(); err == nil {
+		t.Error("read from a closed device succeeded")
+	}
+	if source.IsConnected() {
+		t.Error("source still connected")
+	}
+}
+
+// unpluggedReader serves events, then fails like an input device node
+// whose device was removed
+type unpluggedReader struct {
+	*bytes.Reader
+}
+
+func (r unpluggedReader) Read(b []byte) (int, error) {
+	if r.Len() == 0 {
+		return 0, syscall.ENODEV
+	}
+	return r.Reader.Read(b)
+}
+
+func (unpluggedReader) Close() error { return nil }
+
+func TestEvdevUnpluggedMidStroke(t *testing.T) {
+	var buf []byte
+	for _, e := range []input.Event{key(input.BtnToolPen, true), key(input.BtnTouch, true), abs(input.AbsPressure, 500), input.Sync()} {
+		buf = input.Append(buf, e)
+	}
+	source := NewEvdevSource(unpluggedReader{bytes.NewReader(buf)}, "test pen", testRanges)
+
+	if pen, err := source.ReadPenData(); err != nil || !pen.PenDown {
+		t.Fatalf("first sample %+v, %v; want the pen down", pen, err)
+	}
+	if _, err := source.ReadPenData(); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("read after unplugging returned %v, want ErrDisconnected", err)
+	}
+	if source.IsConnected() {
+		t.Error("source still connected")
+	}
+}
+
+func TestEvdevGrabReleasedOnDisconnect(t *testing.T) {
+	source, _ := pipeSource(t)
+	var calls []bool
+	source.grab = func(on bool) error {
+		calls = append(calls, on)
+		return nil
+	}
+
+	if err := source.Grab(); err != nil {
+		t.Fatal(err)
+	}
+	source.Disconnect()
+	if len(calls) != 2 || !calls[0] || calls[1] {
+		t.Errorf("grab calls %v, want a grab and then a release", calls)
+	}
+}
+
+func TestEvdevGrabFails(t *testing.T) {
+	source, _ := pipeSource(t)
+	if err := source.Grab(); err == nil {
+		t.Error("grabbing a stream that is no device succeeded")
+	}
+
+	source.grab = func(on bool) error { return syscall.EBUSY }
+	if err := source.Grab(); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("grabbing a busy device returned %v", err)
+	}
+	source.grab = func(on bool) error {
+		t.Error("a device that was never grabbed is released")
+		return nil
+	}
+	source.Disconnect()
+}
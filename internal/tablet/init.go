@@ -0,0 +1,131 @@
+package tablet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/karalabe/hid"
+)
+
+// XP-Pen tablets start in a compatibility mode in which the pen interface
+// sends reduced-resolution, mouse-like reports. Sending a vendor output
+// report switches them to full-resolution pen reports, and a vendor string
+// descriptor describes the real coordinate and pressure ranges. This is the
+// same handshake the Linux uclogic driver performs. The full-resolution
+// reports have a different layout, so profiles opt in to the handshake
+// together with the layout that matches it.
+
+// InitSequence describes the handshake that switches a tablet to its
+// full-resolution mode
+type InitSequence struct {
+	Report           string `json:"report,omitempty"`           // Output report to send, in hex
+	ParamsDescriptor int    `json:"paramsDescriptor,omitempty"` // String descriptor with the device parameters, 0 for none
+}
+
+// DeviceParams are the ranges reported by the tablet itself
+type DeviceParams struct {
+	MaxX         int
+	MaxY         int
+	MaxPressure  int
+	Resolution   int // Lines per inch
+	FrameButtons int // Number of express keys
+}
+
+// StringDescriptorReader is implemented by report devices that can read USB
+// string descriptors. The raw descriptor is returned, including its two
+// header bytes.
+type StringDescriptorReader interface {
+	ReadStringDescriptor(index int) ([]byte, error)
+}
+
+// hidDevice is an open HID device that can also read the string
+// descriptors of its USB device
+type hidDevice struct {
+	*hid.Device
+	path string
+}
+
+func (d hidDevice) ReadStringDescriptor(index int) ([]byte, error) {
+	return readUSBStringDescriptor(d.path, index)
+}
+
+// Validate checks that the handshake can be performed
+func (s *InitSequence) Validate() error {
+	if _, err := hex.DecodeString(s.Report); err != nil {
+		return fmt.Errorf("invalid init report: %w", err)
+	}
+	if s.ParamsDescriptor < 0 || s.ParamsDescriptor > 255 {
+		return fmt.Errorf("invalid params descriptor index %d", s.ParamsDescriptor)
+	}
+	return nil
+}
+
+// initialize performs the handshake of the profile on the connected device.
+// Every step is optional: a device that does not answer keeps working with
+// the ranges from the profile.
+func (tc *TabletController) initialize() {
+	seq := tc.profile.Init
+	if seq == nil {
+		return
+	}
+
+	if seq.Report != "" {
+		report, _ := hex.DecodeString(seq.Report)
+		if _, err := tc.device.Write(report); err != nil {
+			logger.Warn("failed to switch tablet to full-resolution mode, using compatibility mode", "err", err)
+			return
+		}
+		logger.Debug("sent full-resolution mode request", "report", fmt.Sprintf("% x", report))
+	}
+
+	if seq.ParamsDescriptor == 0 {
+		return
+	}
+	reader, ok := tc.device.(StringDescriptorReader)
+	if !ok {
+		logger.Debug("device cannot read string descriptors, using profile ranges")
+		return
+	}
+	desc, err := reader.ReadStringDescriptor(seq.ParamsDescriptor)
+	if err != nil {
+		logger.Warn("failed to read tablet parameters, using profile ranges", "err", err)
+		return
+	}
+	params, err := ParseDeviceParams(desc)
+	if err != nil {
+		logger.Warn("invalid tablet parameters, using profile ranges", "err", err)
+		return
+	}
+
+	tc.params = params
+	tc.profile.MaxX = params.MaxX
+	tc.profile.MaxY = params.MaxY
+	tc.profile.MaxPressure = params.MaxPressure
+	logger.Info("read tablet parameters",
+		"maxX", params.MaxX,
+		"maxY", params.MaxY,
+		"maxPressure", params.MaxPressure,
+		"resolution", params.Resolution,
+		"frameButtons", params.FrameButtons,
+	)
+}
+
+// ParseDeviceParams decodes the vendor parameter string descriptor
+func ParseDeviceParams(desc []byte) (*DeviceParams, error) {
+	if len(desc) < 12 {
+		return nil, fmt.Errorf("parameter descriptor too short: %d bytes", len(desc))
+	}
+
+	params := &DeviceParams{
+		MaxX:         int(binary.LittleEndian.Uint16(desc[2:])),
+		MaxY:         int(binary.LittleEndian.Uint16(desc[4:])),
+		FrameButtons: int(desc[6]),
+		MaxPressure:  int(binary.LittleEndian.Uint16(desc[8:])),
+		Resolution:   int(binary.LittleEndian.Uint16(desc[10:])),
+	}
+	if params.MaxX == 0 || params.MaxY == 0 || params.MaxPressure == 0 || params.Resolution == 0 {
+		return nil, fmt.Errorf("parameter descriptor has empty ranges")
+	}
+	return params, nil
+}
@@ -0,0 +1,202 @@
+package tablet
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeDevice is a tablet that records what is written to it and answers
+// string descriptor requests. Reads block until it is closed.
+type fakeDevice struct {
+	mu          sync.Mutex
+	written     [][]byte
+	writeErr    error
+	descriptors map[int][]byte
+	requested   []int
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func newFakeDevice() *fakeDevice {
+	return &fakeDevice{descriptors: map[int][]byte{}, closed: make(chan struct{})}
+}
+
+func (d *fakeDevice) Read(b []byte) (int, error) {
+	<-d.closed
+	return 0, errors.New("device closed")
+}
+
+func (d *fakeDevice) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.writeErr != nil {
+		return 0, d.writeErr
+	}
+	d.written = append(d.written, append([]byte{}, b...))
+	return len(b), nil
+}
+
+func (d *fakeDevice) Close() error {
+	d.closeOnce.Do(func() { close(d.closed) })
+	return nil
+}
+
+func (d *fakeDevice) ReadStringDescriptor(index int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requested = append(d.requested, index)
+	desc, ok := d.descriptors[index]
+	if !ok {
+		return nil, errors.New("pipe stalled")
+	}
+	return desc, nil
+}
+
+// reportOnlyDevice hides the descriptor support of a fake device
+type reportOnlyDevice struct {
+	ReportDevice
+}
+
+// g640Params is the parameter descriptor of a Star G640: 32000x20000,
+// no express keys, 8191 pressure levels at 5080 lines per inch
+var g640Params = []byte{0x0e, 0x03, 0x00, 0x7d, 0x20, 0x4e, 0x00, 0x00, 0xff, 0x1f, 0xd8, 0x13}
+
+// handshakeProfile is the built-in profile with the handshake enabled
+func handshakeProfile() Profile {
+	p := StarG640
+	p.Init = &InitSequence{Report: "02b004000000000000000000", ParamsDescriptor: 100}
+	return p
+}
+
+// connectFake runs the handshake of a profile against a fake device
+func connectFake(t *testing.T, profile Profile, device ReportDevice) *TabletController {
+	t.Helper()
+	tc := NewTabletController()
+	tc.SetProfile(profile)
+	tc.start([]ReportDevice{device})
+	t.Cleanup(func() { tc.Disconnect() })
+	tc.initialize()
+	return tc
+}
+
+func TestHandshakeReadsDeviceParams(t *testing.T) {
+	device := newFakeDevice()
+	device.descriptors[100] = g640Params
+	tc := connectFake(t, handshakeProfile(), device)
+
+	want := []byte{0x02, 0xb0, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if len(device.written) != 1 || !bytes.Equal(device.written[0], want) {
+		t.Errorf("wrote %x, want one report % x", device.written, want)
+	}
+	if len(device.requested) != 1 || device.requested[0] != 100 {
+		t.Errorf("requested descriptors %v, want [100]", device.requested)
+	}
+
+	params := tc.DeviceParams()
+	if params == nil || *params != (DeviceParams{MaxX: 32000, MaxY: 20000, MaxPressure: 8191, Resolution: 5080}) {
+		t.Fatalf("device params %+v", params)
+	}
+	if x, y := tc.GetTabletDimensions(); x != 32000 || y != 20000 || tc.GetMaxPressure() != 8191 {
+		t.Errorf("ranges %dx%d, pressure %d were not taken from the device", x, y, tc.GetMaxPressure())
+	}
+}
+
+func TestHandshakeFallsBackToProfileRanges(t *testing.T) {
+	failedWrite := newFakeDevice()
+	failedWrite.writeErr = errors.New("broken pipe")
+	failedWrite.descriptors[100] = g640Params
+
+	noDescriptor := newFakeDevice()
+
+	badDescriptor := newFakeDevice()
+	badDescriptor.descriptors[100] = g640Params[:8]
+
+	for name, device := range map[string]ReportDevice{
+		"write fails":            failedWrite,
+		"descriptor missing":     noDescriptor,
+		"descriptor too short":   badDescriptor,
+		"descriptors unreadable": reportOnlyDevice{newFakeDevice()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc := connectFake(t, handshakeProfile(), device)
+			if tc.DeviceParams() != nil {
+				t.Errorf("device params %+v", tc.DeviceParams())
+			}
+			if x, y := tc.GetTabletDimensions(); x != StarG640.MaxX || y != StarG640.MaxY {
+				t.Errorf("ranges %dx%d, want those of the profile", x, y)
+			}
+		})
+	}
+	if len(failedWrite.requested) != 0 {
+		t.Error("descriptor read although the mode switch failed")
+	}
+}
+
+func TestBuiltinProfileSkipsHandshake(t *testing.T) {
+	device := newFakeDevice()
+	device.descriptors[100] = g640Params
+	connectFake(t, StarG640, device)
+
+	if len(device.written) != 0 || len(device.requested) != 0 {
+		t.Errorf("handshake sent without opting in: wrote %x, requested %v", device.written, device.requested)
+	}
+}
+
+func TestFullResolutionProfileRunsHandshake(t *testing.T) {
+	profile, err := FindProfile("star-g640-full", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	device := newFakeDevice()
+	device.descriptors[100] = g640Params
+	tc := connectFake(t, *profile, device)
+
+	want := []byte{0x02, 0xb0, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if len(device.written) != 1 || !bytes.Equal(device.written[0], want) {
+		t.Errorf("wrote %x, want one report % x", device.written, want)
+	}
+	if tc.DeviceParams() == nil {
+		t.Fatal("device params were not read")
+	}
+
+	// A full-resolution report of the pen touching at (16000, 10000)
+	report := []byte{0x02, 0xa1, 0x80, 0x3e, 0x10, 0x27, 0x00, 0x10, 0, 0, 0, 0}
+	pen, err := tc.Profile().Layout.Decode(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pen.X != 16000 || pen.Y != 10000 || pen.Pressure != 4096 || !pen.PenDown || !pen.InRange || pen.Button1 {
+		t.Errorf("decoded %+v", pen)
+	}
+}
+
+func TestParseDeviceParams(t *testing.T) {
+	params, err := ParseDeviceParams(g640Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *params != (DeviceParams{MaxX: 32000, MaxY: 20000, MaxPressure: 8191, Resolution: 5080}) {
+		t.Errorf("got %+v", params)
+	}
+
+	withKeys := append([]byte{}, g640Params...)
+	withKeys[6] = 8
+	if params, err := ParseDeviceParams(withKeys); err != nil || params.FrameButtons != 8 {
+		t.Errorf("got %+v, %v, want 8 frame buttons", params, err)
+	}
+
+	if _, err := ParseDeviceParams(g640Params[:11]); err == nil {
+		t.Error("a short descriptor was accepted")
+	}
+	empty := append([]byte{}, g640Params...)
+	empty[8], empty[9] = 0, 0
+	if _, err := ParseDeviceParams(empty); err == nil {
+		t.Error("a descriptor without pressure range was accepted")
+	}
+}
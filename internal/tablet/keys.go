@@ -0,0 +1,72 @@
+package tablet
+
+import "fmt"
+
+// KeyLayout describes the reports of the express keys on the tablet body
+type KeyLayout struct {
+	Match Match `json:"match"` // Identifies express key reports
+	Keys  []Bit `json:"keys"`  // One flag per key, numbered from 1
+}
+
+// Match identifies a kind of report by the value of one of its bytes
+type Match struct {
+	Offset int   `json:"offset"`
+	Value  uint8 `json:"value"`
+}
+
+// KeyEvent reports that an express key was pressed or released
+type KeyEvent struct {
+	Key     int // Key number, starting at 1
+	Pressed bool
+}
+
+// Matches reports whether the report is of the kind the match identifies
+func (m Match) Matches(data []byte) bool {
+	return m.Offset >= 0 && m.Offset < len(data) && data[m.Offset] == m.Value
+}
+
+// Decode returns whether each key is held down
+func (l *KeyLayout) Decode(data []byte) []bool {
+	state := make([]bool, len(l.Keys))
+	for i, key := range l.Keys {
+		state[i] = key.Read(data)
+	}
+	return state
+}
+
+// Validate checks that every key can be read
+func (l *KeyLayout) Validate() error {
+	if len(l.Keys) == 0 {
+		return fmt.Errorf("express key layout has no keys")
+	}
+	for i, key := range l.Keys {
+		if key.Mask == 0 || key.Offset < 0 {
+			return fmt.Errorf("invalid express key %d", i+1)
+		}
+	}
+	return nil
+}
+
+// SetKeyHandler sets the function called when an express key is pressed or
+// released. It is called from the goroutine reading pen data and must be
+// set before Connect.
+func (tc *TabletController) SetKeyHandler(handler func(KeyEvent)) {
+	tc.keyHandler = handler
+}
+
+// handleKeys reports the keys that changed since the previous key report
+func (tc *TabletController) handleKeys(state []bool) {
+	if len(tc.keys) != len(state) {
+		tc.keys = make([]bool, len(state))
+	}
+	for i, pressed := range state {
+		if pressed == tc.keys[i] {
+			continue
+		}
+		tc.keys[i] = pressed
+		logger.Debug("express key", "key", i+1, "pressed", pressed)
+		if tc.keyHandler != nil {
+			tc.keyHandler(KeyEvent{Key: i + 1, Pressed: pressed})
+		}
+	}
+}
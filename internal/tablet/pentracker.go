@@ -0,0 +1,109 @@
+package tablet
+
+// PenState is the debounced state of the pen
+type PenState int
+
+const (
+	PenOut     PenState = iota // Out of proximity
+	PenHover                   // In proximity without touching
+	PenContact                 // Touching the tablet
+)
+
+// String returns the name of the state
+func (s PenState) String() string {
+	switch s {
+	case PenOut:
+		return "out"
+	case PenHover:
+		return "hover"
+	case PenContact:
+		return "contact"
+	}
+	return "unknown"
+}
+
+// PenTracker turns pen reports into the states out of range, hover and
+// contact. A change between hover and contact is only accepted once it was
+// seen in more than debounce consecutive reports, so a single noisy tip
+// switch report neither splits a stroke nor leaves a dot. Losing proximity
+// always ends contact at once. The reports of a touch down that is still
+// being debounced are held, so the stroke can start where the pen landed.
+type PenTracker struct {
+	// Contact decides whether a report touches the tablet. The tip switch
+	// is used if it is nil.
+	Contact func(*PenData) bool
+
+	debounce int
+	state    PenState
+	pending  int       // Consecutive reports disagreeing with the state
+	held     []PenData // Reports of a pending touch down
+}
+
+// NewPenTracker creates a tracker that ignores tip changes lasting at most
+// debounce reports
+func NewPenTracker(debounce int) *PenTracker {
+	if debounce < 0 {
+		debounce = 0
+	}
+	return &PenTracker{debounce: debounce}
+}
+
+// State returns the current state
+func (t *PenTracker) State() PenState {
+	return t.state
+}
+
+// Update feeds the next report to the tracker and returns the new state
+func (t *PenTracker) Update(pen *PenData) PenState {
+	contact := pen.PenDown
+	if t.Contact != nil {
+		contact = t.Contact(pen)
+	}
+	if !contact && !pen.InRange && !pen.PenDown {
+		t.Reset()
+		return t.state
+	}
+
+	want := PenHover
+	if contact {
+		want = PenContact
+	}
+	if t.state == PenOut {
+		// Entering proximity needs no debouncing, touching down does
+		t.state = PenHover
+	}
+
+	if want == t.state {
+		t.pending = 0
+		t.held = t.held[:0]
+		return t.state
+	}
+	t.pending++
+	if t.pending > t.debounce {
+		t.state = want
+		t.pending = 0
+	} else if want == PenContact {
+		t.held = append(t.held, *pen)
+	}
+	return t.state
+}
+
+// TakeHeld returns the reports that were held while a touch down was
+// debounced, once Update has confirmed the contact, and forgets them. The
+// report that confirmed it is not included.
+func (t *PenTracker) TakeHeld() []PenData {
+	if t.state != PenContact {
+		return nil
+	}
+	held := t.held
+	t.held = nil
+	return held
+}
+
+// Reset forgets the pen, e.g. when proximity is lost, the device
+// disconnects or the window loses focus
+func (t *PenTracker) Reset() {
+	t.state = PenOut
+	t.pending = 0
+	t.held = t.held[:0]
+}
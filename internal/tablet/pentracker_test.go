@@ -0,0 +1,132 @@
+package tablet
+
+import "testing"
+
+var (
+	out     = PenData{}
+	hover   = PenData{InRange: true}
+	contact = PenData{InRange: true, PenDown: true}
+)
+
+// at returns a report at a position
+func at(pen PenData, x int) *PenData {
+	pen.X = x
+	return &pen
+}
+
+// track feeds the reports and returns the state after each
+func track(tracker *PenTracker, reports ...*PenData) []PenState {
+	states := make([]PenState, len(reports))
+	for i, pen := range reports {
+		states[i] = tracker.Update(pen)
+	}
+	return states
+}
+
+func checkStates(t *testing.T, got []PenState, want ...PenState) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report %d: got %v, want %v (all: %v)", i, got[i], want[i], got)
+		}
+	}
+}
+
+func TestPenTrackerStroke(t *testing.T) {
+	tracker := NewPenTracker(2)
+	states := track(tracker,
+		at(out, 0), at(hover, 1), at(contact, 2), at(contact, 3), at(contact, 4), at(contact, 5),
+		at(hover, 6), at(hover, 7), at(hover, 8), at(out, 9),
+	)
+	checkStates(t, states,
+		PenOut, PenHover, PenHover, PenHover, PenContact, PenContact,
+		PenContact, PenContact, PenHover, PenOut,
+	)
+}
+
+func TestPenTrackerReplaysHeldReports(t *testing.T) {
+	tracker := NewPenTracker(2)
+	track(tracker, at(hover, 1), at(contact, 2), at(contact, 3))
+	if held := tracker.TakeHeld(); held != nil {
+		t.Errorf("reports %v handed out before contact was confirmed", held)
+	}
+
+	if state := tracker.Update(at(contact, 4)); state != PenContact {
+		t.Fatalf("state %v after three contact reports", state)
+	}
+	held := tracker.TakeHeld()
+	if len(held) != 2 || held[0].X != 2 || held[1].X != 3 {
+		t.Errorf("held reports %+v, want those at 2 and 3", held)
+	}
+	if again := tracker.TakeHeld(); len(again) != 0 {
+		t.Errorf("held reports %+v handed out twice", again)
+	}
+}
+
+func TestPenTrackerIgnoresBounce(t *testing.T) {
+	tracker := NewPenTracker(1)
+
+	// A tip report lasting one report while hovering leaves no dot
+	states := track(tracker, at(hover, 1), at(contact, 2), at(hover, 3), at(hover, 4))
+	checkStates(t, states, PenHover, PenHover, PenHover, PenHover)
+
+	// The bounced report is not replayed into the next stroke
+	track(tracker, at(contact, 5), at(contact, 6))
+	if held := tracker.TakeHeld(); len(held) != 1 || held[0].X != 5 {
+		t.Errorf("held reports %+v, want only the one at 5", held)
+	}
+
+	// A release lasting one report does not split the stroke
+	states = track(tracker, at(hover, 7), at(contact, 8))
+	checkStates(t, states, PenContact, PenContact)
+}
+
+func TestPenTrackerProximityLostMidStroke(t *testing.T) {
+	tracker := NewPenTracker(3)
+	track(tracker, at(hover, 1), at(contact, 2), at(contact, 3), at(contact, 4), at(contact, 5))
+	if tracker.State() != PenContact {
+		t.Fatalf("state %v, want contact", tracker.State())
+	}
+
+	// Losing proximity ends contact without debouncing
+	if state := tracker.Update(at(out, 6)); state != PenOut {
+		t.Errorf("state %v after proximity was lost, want out", state)
+	}
+	// Coming back in range hovers at once
+	if state := tracker.Update(at(hover, 7)); state != PenHover {
+		t.Errorf("state %v on entering proximity, want hover", state)
+	}
+}
+
+func TestPenTrackerReset(t *testing.T) {
+	tracker := NewPenTracker(1)
+	track(tracker, at(hover, 1), at(contact, 2), at(contact, 3))
+
+	// The device disconnects mid-stroke
+	tracker.Reset()
+	if tracker.State() != PenOut {
+		t.Errorf("state %v after reset, want out", tracker.State())
+	}
+
+	// A pending touch down is forgotten as well
+	track(tracker, at(hover, 4), at(contact, 5))
+	tracker.Reset()
+	states := track(tracker, at(contact, 6), at(contact, 7))
+	checkStates(t, states, PenHover, PenContact)
+	if held := tracker.TakeHeld(); len(held) != 1 || held[0].X != 6 {
+		t.Errorf("held reports %+v, want only the one at 6", held)
+	}
+}
+
+func TestPenTrackerCustomContact(t *testing.T) {
+	tracker := NewPenTracker(0)
+	tracker.Contact = func(pen *PenData) bool { return pen.PenDown && pen.Button1 }
+
+	pressed := contact
+	pressed.Button1 = true
+	states := track(tracker, &contact, &pressed, &contact)
+	checkStates(t, states, PenHover, PenContact, PenHover)
+}
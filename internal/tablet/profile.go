@@ -0,0 +1,306 @@
+package tablet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProfileExtension is the file extension of device profiles
+const ProfileExtension = ".json"
+
+// Field locates an unsigned integer inside a report
+type Field struct {
+	Offset    int  `json:"offset"`              // Index of the first byte
+	Size      int  `json:"size"`                // Number of bytes (1-4)
+	BigEndian bool `json:"bigEndian,omitempty"` // Byte order, little-endian by default
+	Signed    bool `json:"signed,omitempty"`    // Two's complement value
+}
+
+// Bit locates a single flag inside a report
+type Bit struct {
+	Offset int   `json:"offset"` // Index of the byte
+	Mask   uint8 `json:"mask"`   // Mask selecting the flag
+}
+
+// ReportLayout describes where the pen state is stored in a raw report
+type ReportLayout struct {
+	// ReportID is the first byte of pen reports. Zero accepts any report
+	// from the pen interface, for tablets with a single kind of report.
+	ReportID  uint8 `json:"reportId,omitempty"`
+	Length    int   `json:"length"`    // Minimum report length in bytes
+	X         Field `json:"x"`         // Horizontal position
+	Y         Field `json:"y"`         // Vertical position
+	Pressure  Field `json:"pressure"`  // Tip pressure
+	TipSwitch Bit   `json:"tipSwitch"` // Pen touching the surface
+	InRange   Bit   `json:"inRange"`   // Pen in proximity
+	Button1   Bit   `json:"button1"`   // First barrel button
+	Button2   Bit   `json:"button2"`   // Second barrel button
+	// Tilt in degrees from vertical, absent on pens without tilt sensors
+	TiltX *Field `json:"tiltX,omitempty"`
+	TiltY *Field `json:"tiltY,omitempty"`
+}
+
+// Profile describes a tablet model: how to find it and how to read it
+type Profile struct {
+	Name        string       `json:"name"`
+	VendorID    uint16       `json:"vendorId"`
+	ProductID   uint16       `json:"productId"`
+	MaxX        int          `json:"maxX"`        // Largest reported X coordinate
+	MaxY        int          `json:"maxY"`        // Largest reported Y coordinate
+	MaxPressure int          `json:"maxPressure"` // Largest reported pressure
+	Layout      ReportLayout `json:"layout"`
+	// Keys describes the express keys on the tablet body, if any
+	Keys *KeyLayout `json:"keys,omitempty"`
+	// Init is the vendor handshake sent after connecting, if any. The
+	// layout must describe the reports the tablet sends after it.
+	Init *InitSequence `json:"init,omitempty"`
+}
+
+// StarG640 is the profile of the XP-Pen Star G640
+var StarG640 = Profile{
+	Name:        "star-g640",
+	VendorID:    VendorID,
+	ProductID:   ProductID,
+	MaxX:        32767,
+	MaxY:        32767,
+	MaxPressure: 8191,
+	Layout: ReportLayout{
+		Length:    8,
+		X:         Field{Offset: 2, Size: 2},
+		Y:         Field{Offset: 4, Size: 2},
+		Pressure:  Field{Offset: 6, Size: 2},
+		TipSwitch: Bit{Offset: 1, Mask: 0x01},
+		InRange:   Bit{Offset: 1, Mask: 0x02},
+		Button1:   Bit{Offset: 1, Mask: 0x04},
+		Button2:   Bit{Offset: 1, Mask: 0x08},
+	},
+}
+
+// StarG640Full is the profile of the XP-Pen Star G640 switched to its
+// full-resolution reports by the vendor handshake, as the Linux uclogic
+// driver does. The ranges are replaced by those the tablet reports.
+var StarG640Full = Profile{
+	Name:        "star-g640-full",
+	VendorID:    VendorID,
+	ProductID:   ProductID,
+	MaxX:        32000,
+	MaxY:        20000,
+	MaxPressure: 8191,
+	Layout: ReportLayout{
+		ReportID:  0x02,
+		Length:    12,
+		X:         Field{Offset: 2, Size: 2},
+		Y:         Field{Offset: 4, Size: 2},
+		Pressure:  Field{Offset: 6, Size: 2},
+		TipSwitch: Bit{Offset: 1, Mask: 0x01},
+		InRange:   Bit{Offset: 1, Mask: 0x20},
+		Button1:   Bit{Offset: 1, Mask: 0x02},
+		Button2:   Bit{Offset: 1, Mask: 0x04},
+	},
+	Init: &InitSequence{Report: "02b004000000000000000000", ParamsDescriptor: 100},
+}
+
+// DefaultProfile is used when no profile is configured. It is not the
+// full-resolution profile: if the handshake fails, e.g. on a system where
+// the hidraw node is read-only, the tablet stays in compatibility mode and
+// none of its reports would match the full-resolution layout.
+var DefaultProfile = StarG640
+
+// builtinProfiles are the profiles compiled into the application
+var builtinProfiles = []Profile{StarG640, StarG640Full}
+
+// Decode extracts the pen state from a raw report
+func (l ReportLayout) Decode(data []byte) (*PenData, error) {
+	if len(data) < l.Length {
+		return nil, fmt.Errorf("insufficient data received: %d bytes", len(data))
+	}
+
+	x, err := l.X.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := l.Y.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	pressure, err := l.Pressure.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("pressure: %w", err)
+	}
+
+	pen := &PenData{
+		X:        x,
+		Y:        y,
+		Pressure: pressure,
+		PenDown:  l.TipSwitch.Read(data),
+		InRange:  l.InRange.Read(data),
+		Button1:  l.Button1.Read(data),
+		Button2:  l.Button2.Read(data),
+	}
+
+	if l.TiltX != nil && l.TiltY != nil {
+		if pen.TiltX, err = l.TiltX.Read(data); err != nil {
+			return nil, fmt.Errorf("tilt x: %w", err)
+		}
+		if pen.TiltY, err = l.TiltY.Read(data); err != nil {
+			return nil, fmt.Errorf("tilt y: %w", err)
+		}
+		pen.HasTilt = true
+	}
+
+	return pen, nil
+}
+
+// Read extracts the field value from a report
+func (f Field) Read(data []byte) (int, error) {
+	if f.Size < 1 || f.Size > 4 {
+		return 0, fmt.Errorf("invalid field size %d", f.Size)
+	}
+	if f.Offset < 0 || f.Offset+f.Size > len(data) {
+		return 0, fmt.Errorf("field at offset %d exceeds %d byte report", f.Offset, len(data))
+	}
+
+	value := 0
+	for i := 0; i < f.Size; i++ {
+		b := int(data[f.Offset+i])
+		if f.BigEndian {
+			value = value<<8 | b
+		} else {
+			value |= b << (8 * i)
+		}
+	}
+	if f.Signed && value >= 1<<(8*f.Size-1) {
+		value -= 1 << (8 * f.Size)
+	}
+	return value, nil
+}
+
+// Read reports whether the flag is set. Flags outside the report or with an
+// empty mask are never set, which lets profiles omit unsupported buttons.
+func (b Bit) Read(data []byte) bool {
+	if b.Mask == 0 || b.Offset < 0 || b.Offset >= len(data) {
+		return false
+	}
+	return data[b.Offset]&b.Mask != 0
+}
+
+// Validate checks that the profile can be used to read a tablet
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	if p.MaxX <= 0 || p.MaxY <= 0 || p.MaxPressure <= 0 {
+		return fmt.Errorf("profile %q: maximum coordinates and pressure must be positive", p.Name)
+	}
+	fields := map[string]Field{"x": p.Layout.X, "y": p.Layout.Y, "pressure": p.Layout.Pressure}
+	if (p.Layout.TiltX == nil) != (p.Layout.TiltY == nil) {
+		return fmt.Errorf("profile %q: tilt needs both an x and a y field", p.Name)
+	}
+	if p.Layout.TiltX != nil {
+		fields["tilt x"], fields["tilt y"] = *p.Layout.TiltX, *p.Layout.TiltY
+	}
+	for name, f := range fields {
+		if f.Size < 1 || f.Size > 4 || f.Offset < 0 {
+			return fmt.Errorf("profile %q: invalid %s field", p.Name, name)
+		}
+		if f.Offset+f.Size > p.Layout.Length {
+			return fmt.Errorf("profile %q: %s field exceeds report length %d", p.Name, name, p.Layout.Length)
+		}
+	}
+	if p.Keys != nil {
+		if err := p.Keys.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+	}
+	if p.Init != nil {
+		if err := p.Init.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadProfile reads a profile from a JSON file
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveProfile writes a profile to a JSON file
+func SaveProfile(p *Profile, path string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
+
+// FindProfile resolves a profile by file path, by name in the profile
+// directory, or by name among the built-in profiles, in that order
+func FindProfile(nameOrPath, profileDir string) (*Profile, error) {
+	if strings.HasSuffix(nameOrPath, ProfileExtension) || strings.ContainsRune(nameOrPath, os.PathSeparator) {
+		return LoadProfile(nameOrPath)
+	}
+
+	if profileDir != "" {
+		path := filepath.Join(profileDir, nameOrPath+ProfileExtension)
+		if _, err := os.Stat(path); err == nil {
+			return LoadProfile(path)
+		}
+	}
+
+	for _, p := range builtinProfiles {
+		if p.Name == nameOrPath {
+			profile := p
+			return &profile, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown tablet profile %q", nameOrPath)
+}
+
+// ListProfiles returns the built-in profiles followed by those found in the
+// profile directory, sorted by name within each group
+func ListProfiles(profileDir string) []Profile {
+	profiles := append([]Profile{}, builtinProfiles...)
+
+	if profileDir == "" {
+		return profiles
+	}
+	paths, _ := filepath.Glob(filepath.Join(profileDir, "*"+ProfileExtension))
+	sort.Strings(paths)
+	for _, path := range paths {
+		p, err := LoadProfile(path)
+		if err != nil {
+			logger.Warn("skipping invalid profile", "path", path, "err", err)
+			continue
+		}
+		profiles = append(profiles, *p)
+	}
+	return profiles
+}
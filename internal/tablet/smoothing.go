@@ -0,0 +1,44 @@
+package tablet
+
+// Smoother reduces jitter in pen positions with an exponential moving
+// average. It restarts whenever the pen leaves the tablet so that the first
+// sample after returning is not pulled towards the old position.
+type Smoother struct {
+	factor float64 // Weight of the previous position, 0 disables smoothing
+	x, y   float64
+	primed bool
+}
+
+// NewSmoother creates a smoother. The factor is the weight of the previous
+// position from 0 (no smoothing) to just below 1 (heavy smoothing).
+func NewSmoother(factor float64) *Smoother {
+	if factor < 0 {
+		factor = 0
+	} else if factor > 0.95 {
+		factor = 0.95
+	}
+	return &Smoother{factor: factor}
+}
+
+// Smooth returns the pen data with a smoothed position
+func (s *Smoother) Smooth(pen *PenData) *PenData {
+	if s.factor == 0 {
+		return pen
+	}
+	if !pen.InRange && !pen.PenDown {
+		s.primed = false
+		return pen
+	}
+
+	if !s.primed {
+		s.x, s.y, s.primed = float64(pen.X), float64(pen.Y), true
+	} else {
+		s.x = s.factor*s.x + (1-s.factor)*float64(pen.X)
+		s.y = s.factor*s.y + (1-s.factor)*float64(pen.Y)
+	}
+
+	smoothed := *pen
+	smoothed.X = int(s.x + 0.5)
+	smoothed.Y = int(s.y + 0.5)
+	return &smoothed
+}
@@ -0,0 +1,35 @@
+package tablet
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ErrDisconnected is returned by a pen source that stopped for good, e.g.
+// because the tablet was unplugged. The source is no longer connected.
+var ErrDisconnected = errors.New("tablet disconnected")
+
+// maxReadErrors is the number of failed reads in a row after which a device
+// counts as unplugged, for platforms whose errors do not say so
+const maxReadErrors = 10
+
+// deviceGone reports whether a read error means that the device is gone
+func deviceGone(err error) bool {
+	return errors.Is(err, syscall.ENODEV) || errors.Is(err, os.ErrClosed)
+}
+
+// PenSource produces pen samples, such as a HID tablet read directly or the
+// kernel's input device for it
+type PenSource interface {
+	// ReadPenData blocks until the next pen sample is available
+	ReadPenData() (*PenData, error)
+	// GetTabletDimensions returns the largest X and Y values of the samples
+	GetTabletDimensions() (int, int)
+	// GetMaxPressure returns the largest pressure value of the samples
+	GetMaxPressure() int
+	IsConnected() bool
+	Disconnect() error
+}
+
+var _ PenSource = (*TabletController)(nil)
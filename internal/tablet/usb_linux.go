@@ -0,0 +1,84 @@
+//go:build linux
+
+package tablet
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"xp-pen-controller/internal/input"
+)
+
+// USB device filesystem ioctls and requests, from linux/usbdevice_fs.h and
+// the USB specification
+const (
+	usbfsIoctlType     = 'U'
+	usbdevfsControlNr  = 0
+	usbDirIn           = 0x80
+	usbGetDescriptor   = 0x06
+	usbStringDesc      = 0x03
+	usbLangEnglishUS   = 0x0409
+	usbControlTimeout  = 1000 // Milliseconds
+	usbMaxStringLength = 255
+)
+
+// usbCtrlTransfer mirrors struct usbdevfs_ctrltransfer
+type usbCtrlTransfer struct {
+	requestType uint8
+	request     uint8
+	value       uint16
+	index       uint16
+	length      uint16
+	timeout     uint32
+	data        unsafe.Pointer
+}
+
+// readUSBStringDescriptor reads a raw string descriptor from the USB device
+// behind a HID path, with a control transfer through usbfs. The interface
+// stays claimed by the HID library; requests on the control endpoint do not
+// need it.
+func readUSBStringDescriptor(hidPath string, index int) ([]byte, error) {
+	path, err := usbfsPath(hidPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open USB device: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, usbMaxStringLength)
+	var pinner runtime.Pinner
+	pinner.Pin(&buf[0])
+	defer pinner.Unpin()
+
+	transfer := usbCtrlTransfer{
+		requestType: usbDirIn,
+		request:     usbGetDescriptor,
+		value:       usbStringDesc<<8 | uint16(index),
+		index:       usbLangEnglishUS,
+		length:      uint16(len(buf)),
+		timeout:     usbControlTimeout,
+		data:        unsafe.Pointer(&buf[0]),
+	}
+	req := input.IOC(input.IocRead|input.IocWrite, usbfsIoctlType, usbdevfsControlNr, int(unsafe.Sizeof(transfer)))
+	n, err := input.IoctlLen(f.Fd(), req, unsafe.Pointer(&transfer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read string descriptor %d: %w", index, err)
+	}
+	return buf[:n], nil
+}
+
+// usbfsPath returns the usbfs node of a device from its HID path, which
+// the HID library builds from the hexadecimal bus number, device address
+// and interface number, e.g. "0001:0004:00"
+func usbfsPath(hidPath string) (string, error) {
+	var bus, address, iface int
+	if _, err := fmt.Sscanf(hidPath, "%x:%x:%x", &bus, &address, &iface); err != nil {
+		return "", fmt.Errorf("unexpected HID path %q: %w", hidPath, err)
+	}
+	return fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, address), nil
+}
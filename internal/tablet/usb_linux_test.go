@@ -0,0 +1,15 @@
+//go:build linux
+
+package tablet
+
+import "testing"
+
+func TestUsbfsPath(t *testing.T) {
+	path, err := usbfsPath("0001:000a:02")
+	if err != nil || path != "/dev/bus/usb/001/010" {
+		t.Errorf("got %q, %v", path, err)
+	}
+	if _, err := usbfsPath("/dev/hidraw0"); err == nil {
+		t.Error("a hidraw path was accepted")
+	}
+}
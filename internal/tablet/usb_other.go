@@ -0,0 +1,11 @@
+//go:build !linux
+
+package tablet
+
+import "fmt"
+
+// readUSBStringDescriptor reads a raw string descriptor from the USB
+// device behind a HID path, which is only implemented on Linux
+func readUSBStringDescriptor(hidPath string, index int) ([]byte, error) {
+	return nil, fmt.Errorf("reading string descriptors is only available on Linux")
+}
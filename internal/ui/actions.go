@@ -0,0 +1,187 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// Action is a whiteboard command that express keys and pen buttons can
+// trigger
+type Action string
+
+// Actions that can be bound to keys and buttons
+const (
+	ActionNone         Action = "none"
+	ActionUndo         Action = "undo"
+	ActionRedo         Action = "redo"
+	ActionClear        Action = "clear"
+	ActionSave         Action = "save"
+	ActionZoomIn       Action = "zoom-in"
+	ActionZoomOut      Action = "zoom-out"
+	ActionZoomReset    Action = "zoom-reset"
+	ActionToggleEraser Action = "toggle-eraser"
+	ActionFullScreen   Action = "toggle-fullscreen"
+	ActionToolbar      Action = "toggle-toolbar"
+)
+
+// Actions lists every action that can be bound
+var Actions = []Action{
+	ActionNone,
+	ActionUndo,
+	ActionRedo,
+	ActionClear,
+	ActionSave,
+	ActionZoomIn,
+	ActionZoomOut,
+	ActionZoomReset,
+	ActionToggleEraser,
+	ActionFullScreen,
+	ActionToolbar,
+}
+
+// Binding names: "key1", "key2", ... for the express keys in the order the
+// profile lists them, and "button1" and "button2" for the pen buttons
+const (
+	bindingKeyPrefix = "key"
+	bindingButton1   = "button1"
+	bindingButton2   = "button2"
+)
+
+// DefaultBindings maps the express keys to actions when nothing is
+// configured. Button 1 is unbound, as it enables drawing; button 2 reveals
+// the toolbar in full-screen mode.
+var DefaultBindings = map[string]Action{
+	"key1": ActionUndo,
+	"key2": ActionRedo,
+	"key3": ActionToggleEraser,
+	"key4": ActionClear,
+	"key5": ActionZoomIn,
+	"key6": ActionZoomOut,
+	"key7": ActionZoomReset,
+	"key8": ActionSave,
+
+	bindingButton2: ActionToolbar,
+}
+
+// zoomStep is the factor applied by the zoom actions
+const zoomStep = 1.25
+
+// ParseBindings validates configured bindings and merges them over the
+// defaults. Binding a key to "none" disables it.
+func ParseBindings(configured map[string]string) (map[string]Action, error) {
+	bindings := make(map[string]Action, len(DefaultBindings)+len(configured))
+	for name, action := range DefaultBindings {
+		bindings[name] = action
+	}
+
+	for name, value := range configured {
+		if !validBindingName(name) {
+			return nil, fmt.Errorf("unknown key or button %q", name)
+		}
+		action := Action(value)
+		if !validAction(action) {
+			return nil, fmt.Errorf("unknown action %q for %s", value, name)
+		}
+		bindings[name] = action
+	}
+	return bindings, nil
+}
+
+// validBindingName reports whether the name refers to a key or button
+func validBindingName(name string) bool {
+	if name == bindingButton1 || name == bindingButton2 {
+		return true
+	}
+	number, ok := strings.CutPrefix(name, bindingKeyPrefix)
+	if !ok || number == "" {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validAction reports whether the action exists
+func validAction(action Action) bool {
+	for _, a := range Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBindings replaces the mapping from keys and buttons to actions.
+// It must be called before the tablet is connected.
+func (ww *WhiteboardWindow) SetBindings(bindings map[string]Action) {
+	ww.bindings = bindings
+}
+
+// handleKey performs the action bound to an express key when it is pressed
+func (ww *WhiteboardWindow) handleKey(event tablet.KeyEvent) {
+	if event.Pressed {
+		ww.trigger(fmt.Sprintf("%s%d", bindingKeyPrefix, event.Key))
+	}
+}
+
+// handlePenButtons performs the actions bound to pen buttons that were
+// pressed since the previous sample
+func (ww *WhiteboardWindow) handlePenButtons(previous, current *tablet.PenData) {
+	if current.Button1 && (previous == nil || !previous.Button1) {
+		ww.trigger(bindingButton1)
+	}
+	if current.Button2 && (previous == nil || !previous.Button2) {
+		ww.trigger(bindingButton2)
+	}
+}
+
+// trigger performs the action bound to a key or button, if any
+func (ww *WhiteboardWindow) trigger(name string) {
+	action, ok := ww.bindings[name]
+	if !ok || action == ActionNone {
+		return
+	}
+	inputLog.Debug("triggering action", "binding", name, "action", action)
+	ww.Perform(action)
+}
+
+// Perform runs a whiteboard action
+func (ww *WhiteboardWindow) Perform(action Action) {
+	switch action {
+	case ActionUndo:
+		ww.canvas.Lock()
+		ww.canvas.Undo()
+		ww.canvas.Unlock()
+	case ActionRedo:
+		ww.canvas.Lock()
+		ww.canvas.Redo()
+		ww.canvas.Unlock()
+	case ActionClear:
+		ww.canvas.Lock()
+		ww.canvas.Clear()
+		ww.canvas.Unlock()
+	case ActionSave:
+		ww.save()
+	case ActionZoomIn:
+		ww.drawingArea.SetZoom(ww.drawingArea.Zoom() * zoomStep)
+	case ActionZoomOut:
+		ww.drawingArea.SetZoom(ww.drawingArea.Zoom() / zoomStep)
+	case ActionZoomReset:
+		ww.drawingArea.SetZoom(1)
+	case ActionToggleEraser:
+		ww.canvas.Lock()
+		ww.canvas.Eraser = !ww.canvas.Eraser
+		eraser := ww.canvas.Eraser
+		ww.canvas.Unlock()
+		inputLog.Info("eraser toggled", "eraser", eraser)
+	case ActionFullScreen:
+		ww.SetFullScreen(!ww.FullScreen())
+	case ActionToolbar:
+		ww.toggleToolbar()
+	}
+}
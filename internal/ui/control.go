@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+
+	"xp-pen-controller/internal/control"
+)
+
+// Modes of the pen accepted by the control API
+const (
+	modePen    = "pen"
+	modeEraser = "eraser"
+)
+
+// controlCommands runs control API calls through the same code as the
+// toolbar and key bindings
+type controlCommands struct {
+	ww *WhiteboardWindow
+}
+
+var _ control.Commands = controlCommands{}
+
+// ServeControl lets other programs script the whiteboard through the Unix
+// socket at path and, if httpAddr is not empty, over HTTP on that loopback
+// address with the token written next to the socket
+func (ww *WhiteboardWindow) ServeControl(path, httpAddr string) error {
+	server := control.NewServer(ww.canvas, controlCommands{ww})
+	if path != "" {
+		if err := server.ListenUnix(path); err != nil {
+			server.Close()
+			return err
+		}
+	}
+	if httpAddr != "" {
+		socket := path
+		if socket == "" {
+			socket = control.DefaultSocket()
+		}
+		if _, err := server.ListenHTTP(httpAddr, control.TokenFile(socket)); err != nil {
+			server.Close()
+			return err
+		}
+	}
+	ww.control = server
+	return nil
+}
+
+// Perform runs a toolbar action
+func (cc controlCommands) Perform(action string) error {
+	if !validAction(Action(action)) {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	cc.ww.Perform(Action(action))
+	return nil
+}
+
+// Save writes the drawing to path, or to the file it came from
+func (cc controlCommands) Save(path string) error {
+	if path == "" {
+		cc.ww.canvas.Lock()
+		path = cc.ww.path
+		cc.ww.canvas.Unlock()
+	}
+	if path == "" {
+		return errors.New("the drawing has no file yet, give a path")
+	}
+	return cc.ww.SaveFile(path)
+}
+
+// Open replaces the drawing with a file
+func (cc controlCommands) Open(path string) error {
+	return cc.ww.OpenFile(path)
+}
+
+// Export renders the drawing to a file
+func (cc controlCommands) Export(path string, width, height int) error {
+	return cc.ww.ExportFile(path, width, height)
+}
+
+// SetMode switches between drawing and erasing
+func (cc controlCommands) SetMode(mode string) error {
+	var eraser bool
+	switch mode {
+	case modePen:
+	case modeEraser:
+		eraser = true
+	default:
+		return fmt.Errorf("unknown mode %q, expected %q or %q", mode, modePen, modeEraser)
+	}
+
+	cc.ww.canvas.Lock()
+	cc.ww.canvas.Eraser = eraser
+	cc.ww.canvas.Unlock()
+	inputLog.Info("mode set", "mode", mode)
+	return nil
+}
@@ -1,11 +1,15 @@
 package ui
 
 import (
-	"fmt"
 	"image/color"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 
 	"xp-pen-controller/internal/drawing"
@@ -15,27 +19,52 @@ import (
 type DrawingArea struct {
 	widget.BaseWidget
 	canvas      *drawing.Canvas
-	lines       []*canvas.Line
-	needsUpdate bool
-	isDragging  bool // Track if we're currently dragging
+	needsUpdate atomic.Bool // The layers must be redrawn; set by the frame pacer
+	isDragging  bool        // Track if we're currently dragging
+
+	zoomMu sync.Mutex
+	zoom   float64 // Magnification around the centre, 1 fits the canvas
+
+	shownMu sync.Mutex
+	shown   *drawing.Canvas // Shown instead of the edited canvas, e.g. a replay
+
+	hoverMu      sync.Mutex
+	hover        *hoverCursor // Pen position while in proximity, nil otherwise
+	hoverChanged bool         // The cursor moved since the last refresh
+
+	// Set by the window before the area is shown
+	onResize   func(size fyne.Size)    // The area was laid out at a new size
+	onPointer  func(pos fyne.Position) // The mouse pointer moved over the area
+	onTypedKey func(key *fyne.KeyEvent)
+}
+
+// hoverCursor is the position and size of the pen cursor in canvas units
+type hoverCursor struct {
+	X, Y   float64
+	Width  float64 // Width the next stroke can reach
+	Eraser bool
 }
 
+// minCursorRadius keeps the cursor visible when zoomed out
+const minCursorRadius = 2
+
 // Ensure DrawingArea implements the required interfaces
 var _ fyne.Widget = (*DrawingArea)(nil)
 var _ fyne.Tappable = (*DrawingArea)(nil)
 var _ fyne.Draggable = (*DrawingArea)(nil)
 var _ fyne.Focusable = (*DrawingArea)(nil)
+var _ desktop.Hoverable = (*DrawingArea)(nil)
 
 // Note: MouseDown/MouseUp might not be standard Fyne interfaces
 
 // NewDrawingArea creates a new drawing area widget
 func NewDrawingArea(drawingCanvas *drawing.Canvas) *DrawingArea {
 	area := &DrawingArea{
-		canvas:      drawingCanvas,
-		lines:       make([]*canvas.Line, 0),
-		needsUpdate: true,
-		isDragging:  false,
+		canvas:     drawingCanvas,
+		isDragging: false,
+		zoom:       1,
 	}
+	area.needsUpdate.Store(true)
 	area.ExtendBaseWidget(area)
 
 	return area
@@ -43,115 +72,213 @@ func NewDrawingArea(drawingCanvas *drawing.Canvas) *DrawingArea {
 
 // Refresh updates the drawing area display
 func (da *DrawingArea) Refresh() {
-	da.needsUpdate = true
+	da.needsUpdate.Store(true)
 	da.BaseWidget.Refresh()
 }
 
+// Zoom limits
+const (
+	minZoom = 0.25
+	maxZoom = 8
+)
+
+// ShowCanvas displays another canvas than the one being edited, such as a
+// replay, until it is called with nil. Mouse drawing is disabled meanwhile.
+func (da *DrawingArea) ShowCanvas(c *drawing.Canvas) {
+	da.shownMu.Lock()
+	da.shown = c
+	da.shownMu.Unlock()
+
+	// Whatever was displayed before has to be drawn over completely
+	shown := da.displayed()
+	shown.Lock()
+	shown.Invalidate()
+	shown.Unlock()
+	da.Refresh()
+}
+
+// displayed returns the canvas currently shown
+func (da *DrawingArea) displayed() *drawing.Canvas {
+	da.shownMu.Lock()
+	defer da.shownMu.Unlock()
+	if da.shown != nil {
+		return da.shown
+	}
+	return da.canvas
+}
+
+// editable reports whether the mouse draws on the shown canvas
+func (da *DrawingArea) editable() bool {
+	return da.displayed() == da.canvas
+}
+
+// View returns the transform from canvas coordinates to widget coordinates
+func (da *DrawingArea) View() drawing.View {
+	size := da.Size()
+	w, h := float64(size.Width), float64(size.Height)
+	shown := da.displayed()
+	view := drawing.FitView(shown.Width, shown.Height, w, h)
+	if zoom := da.Zoom(); zoom != 1 {
+		view = view.ZoomedAt(zoom, w/2, h/2)
+	}
+	return view
+}
+
+// Zoom returns the magnification relative to fitting the whole canvas
+func (da *DrawingArea) Zoom() float64 {
+	da.zoomMu.Lock()
+	defer da.zoomMu.Unlock()
+	return da.zoom
+}
+
+// SetZoom magnifies the canvas around the centre of the drawing area
+func (da *DrawingArea) SetZoom(zoom float64) {
+	zoom = math.Max(minZoom, math.Min(maxZoom, zoom))
+	da.zoomMu.Lock()
+	da.zoom = zoom
+	da.zoomMu.Unlock()
+
+	inputLog.Debug("zoom changed", "zoom", zoom)
+	da.Refresh()
+}
+
+// SetHover shows the pen cursor at the given point, sized to the width of
+// the line the pen would draw
+func (da *DrawingArea) SetHover(point drawing.Point, width float64, eraser bool) {
+	hover := &hoverCursor{X: point.X, Y: point.Y, Width: width, Eraser: eraser}
+
+	da.hoverMu.Lock()
+	defer da.hoverMu.Unlock()
+	if da.hover == nil || *da.hover != *hover {
+		da.hover = hover
+		da.hoverChanged = true
+	}
+}
+
+// HideHover hides the pen cursor, e.g. when the pen leaves proximity
+func (da *DrawingArea) HideHover() {
+	da.hoverMu.Lock()
+	defer da.hoverMu.Unlock()
+	if da.hover != nil {
+		da.hover = nil
+		da.hoverChanged = true
+	}
+}
+
+// hoverState returns the current pen cursor, or nil if it is hidden
+func (da *DrawingArea) hoverState() *hoverCursor {
+	da.hoverMu.Lock()
+	defer da.hoverMu.Unlock()
+	return da.hover
+}
+
+// takeHoverChanged reports whether the cursor changed since the last call
+func (da *DrawingArea) takeHoverChanged() bool {
+	da.hoverMu.Lock()
+	defer da.hoverMu.Unlock()
+	changed := da.hoverChanged
+	da.hoverChanged = false
+	return changed
+}
+
+// refreshHover redraws only the pen cursor, leaving the raster layers alone
+func (da *DrawingArea) refreshHover() {
+	da.BaseWidget.Refresh()
+}
+
+// mousePoint converts a widget position to a drawing point in canvas units
+func (da *DrawingArea) mousePoint(pos fyne.Position) drawing.Point {
+	x, y := da.View().ToCanvas(float64(pos.X), float64(pos.Y))
+	return drawing.Point{
+		X:        x,
+		Y:        y,
+		Pressure: 0.7, // Default pressure for mouse
+		Time:     time.Now(),
+	}
+}
+
 // Tapped handles tap events on the drawing area
 func (da *DrawingArea) Tapped(event *fyne.PointEvent) {
-	fmt.Printf("DEBUG: Tapped event at position: %v (ignoring - waiting for stylus input)\n", event.Position)
+	inputLog.Debug("ignoring tap, waiting for stylus input", "x", event.Position.X, "y", event.Position.Y)
 	// Do nothing - we only want to draw with stylus input, not mouse clicks
 }
 
 // MouseDown handles mouse press events (start drawing)
 func (da *DrawingArea) MouseDown(event *fyne.PointEvent) {
-	fmt.Printf("DEBUG: Mouse down at: %v\n", event.Position)
+	inputLog.Debug("mouse down", "x", event.Position.X, "y", event.Position.Y)
+	if !da.editable() {
+		return
+	}
 
 	// Set dragging flag
 	da.isDragging = true
 
 	// For testing: allow drawing with mouse (while we fix tablet permissions)
-	// Convert screen coordinates to normalized coordinates
-	normalizedX := float64(event.Position.X) / float64(da.Size().Width)
-	normalizedY := float64(event.Position.Y) / float64(da.Size().Height)
-
-	// Create a drawing point
-	point := drawing.Point{
-		X:        normalizedX,
-		Y:        normalizedY,
-		Pressure: 0.7, // Default pressure for mouse
-	}
+	point := da.mousePoint(event.Position)
 
-	// Start a new stroke
-	fmt.Println("DEBUG: Starting new stroke with mouse")
+	// Start a new stroke; the frame pacer refreshes the display
+	da.canvas.Lock()
 	da.canvas.StartStroke(point)
-	da.needsUpdate = true
-	da.BaseWidget.Refresh()
+	da.canvas.Unlock()
 }
 
 // MouseUp handles mouse release events (stop drawing)
 func (da *DrawingArea) MouseUp(event *fyne.PointEvent) {
-	fmt.Printf("DEBUG: Mouse up at: %v (isDragging: %t)\n", event.Position, da.isDragging)
+	inputLog.Debug("mouse up", "x", event.Position.X, "y", event.Position.Y, "dragging", da.isDragging)
 
 	if da.isDragging {
 		da.isDragging = false
 		// Finish the current stroke
-		fmt.Println("DEBUG: Finishing stroke on mouse up")
+		da.canvas.Lock()
 		da.canvas.FinishStroke()
-		da.needsUpdate = true
-		da.BaseWidget.Refresh()
+		da.canvas.Unlock()
 	}
 }
 
 // Dragged handles mouse drag events (continue drawing)
 func (da *DrawingArea) Dragged(event *fyne.DragEvent) {
-	fmt.Printf("DEBUG: Dragged event at: %v (isDragging: %t)\n", event.Position, da.isDragging)
+	if debugEnabled(inputLog) {
+		inputLog.Debug("dragged", "x", event.Position.X, "y", event.Position.Y, "dragging", da.isDragging)
+	}
+
+	if !da.editable() {
+		return
+	}
 
 	// If not already dragging, start a new stroke
 	if !da.isDragging {
-		fmt.Println("DEBUG: Starting drag - initializing stroke")
 		da.isDragging = true
 
-		// Convert screen coordinates to normalized coordinates for start point
-		size := da.Size()
-		normalizedX := float64(event.Position.X) / float64(size.Width)
-		normalizedY := float64(event.Position.Y) / float64(size.Height)
-
 		// Create the first point
-		point := drawing.Point{
-			X:        normalizedX,
-			Y:        normalizedY,
-			Pressure: 0.7, // Default pressure for mouse
-		}
+		point := da.mousePoint(event.Position)
 
 		// Start a new stroke
-		fmt.Println("DEBUG: Starting new stroke with drag")
+		da.canvas.Lock()
 		da.canvas.StartStroke(point)
+		da.canvas.Unlock()
 	} else {
 		// Continue existing stroke
-		// Convert screen coordinates to normalized coordinates
-		size := da.Size()
-		normalizedX := float64(event.Position.X) / float64(size.Width)
-		normalizedY := float64(event.Position.Y) / float64(size.Height)
-
-		// Create a new point
-		point := drawing.Point{
-			X:        normalizedX,
-			Y:        normalizedY,
-			Pressure: 0.7, // Higher pressure for visible line
-		}
+		point := da.mousePoint(event.Position)
 
 		// Add point to current stroke
-		fmt.Println("DEBUG: Adding point to stroke during drag")
+		da.canvas.Lock()
 		da.canvas.AddPointToCurrentStroke(point)
+		da.canvas.Unlock()
 	}
 
-	// IMPORTANT: Force immediate refresh to show the stroke being drawn
-	da.needsUpdate = true
-	da.BaseWidget.Refresh() // This calls the renderer's Refresh() method
+	// No refresh here: the frame pacer picks up the change on the next frame
 }
 
 // DragEnd handles end of drag events
 func (da *DrawingArea) DragEnd() {
-	fmt.Printf("DEBUG: DragEnd called (isDragging: %t)\n", da.isDragging)
+	inputLog.Debug("drag end", "dragging", da.isDragging)
 
 	if da.isDragging {
 		da.isDragging = false
 		// Finish the current stroke
-		fmt.Println("DEBUG: Finishing stroke on drag end")
+		da.canvas.Lock()
 		da.canvas.FinishStroke()
-		da.needsUpdate = true
-		da.BaseWidget.Refresh()
+		da.canvas.Unlock()
 	}
 }
 
@@ -165,8 +292,9 @@ func (da *DrawingArea) FocusLost() {
 	// If we're in the middle of drawing, finish the stroke
 	if da.isDragging {
 		da.isDragging = false
+		da.canvas.Lock()
 		da.canvas.FinishStroke()
-		da.BaseWidget.Refresh()
+		da.canvas.Unlock()
 	}
 }
 
@@ -175,36 +303,96 @@ func (da *DrawingArea) TypedRune(rune) {
 	// Not needed for drawing
 }
 
-// TypedKey handles special key presses
-func (da *DrawingArea) TypedKey(*fyne.KeyEvent) {
-	// Not needed for drawing
+// TypedKey passes special key presses, such as F11, to the window
+func (da *DrawingArea) TypedKey(key *fyne.KeyEvent) {
+	if da.onTypedKey != nil {
+		da.onTypedKey(key)
+	}
 }
 
+// MouseIn handles the pointer entering the drawing area
+func (da *DrawingArea) MouseIn(event *desktop.MouseEvent) {
+	da.MouseMoved(event)
+}
+
+// MouseMoved reports the pointer position to the window, which reveals the
+// toolbar in full-screen mode
+func (da *DrawingArea) MouseMoved(event *desktop.MouseEvent) {
+	if da.onPointer != nil {
+		da.onPointer(event.Position)
+	}
+}
+
+// MouseOut handles the pointer leaving the drawing area
+func (da *DrawingArea) MouseOut() {}
+
 // CreateRenderer creates the renderer for this widget
 func (da *DrawingArea) CreateRenderer() fyne.WidgetRenderer {
+	background := canvas.NewRectangle(color.RGBA{255, 255, 255, 255}) // White background
+	cached := canvas.NewImageFromImage(nil)
+	cached.FillMode = canvas.ImageFillStretch
+	live := canvas.NewImageFromImage(nil)
+	live.FillMode = canvas.ImageFillStretch
+
+	// The cursor is a vector overlay so moving it never touches the layers
+	cursor := canvas.NewCircle(color.Transparent)
+	cursor.StrokeColor = color.RGBA{0, 0, 0, 160}
+	cursor.StrokeWidth = 1
+	cursor.Hide()
+	eraserCursor := canvas.NewRectangle(color.RGBA{255, 255, 255, 96})
+	eraserCursor.StrokeColor = color.RGBA{128, 128, 128, 200}
+	eraserCursor.StrokeWidth = 1
+	eraserCursor.Hide()
+
 	return &drawingAreaRenderer{
-		area: da,
+		area:         da,
+		background:   background,
+		cached:       cached,
+		live:         live,
+		cursor:       cursor,
+		eraserCursor: eraserCursor,
+		layers:       []fyne.CanvasObject{background, cached, live},
+		objects:      []fyne.CanvasObject{background, cached, live, cursor, eraserCursor},
 	}
 }
 
-// drawingAreaRenderer renders the drawing area
+// drawingAreaRenderer renders the drawing area.
+// Finished strokes live in a cached raster layer; the stroke that is
+// currently being drawn has its own layer where only the dirty region is
+// redrawn on every refresh. The pen cursor is drawn on top of both.
 type drawingAreaRenderer struct {
-	area    *DrawingArea
-	objects []fyne.CanvasObject
+	area         *DrawingArea
+	background   *canvas.Rectangle
+	cached       *canvas.Image // Raster layer showing the finished strokes
+	cache        strokeCache
+	live         *canvas.Image // Raster layer showing the stroke in progress
+	liveLayer    liveLayer
+	cursor       *canvas.Circle    // Pen cursor while hovering
+	eraserCursor *canvas.Rectangle // Pen cursor while hovering in eraser mode
+	layers       []fyne.CanvasObject
+	objects      []fyne.CanvasObject
+	lastSize     fyne.Size // Size used for the last layout
 }
 
 // Layout arranges the objects in the renderer
 func (r *drawingAreaRenderer) Layout(size fyne.Size) {
-	// Only resize and position the background rectangle
-	// Leave drawing objects (lines/circles) in their original positions
-	if len(r.objects) > 0 {
-		// First object should be the background
-		bg := r.objects[0]
-		bg.Resize(size)
-		bg.Move(fyne.NewPos(0, 0))
+	// All layers always cover the whole widget
+	for _, obj := range r.layers {
+		obj.Resize(size)
+		obj.Move(fyne.NewPos(0, 0))
+	}
+	r.updateCursor()
+
+	// The layers are drawn through the view transform, so a new size means
+	// they have to be redrawn
+	if size != r.lastSize {
+		r.lastSize = size
+		r.area.needsUpdate.Store(true)
+		r.Refresh()
+		if r.area.onResize != nil {
+			r.area.onResize(size)
+		}
 	}
-	// Drawing objects (lines, circles) keep their absolute positions
-	// Don't modify them in Layout as they have specific coordinates
 }
 
 // MinSize returns the minimum size for the drawing area
@@ -219,96 +407,78 @@ func (r *drawingAreaRenderer) Objects() []fyne.CanvasObject {
 
 // Refresh updates the renderer display
 func (r *drawingAreaRenderer) Refresh() {
-	fmt.Printf("DEBUG: Renderer Refresh called (needsUpdate: %t)\n", r.area.needsUpdate)
-
-	if !r.area.needsUpdate {
-		fmt.Println("DEBUG: Skipping refresh - needsUpdate is false")
+	r.updateCursor()
+	// Clearing the flag first keeps a change made while drawing for the
+	// next frame
+	if !r.area.needsUpdate.Swap(false) {
 		return
 	}
 
-	// Clear existing objects
-	r.objects = make([]fyne.CanvasObject, 0)
-
-	// Create background
-	bg := canvas.NewRectangle(color.RGBA{255, 255, 255, 255}) // White background
-	r.objects = append(r.objects, bg)
+	// Hold the canvas while reading it; the tablet goroutine keeps adding
+	// samples concurrently
+	shown := r.area.displayed()
+	shown.Lock()
+	defer shown.Unlock()
+	dirty := shown.TakeDirty()
 
-	// Render all strokes
-	strokes := r.area.canvas.GetAllStrokes()
-	fmt.Printf("DEBUG: Rendering %d strokes\n", len(strokes))
-
-	for i, stroke := range strokes {
-		fmt.Printf("DEBUG: Rendering stroke %d with %d points\n", i+1, len(stroke.Points))
-		r.renderStroke(stroke)
+	size := r.area.Size()
+	scale := r.pixelScale()
+	width := int(float32(size.Width) * scale)
+	height := int(float32(size.Height) * scale)
+	view := r.area.View()
+
+	// Bring the cached layer up to date; this only redraws everything when
+	// the canvas was cleared or the view changed
+	if r.cache.update(shown, view, width, height, float64(scale)) {
+		r.cached.Image = r.cache.image
+		r.cached.Refresh()
 	}
 
-	r.area.needsUpdate = false
-	fmt.Println("DEBUG: Refresh complete")
-}
-
-// renderStroke renders a single stroke as a series of lines
-func (r *drawingAreaRenderer) renderStroke(stroke *drawing.Stroke) {
-	fmt.Printf("DEBUG: renderStroke called with %d points\n", len(stroke.Points))
-
-	if len(stroke.Points) == 0 {
-		fmt.Println("DEBUG: No points to draw")
-		return // No points to draw
+	// Redraw the part of the live stroke that changed since the last frame
+	if r.liveLayer.update(shown.CurrentStroke, dirty, view, width, height, float64(scale)) {
+		r.live.Image = r.liveLayer.image
+		r.live.Refresh()
 	}
 
-	// Get the size of the drawing area
-	size := r.area.Size()
-	fmt.Printf("DEBUG: Drawing area size: %v\n", size)
+	if debugEnabled(renderLog) {
+		renderLog.Debug("refresh", "strokes", len(shown.Strokes), "dirty", dirty)
+	}
+}
 
-	if size.Width == 0 || size.Height == 0 {
-		fmt.Println("DEBUG: Invalid drawing area size")
+// updateCursor moves the pen cursor to the hover position, or hides it
+func (r *drawingAreaRenderer) updateCursor() {
+	hover := r.area.hoverState()
+	if hover == nil {
+		r.cursor.Hide()
+		r.eraserCursor.Hide()
 		return
 	}
 
-	// Handle single point (dot)
-	if len(stroke.Points) == 1 {
-		fmt.Println("DEBUG: Rendering single point as circle")
-		point := stroke.Points[0]
-		x := float32(point.X * float64(size.Width))
-		y := float32(point.Y * float64(size.Height))
-
-		// Create a small circle for single points
-		circle := canvas.NewCircle(stroke.Color)
-		radius := float32(stroke.GetWidth(point.Pressure)) / 2
-		circle.Resize(fyne.NewSize(radius*2, radius*2))
-		circle.Move(fyne.NewPos(x-radius, y-radius))
-		circle.FillColor = stroke.Color
-
-		r.objects = append(r.objects, circle)
-		fmt.Printf("DEBUG: Added circle at (%f, %f) with radius %f\n", x, y, radius)
-		return
+	var shape, other fyne.CanvasObject = r.cursor, r.eraserCursor
+	if hover.Eraser {
+		shape, other = other, shape
 	}
+	other.Hide()
+
+	view := r.area.View()
+	x, y := view.ToScreen(hover.X, hover.Y)
+	radius := float32(math.Max(hover.Width*view.Scale/2, minCursorRadius))
+	shape.Resize(fyne.NewSize(2*radius, 2*radius))
+	shape.Move(fyne.NewPos(float32(x)-radius, float32(y)-radius))
+	shape.Show()
+	shape.Refresh()
+}
 
-	// Draw lines between consecutive points
-	fmt.Printf("DEBUG: Rendering %d line segments\n", len(stroke.Points)-1)
-	for i := 0; i < len(stroke.Points)-1; i++ {
-		p1 := stroke.Points[i]
-		p2 := stroke.Points[i+1]
-
-		// Convert normalized coordinates to screen coordinates
-		x1 := float32(p1.X * float64(size.Width))
-		y1 := float32(p1.Y * float64(size.Height))
-		x2 := float32(p2.X * float64(size.Width))
-		y2 := float32(p2.Y * float64(size.Height))
-
-		// Create line
-		line := canvas.NewLine(stroke.Color)
-		line.Position1 = fyne.NewPos(x1, y1)
-		line.Position2 = fyne.NewPos(x2, y2)
-
-		// Set line width based on pressure (average of the two points)
-		avgPressure := (p1.Pressure + p2.Pressure) / 2.0
-		line.StrokeWidth = float32(stroke.GetWidth(avgPressure))
-
-		r.objects = append(r.objects, line)
-		fmt.Printf("DEBUG: Added line from (%f,%f) to (%f,%f) width %f\n",
-			x1, y1, x2, y2, line.StrokeWidth)
+// pixelScale returns the number of device pixels per Fyne unit
+func (r *drawingAreaRenderer) pixelScale() float32 {
+	app := fyne.CurrentApp()
+	if app == nil {
+		return 1
+	}
+	if c := app.Driver().CanvasForObject(r.area); c != nil && c.Scale() > 0 {
+		return c.Scale()
 	}
-	fmt.Printf("DEBUG: renderStroke complete - total objects: %d\n", len(r.objects))
+	return 1
 }
 
 // Destroy cleans up the renderer
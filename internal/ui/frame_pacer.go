@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxFrameRate is the refresh cap used when none is configured
+const DefaultMaxFrameRate = 60
+
+// FrameStats reports input and rendering rates over the last measurement window
+type FrameStats struct {
+	SamplesPerSecond float64 // Pen samples added to the model
+	FramesPerSecond  float64 // Refreshes of the drawing area
+}
+
+// framePacer decouples the pen sample rate from the UI refresh rate.
+// Samples are added to the canvas as they arrive, while the drawing area is
+// refreshed at most once per frame interval and only if the canvas changed.
+type framePacer struct {
+	area     *DrawingArea
+	interval time.Duration
+
+	samples atomic.Uint64    // Samples counted since the last stats update
+	frames  atomic.Uint64    // Frames rendered since the last stats update
+	onStats func(FrameStats) // Receives the rates every second, may be nil
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newFramePacer creates a pacer that refreshes the area at up to maxFPS and
+// passes the measured rates to onStats every second
+func newFramePacer(area *DrawingArea, maxFPS int, onStats func(FrameStats)) *framePacer {
+	if maxFPS <= 0 {
+		maxFPS = DefaultMaxFrameRate
+	}
+
+	return &framePacer{
+		area:     area,
+		interval: time.Second / time.Duration(maxFPS),
+		onStats:  onStats,
+		stop:     make(chan struct{}),
+	}
+}
+
+// CountSample records that a pen sample was added to the canvas
+func (fp *framePacer) CountSample() {
+	fp.samples.Add(1)
+}
+
+// Run refreshes the drawing area whenever the canvas is dirty or the pen
+// cursor moved, at most once per frame interval. It returns when Stop is called.
+func (fp *framePacer) Run() {
+	ticker := time.NewTicker(fp.interval)
+	defer ticker.Stop()
+
+	statsTicker := time.NewTicker(time.Second)
+	defer statsTicker.Stop()
+	lastStats := time.Now()
+
+	for {
+		select {
+		case <-fp.stop:
+			return
+
+		case <-ticker.C:
+			shown := fp.area.displayed()
+			shown.Lock()
+			dirty := shown.IsDirty()
+			shown.Unlock()
+
+			hover := fp.area.takeHoverChanged()
+			if dirty {
+				fp.area.Refresh()
+				fp.frames.Add(1)
+			} else if hover {
+				// Only the cursor moved, so the layers stay as they are
+				fp.area.refreshHover()
+			}
+
+		case now := <-statsTicker.C:
+			elapsed := now.Sub(lastStats).Seconds()
+			lastStats = now
+
+			stats := FrameStats{
+				SamplesPerSecond: float64(fp.samples.Swap(0)) / elapsed,
+				FramesPerSecond:  float64(fp.frames.Swap(0)) / elapsed,
+			}
+
+			if fp.onStats != nil {
+				fp.onStats(stats)
+			}
+			if stats.SamplesPerSecond > 0 || stats.FramesPerSecond > 0 {
+				renderLog.Debug("frame stats",
+					"samplesPerSec", stats.SamplesPerSecond, "framesPerSec", stats.FramesPerSecond)
+			}
+		}
+	}
+}
+
+// Stop ends the refresh loop
+func (fp *framePacer) Stop() {
+	fp.stopOnce.Do(func() {
+		close(fp.stop)
+	})
+}
@@ -0,0 +1,210 @@
+package ui
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// In full-screen mode the toolbar floats over the board and stays hidden
+// until the pointer or the pen touches the top edge, or the toolbar action
+// is triggered
+const (
+	revealZone = 4  // Height of the strip along the top edge that reveals the toolbar
+	hideMargin = 24 // Distance below the toolbar at which the pointer hides it again
+	hideDelay  = time.Second
+)
+
+// screenState tracks full-screen mode and hiding the toolbar
+type screenState struct {
+	mu   sync.Mutex
+	full bool
+	hide *time.Timer // Pending hide of the toolbar, nil if none
+
+	// Size of the canvas before full-screen mode grew it, or zero. Guarded
+	// by the canvas lock.
+	restoreWidth, restoreHeight float64
+}
+
+// SetFullScreen switches between windowed and full-screen mode. In
+// full-screen mode the canvas grows to the shape of the screen, so the
+// whole tablet maps onto the whole screen, and leaving it restores the
+// previous size unless strokes were drawn in the added room.
+//
+// The window fills the monitor it is on. Choosing another monitor is not
+// supported: Fyne offers no way to list monitors or move a window.
+func (ww *WhiteboardWindow) SetFullScreen(full bool) {
+	ww.screen.mu.Lock()
+	if ww.screen.full == full {
+		ww.screen.mu.Unlock()
+		return
+	}
+	ww.screen.full = full
+	ww.cancelHideLocked()
+	ww.screen.mu.Unlock()
+
+	ww.overlay.Hide()
+	if full {
+		ww.dock.Remove(ww.toolbar)
+		ww.overlay.Add(ww.toolbar)
+	} else {
+		ww.overlay.Remove(ww.toolbar)
+		ww.dock.Add(ww.toolbar)
+	}
+	ww.window.SetFullScreen(full)
+	if !full {
+		ww.canvas.Lock()
+		ww.restoreCanvas()
+		ww.canvas.Unlock()
+	}
+	inputLog.Info("full-screen mode changed", "fullScreen", full)
+}
+
+// FullScreen reports whether the window is in full-screen mode
+func (ww *WhiteboardWindow) FullScreen() bool {
+	ww.screen.mu.Lock()
+	defer ww.screen.mu.Unlock()
+	return ww.screen.full
+}
+
+// typedKey handles the keys that work whatever has the focus
+func (ww *WhiteboardWindow) typedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyF11:
+		ww.SetFullScreen(!ww.FullScreen())
+	case fyne.KeyEscape:
+		ww.SetFullScreen(false)
+	}
+}
+
+// areaResized fits the canvas to the drawing area once it fills the screen
+func (ww *WhiteboardWindow) areaResized(size fyne.Size) {
+	ww.canvas.Lock()
+	defer ww.canvas.Unlock()
+	ww.fitCanvas(size)
+}
+
+// fitCanvas grows the canvas to the shape of the drawing area in
+// full-screen mode and maps the tablet onto it. The canvas never shrinks
+// here, so no stroke ends up outside it. The canvas lock must be held.
+func (ww *WhiteboardWindow) fitCanvas(size fyne.Size) {
+	if !ww.FullScreen() || size.Width <= 0 || size.Height <= 0 {
+		return
+	}
+
+	aspect := float64(size.Width) / float64(size.Height)
+	width, height := ww.canvas.Width, ww.canvas.Height
+	if width/height < aspect {
+		width = height * aspect
+	} else {
+		height = width / aspect
+	}
+	// Rounding in the layout must not grow the canvas bit by bit
+	if math.Abs(width-ww.canvas.Width) < 1 && math.Abs(height-ww.canvas.Height) < 1 {
+		return
+	}
+
+	if ww.screen.restoreWidth == 0 {
+		ww.screen.restoreWidth, ww.screen.restoreHeight = ww.canvas.Width, ww.canvas.Height
+	}
+	ww.canvas.Resize(width, height)
+	ww.updateMapper()
+	renderLog.Info("canvas fitted to the screen", "width", width, "height", height)
+}
+
+// restoreCanvas gives the canvas back the size it had before full-screen
+// mode grew it. If strokes were drawn in the added room the canvas keeps its
+// size instead, since shrinking it would cut them off. The canvas lock must
+// be held.
+func (ww *WhiteboardWindow) restoreCanvas() {
+	width, height := ww.screen.restoreWidth, ww.screen.restoreHeight
+	if width == 0 {
+		return
+	}
+	ww.screen.restoreWidth, ww.screen.restoreHeight = 0, 0
+
+	// Points rather than bounds, so that a line along the edge of the
+	// window does not count
+	for _, stroke := range ww.canvas.GetAllStrokes() {
+		for _, p := range stroke.Points {
+			if p.X > width || p.Y > height {
+				renderLog.Info("keeping the full-screen canvas size, strokes lie outside the previous one",
+					"width", ww.canvas.Width, "height", ww.canvas.Height)
+				return
+			}
+		}
+	}
+	ww.canvas.Resize(width, height)
+	ww.updateMapper()
+	renderLog.Info("canvas restored to its size before full-screen mode", "width", width, "height", height)
+}
+
+// pointerMoved reveals the toolbar when the pointer touches the top edge of
+// the screen, and hides it again once the pointer moves away below it
+func (ww *WhiteboardWindow) pointerMoved(pos fyne.Position) {
+	ww.screen.mu.Lock()
+	defer ww.screen.mu.Unlock()
+	if !ww.screen.full {
+		return
+	}
+
+	switch {
+	case pos.Y <= revealZone:
+		ww.cancelHideLocked()
+		ww.overlay.Show()
+	case !ww.overlay.Visible():
+	case pos.Y <= ww.overlay.Size().Height+hideMargin:
+		ww.cancelHideLocked() // Heading for the toolbar
+	case ww.screen.hide == nil:
+		ww.screen.hide = time.AfterFunc(hideDelay, ww.hideToolbar)
+	}
+}
+
+// penHovered treats the pen hovering near the top edge like the pointer
+func (ww *WhiteboardWindow) penHovered(state tablet.PenState, x, y float64) {
+	if state != tablet.PenHover || !ww.FullScreen() {
+		return
+	}
+	sx, sy := ww.drawingArea.View().ToScreen(x, y)
+	ww.pointerMoved(fyne.NewPos(float32(sx), float32(sy)))
+}
+
+// toggleToolbar shows or hides the toolbar in full-screen mode
+func (ww *WhiteboardWindow) toggleToolbar() {
+	ww.screen.mu.Lock()
+	defer ww.screen.mu.Unlock()
+	if !ww.screen.full {
+		inputLog.Debug("toolbar is always shown in a window")
+		return
+	}
+
+	ww.cancelHideLocked()
+	if ww.overlay.Visible() {
+		ww.overlay.Hide()
+	} else {
+		ww.overlay.Show()
+	}
+}
+
+// hideToolbar hides the toolbar when its timer expires
+func (ww *WhiteboardWindow) hideToolbar() {
+	ww.screen.mu.Lock()
+	defer ww.screen.mu.Unlock()
+	ww.screen.hide = nil
+	if ww.screen.full {
+		ww.overlay.Hide()
+	}
+}
+
+// cancelHideLocked stops a pending hide of the toolbar. The screen lock
+// must be held.
+func (ww *WhiteboardWindow) cancelHideLocked() {
+	if ww.screen.hide != nil {
+		ww.screen.hide.Stop()
+		ww.screen.hide = nil
+	}
+}
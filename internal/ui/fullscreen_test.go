@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/tablet"
+)
+
+// fullScreenWindow is a whiteboard with just what resizing the canvas
+// needs, already in full-screen mode
+func fullScreenWindow() *WhiteboardWindow {
+	ranges := tablet.EvdevRanges{X: tablet.AbsRange{Max: 32000}, Y: tablet.AbsRange{Max: 20000}, Pressure: tablet.AbsRange{Max: 8191}}
+	ww := &WhiteboardWindow{
+		canvas: drawing.NewCanvas(1200, 900),
+		source: tablet.NewEvdevSource(nil, "test", ranges),
+	}
+	ww.screen.full = true
+	return ww
+}
+
+// leaveFullScreen restores the canvas as SetFullScreen(false) does
+func leaveFullScreen(ww *WhiteboardWindow) {
+	ww.screen.full = false
+	ww.restoreCanvas()
+}
+
+func TestFullScreenRestoresCanvasSize(t *testing.T) {
+	ww := fullScreenWindow()
+	ww.fitCanvas(fyne.NewSize(1920, 1080))
+	if ww.canvas.Width != 1600 || ww.canvas.Height != 900 {
+		t.Fatalf("full-screen canvas %vx%v, want 1600x900", ww.canvas.Width, ww.canvas.Height)
+	}
+	// Layout rounding does not change the size to return to
+	ww.fitCanvas(fyne.NewSize(1920, 1081))
+
+	// A line along the old edge is not drawn in the added room
+	ww.canvas.StartStroke(drawing.Point{X: 1199, Y: 10, Pressure: 1})
+	ww.canvas.FinishStroke()
+	leaveFullScreen(ww)
+	if ww.canvas.Width != 1200 || ww.canvas.Height != 900 {
+		t.Errorf("canvas %vx%v after full screen, want 1200x900", ww.canvas.Width, ww.canvas.Height)
+	}
+}
+
+func TestFullScreenKeepsCanvasWithStrokesInAddedRoom(t *testing.T) {
+	ww := fullScreenWindow()
+	ww.fitCanvas(fyne.NewSize(1920, 1080))
+	ww.canvas.StartStroke(drawing.Point{X: 1500, Y: 10, Pressure: 1})
+	ww.canvas.FinishStroke()
+
+	leaveFullScreen(ww)
+	if ww.canvas.Width != 1600 {
+		t.Errorf("canvas width %v, want the full-screen width 1600 kept", ww.canvas.Width)
+	}
+	// The next full-screen session starts from the kept size
+	ww.screen.full = true
+	ww.fitCanvas(fyne.NewSize(1920, 1080))
+	leaveFullScreen(ww)
+	if ww.canvas.Width != 1600 {
+		t.Errorf("canvas width %v, want 1600", ww.canvas.Width)
+	}
+}
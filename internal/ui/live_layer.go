@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/render"
+)
+
+// liveLayer holds the raster image of the stroke currently being drawn.
+// Each update only clears and redraws the region the canvas reported as
+// dirty, so the per-frame cost follows the pen rather than the window size.
+type liveLayer struct {
+	image *image.RGBA
+	view  drawing.View // Pixel view the image was drawn with
+}
+
+// update redraws the dirty part of the live stroke and reports whether the
+// image changed. A change of size or view redraws the whole layer.
+func (ll *liveLayer) update(stroke *drawing.Stroke, dirty drawing.Rect, view drawing.View, width, height int, pixelScale float64) bool {
+	if width <= 0 || height <= 0 {
+		return false
+	}
+
+	view = view.Scaled(pixelScale)
+
+	var clip image.Rectangle
+	if ll.image == nil ||
+		ll.image.Bounds().Dx() != width || ll.image.Bounds().Dy() != height ||
+		ll.view != view {
+		// Transparent so the cached layer shows through
+		ll.image = image.NewRGBA(image.Rect(0, 0, width, height))
+		ll.view = view
+		clip = ll.image.Bounds()
+	} else {
+		if dirty.Empty() {
+			return false
+		}
+		clip = pixelRect(dirty, view).Intersect(ll.image.Bounds())
+		draw.Draw(ll.image, clip, image.Transparent, image.Point{}, draw.Src)
+	}
+
+	render.DrawStrokeClipped(ll.image, stroke, view, clip)
+	return true
+}
+
+// pixelRect converts a canvas rectangle to the pixels it covers in the view
+func pixelRect(r drawing.Rect, view drawing.View) image.Rectangle {
+	minX, minY := view.ToScreen(r.MinX, r.MinY)
+	maxX, maxY := view.ToScreen(r.MaxX, r.MaxY)
+
+	// Pad by a pixel for anti-aliasing
+	return image.Rect(
+		int(math.Floor(minX))-1, int(math.Floor(minY))-1,
+		int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1,
+	)
+}
@@ -0,0 +1,21 @@
+package ui
+
+import (
+	"context"
+	"log/slog"
+
+	"xp-pen-controller/internal/logging"
+)
+
+// Subsystem loggers used by the UI
+var (
+	inputLog  = logging.For(logging.Input)
+	renderLog = logging.For(logging.Render)
+	ioLog     = logging.For(logging.IO)
+)
+
+// debugEnabled reports whether debug records of the logger are written.
+// Hot paths check it before building log attributes.
+func debugEnabled(logger *slog.Logger) bool {
+	return logger.Enabled(context.Background(), slog.LevelDebug)
+}
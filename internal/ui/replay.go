@@ -0,0 +1,173 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// replayFrameInterval is how often the replay advances while playing
+const replayFrameInterval = time.Second / 30
+
+// replaySpeeds are the playback speeds offered in the replay bar
+var replaySpeeds = map[string]float64{"0.5x": 0.5, "1x": 1, "2x": 2, "4x": 4, "8x": 8}
+
+// replayPlayer plays the board back in the drawing area. It draws into a
+// canvas of its own, so the document is left untouched.
+type replayPlayer struct {
+	area   *DrawingArea
+	replay *drawing.Replay
+	canvas *drawing.Canvas // Canvas shown while replaying
+
+	mu       sync.Mutex
+	position time.Duration
+	speed    float64
+	playing  bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	bar       *fyne.Container
+	playPause *widget.Button
+	slider    *widget.Slider
+	timeLabel *widget.Label
+	seeking   atomic.Bool // The slider is being moved by the player, not the user
+}
+
+// newReplayPlayer creates a player for the current strokes of the canvas
+// and shows its first frame in the drawing area
+func newReplayPlayer(area *DrawingArea, c *drawing.Canvas) *replayPlayer {
+	c.Lock()
+	replay := drawing.NewReplay(c)
+	c.Unlock()
+
+	rp := &replayPlayer{
+		area:   area,
+		replay: replay,
+		canvas: replay.NewCanvas(),
+		speed:  1,
+		stop:   make(chan struct{}),
+	}
+
+	rp.playPause = widget.NewButton("Play", rp.togglePlaying)
+	rp.slider = widget.NewSlider(0, replay.Duration().Seconds())
+	rp.slider.Step = replayFrameInterval.Seconds()
+	rp.slider.OnChanged = func(seconds float64) {
+		if !rp.seeking.Load() {
+			rp.Seek(time.Duration(seconds * float64(time.Second)))
+		}
+	}
+	speedSelect := widget.NewSelect([]string{"0.5x", "1x", "2x", "4x", "8x"}, func(name string) {
+		rp.SetSpeed(replaySpeeds[name])
+	})
+	speedSelect.SetSelected("1x")
+	rp.timeLabel = widget.NewLabel("")
+
+	rp.bar = container.NewBorder(nil, nil,
+		rp.playPause,
+		container.NewHBox(rp.timeLabel, speedSelect),
+		rp.slider,
+	)
+
+	area.ShowCanvas(rp.canvas)
+	rp.Seek(0)
+	return rp
+}
+
+// Run advances the replay while it is playing until Stop is called
+func (rp *replayPlayer) Run() {
+	ticker := time.NewTicker(replayFrameInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-rp.stop:
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(last)
+			last = now
+
+			rp.mu.Lock()
+			playing := rp.playing
+			position := rp.position + time.Duration(float64(elapsed)*rp.speed)
+			rp.mu.Unlock()
+
+			if playing {
+				rp.Seek(position)
+			}
+		}
+	}
+}
+
+// Stop ends playback and shows the document again
+func (rp *replayPlayer) Stop() {
+	rp.stopOnce.Do(func() {
+		close(rp.stop)
+		rp.area.ShowCanvas(nil)
+	})
+}
+
+// Seek shows the board at the given time. Playback pauses at the end.
+func (rp *replayPlayer) Seek(position time.Duration) {
+	duration := rp.replay.Duration()
+	position = max(0, min(position, duration))
+
+	rp.mu.Lock()
+	rp.position = position
+	if position == duration && rp.playing {
+		rp.playing = false
+		rp.playPause.SetText("Play")
+	}
+	rp.mu.Unlock()
+
+	rp.canvas.Lock()
+	rp.replay.Render(rp.canvas, position)
+	rp.canvas.Unlock()
+
+	// The frame pacer picks up the change; only the controls are updated here
+	rp.seeking.Store(true)
+	rp.slider.SetValue(position.Seconds())
+	rp.seeking.Store(false)
+	rp.timeLabel.SetText(fmt.Sprintf("%s / %s", formatReplayTime(position), formatReplayTime(duration)))
+}
+
+// SetSpeed sets the playback speed relative to real time
+func (rp *replayPlayer) SetSpeed(speed float64) {
+	if speed <= 0 {
+		return
+	}
+	rp.mu.Lock()
+	rp.speed = speed
+	rp.mu.Unlock()
+}
+
+// togglePlaying starts or pauses playback. Playing at the end starts over.
+func (rp *replayPlayer) togglePlaying() {
+	rp.mu.Lock()
+	rp.playing = !rp.playing
+	restart := rp.playing && rp.position >= rp.replay.Duration()
+	if rp.playing {
+		rp.playPause.SetText("Pause")
+	} else {
+		rp.playPause.SetText("Play")
+	}
+	rp.mu.Unlock()
+
+	if restart {
+		rp.Seek(0)
+	}
+}
+
+// formatReplayTime formats a replay position as minutes and seconds
+func formatReplayTime(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
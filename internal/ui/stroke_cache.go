@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"image"
+
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/render"
+)
+
+// strokeCache keeps finished strokes baked into a raster image so that a
+// refresh only has to draw strokes finished since the previous refresh
+type strokeCache struct {
+	image    *image.RGBA
+	canvas   *drawing.Canvas // Canvas the image was drawn from
+	view     drawing.View    // Pixel view the image was drawn with
+	revision uint64          // Canvas revision the image was drawn from
+	count    int             // Number of finished strokes drawn into the image
+}
+
+// update brings the cached image up to date with the canvas and reports
+// whether the image changed. The cache is only rebuilt from scratch when the
+// canvas, its revision, the view or the pixel size changes.
+func (sc *strokeCache) update(c *drawing.Canvas, view drawing.View, width, height int, pixelScale float64) bool {
+	if width <= 0 || height <= 0 {
+		return false
+	}
+
+	view = view.Scaled(pixelScale)
+	changed := false
+
+	if sc.image == nil ||
+		sc.image.Bounds().Dx() != width || sc.image.Bounds().Dy() != height ||
+		sc.canvas != c || sc.view != view || sc.revision != c.Revision() || sc.count > len(c.Strokes) {
+		// Transparent so the background rectangle shows through
+		sc.image = image.NewRGBA(image.Rect(0, 0, width, height))
+		sc.canvas = c
+		sc.view = view
+		sc.revision = c.Revision()
+		sc.count = 0
+		changed = true
+	}
+
+	// Strokes are only ever appended between revisions, so draw the new ones
+	if sc.count < len(c.Strokes) {
+		render.DrawStrokes(sc.image, c.Strokes[sc.count:], sc.view)
+		sc.count = len(c.Strokes)
+		changed = true
+	}
+
+	return changed
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"xp-pen-controller/internal/drawing"
+)
+
+// benchmarkCanvas returns a canvas with the given number of finished
+// strokes scattered over it
+func benchmarkCanvas(strokes int) *drawing.Canvas {
+	c := drawing.NewCanvas(1200, 900)
+	for i := range strokes {
+		x := float64(i*37%1100) + 50
+		y := float64(i*53%800) + 50
+		c.StartStroke(drawing.Point{X: x, Y: y, Pressure: 0.5})
+		for j := 1; j < 20; j++ {
+			angle := float64(i+j) / 3
+			c.AddPointToCurrentStroke(drawing.Point{
+				X:        x + float64(j)*2*math.Cos(angle),
+				Y:        y + float64(j)*2*math.Sin(angle),
+				Pressure: 0.3 + 0.02*float64(j),
+			})
+		}
+		c.FinishStroke()
+	}
+	return c
+}
+
+// BenchmarkStrokeCacheUpdate measures one display frame while a stroke is
+// drawn on top of many finished ones: the cached layer is brought up to
+// date and the dirty part of the live stroke is redrawn. The cost should
+// not depend on the number of finished strokes.
+func BenchmarkStrokeCacheUpdate(b *testing.B) {
+	const width, height = 1200, 900
+	for _, strokes := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("strokes=%d", strokes), func(b *testing.B) {
+			c := benchmarkCanvas(strokes)
+			view := drawing.FitView(c.Width, c.Height, width, height)
+
+			var cache strokeCache
+			var live liveLayer
+			cache.update(c, view, width, height, 1)
+			c.StartStroke(drawing.Point{X: 100, Y: 450, Pressure: 0.5})
+			c.TakeDirty()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// A long stroke is started again so the live stroke stays
+				// the same size however long the benchmark runs
+				if len(c.CurrentStroke.Points) == 500 {
+					c.CurrentStroke = nil
+					c.StartStroke(drawing.Point{X: 100, Y: 450, Pressure: 0.5})
+				}
+				n := len(c.CurrentStroke.Points)
+				c.AddPointToCurrentStroke(drawing.Point{
+					X:        100 + float64(n)*2,
+					Y:        450 + 100*math.Sin(float64(n)/20),
+					Pressure: 0.6,
+				})
+
+				if cache.update(c, view, width, height, 1) {
+					b.Fatal("finished strokes were redrawn")
+				}
+				live.update(c.CurrentStroke, c.TakeDirty(), view, width, height, 1)
+			}
+		})
+	}
+}
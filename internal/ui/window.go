@@ -1,15 +1,29 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"image/color"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"xp-pen-controller/internal/collab"
+	"xp-pen-controller/internal/control"
 	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/mirror"
+	"xp-pen-controller/internal/render"
 	"xp-pen-controller/internal/tablet"
 )
 
@@ -20,7 +34,23 @@ type WhiteboardWindow struct {
 	canvas      *drawing.Canvas
 	drawingArea *DrawingArea
 	tablet      *tablet.TabletController
+	source      tablet.PenSource // Where pen input comes from, the tablet by default
 	mapper      *tablet.CoordinateMapper
+	curve       float64            // Pressure curve exponent, 0 for linear
+	smoother    *tablet.Smoother   // Reduces pen jitter
+	pen         *tablet.PenTracker // Debounced pen state; guarded by the canvas lock
+	pacer       *framePacer
+	bindings    map[string]Action // Actions of express keys and pen buttons
+	path        string            // File the drawing was opened from or saved to; guarded by the canvas lock
+	replay      *replayPlayer     // Active replay, nil while editing
+	bottom      *fyne.Container   // Holds the replay controls
+	toolbar     fyne.CanvasObject // Buttons, in the dock or the overlay
+	stats       *widget.Label     // Pen sample rate and frame rate
+	dock        *fyne.Container   // Holds the toolbar above the board in a window
+	overlay     *fyne.Container   // Holds the toolbar floating over the board in full-screen mode
+	screen      screenState       // Full-screen mode
+	collab      *collab.Session   // Shared drawing, nil when drawing alone
+	control     *control.Server   // Scripting API, nil if not served
 }
 
 // NewWhiteboardWindow creates a new whiteboard window
@@ -39,22 +69,34 @@ func NewWhiteboardWindow() *WhiteboardWindow {
 	tabletController := tablet.NewTabletController()
 
 	// Create coordinate mapper (will be updated when tablet connects)
-	mapper := tablet.NewCoordinateMapper(32767, 32767, 1200, 900)
+	mapper := tablet.NewCoordinateMapper(32767, 32767, drawingCanvas.Width, drawingCanvas.Height)
 
 	ww := &WhiteboardWindow{
-		app:    app,
-		window: window,
-		canvas: drawingCanvas,
-		tablet: tabletController,
-		mapper: mapper,
+		app:      app,
+		window:   window,
+		canvas:   drawingCanvas,
+		tablet:   tabletController,
+		source:   tabletController,
+		mapper:   mapper,
+		smoother: tablet.NewSmoother(0),
 	}
+	ww.SetTipDebounce(0)
+	ww.bindings, _ = ParseBindings(nil)
+	tabletController.SetKeyHandler(ww.handleKey)
 
 	// Create custom drawing area
 	ww.drawingArea = NewDrawingArea(drawingCanvas)
+	ww.drawingArea.onResize = ww.areaResized
+	ww.drawingArea.onPointer = ww.pointerMoved
+	ww.drawingArea.onTypedKey = ww.typedKey
+	ww.pacer = newFramePacer(ww.drawingArea, DefaultMaxFrameRate, ww.showFrameStats)
 
 	// Setup UI
 	ww.setupUI()
 
+	// A stroke must not stay open while another window has the input
+	app.Lifecycle().SetOnExitedForeground(ww.endStroke)
+
 	return ww
 }
 
@@ -63,47 +105,73 @@ func (ww *WhiteboardWindow) setupUI() {
 	// Create minimal toolbar
 	clearButton := widget.NewButton("Test Draw", func() {
 		// Test: Add a stroke manually to verify the drawing system works
-		testPoint1 := drawing.Point{X: 0.5, Y: 0.2, Pressure: 0.7}
-		testPoint2 := drawing.Point{X: 0.7, Y: 0.6, Pressure: 0.7}
+		testPoint1 := drawing.Point{X: 0.5 * ww.canvas.Width, Y: 0.2 * ww.canvas.Height, Pressure: 0.7}
+		testPoint2 := drawing.Point{X: 0.7 * ww.canvas.Width, Y: 0.6 * ww.canvas.Height, Pressure: 0.7}
+		ww.canvas.Lock()
 		ww.canvas.StartStroke(testPoint1)
 		ww.canvas.AddPointToCurrentStroke(testPoint2)
 		ww.canvas.FinishStroke()
-		ww.drawingArea.Refresh()
-		println("Test stroke added manually")
+		ww.canvas.Unlock()
+		inputLog.Info("test stroke added manually")
 	})
 
 	saveButton := widget.NewButton("Save", func() {
-		// TODO: Implement save functionality
-		// For now, just show a placeholder
-		dialog.ShowInformation("Save", "Save functionality coming soon!", ww.window)
+		ww.save()
 	})
 
 	clearButton2 := widget.NewButton("Clear", func() {
+		ww.canvas.Lock()
 		ww.canvas.Clear()
-		ww.drawingArea.Refresh()
+		ww.canvas.Unlock()
+	})
+
+	replayButton := widget.NewButton("Replay", func() {
+		ww.ToggleReplay()
 	})
 
 	quitButton := widget.NewButton("Quit", func() {
 		ww.Close()
 	})
 
+	brushes := map[string]drawing.Brush{"Round": drawing.BrushRound, "Chisel": drawing.BrushChisel}
+	brushSelect := widget.NewSelect([]string{"Round", "Chisel"}, func(name string) {
+		ww.SetBrush(brushes[name])
+	})
+	brushSelect.SetSelected("Round")
+
+	ww.stats = widget.NewLabel("")
+
 	// Create toolbar with minimal buttons
-	toolbar := container.NewHBox(
+	ww.toolbar = container.NewHBox(
 		clearButton,
 		clearButton2,
 		saveButton,
+		replayButton,
 		quitButton,
+		brushSelect,
 		widget.NewSeparator(),
 		widget.NewLabel("XP-Pen Whiteboard"),
+		widget.NewSeparator(),
+		ww.stats,
 	)
 
+	// The replay controls appear below the drawing area while replaying
+	ww.bottom = container.NewStack()
+
+	// The toolbar sits above the board in a window and floats over it in
+	// full-screen mode, so revealing it does not resize the board
+	ww.dock = container.NewStack(ww.toolbar)
+	ww.overlay = container.NewStack(canvas.NewRectangle(theme.OverlayBackgroundColor()))
+	ww.overlay.Hide()
+	board := container.NewStack(ww.drawingArea, container.NewVBox(ww.overlay))
+
 	// Create main layout with toolbar at top and drawing area filling the rest
 	content := container.NewBorder(
-		toolbar,        // top
-		nil,            // bottom
-		nil,            // left
-		nil,            // right
-		ww.drawingArea, // center - drawing area fills remaining space
+		ww.dock,   // top
+		ww.bottom, // bottom
+		nil,       // left
+		nil,       // right
+		board,     // center - drawing area fills remaining space
 	)
 
 	ww.window.SetContent(content)
@@ -115,18 +183,265 @@ func (ww *WhiteboardWindow) setupUI() {
 	ww.setupKeyboardShortcuts()
 }
 
+// ServeMirror shares the board read-only with web browsers on the address,
+// e.g. ":8080"
+func (ww *WhiteboardWindow) ServeMirror(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start mirror: %w", err)
+	}
+
+	server := mirror.NewServer(ww.canvas)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			ioLog.Error("mirror stopped", "err", err)
+		}
+	}()
+	ioLog.Info("mirroring the board", "url", "http://"+listener.Addr().String()+"/")
+	return nil
+}
+
+// Collaborate shares the board with other whiteboards as the given user,
+// drawing in the given colour (the current one if nil). With listen set,
+// other whiteboards can join on that address; with join set, this one joins
+// the whiteboard there and keeps reconnecting. All of them must use the
+// same token.
+func (ww *WhiteboardWindow) Collaborate(user string, col color.Color, token, listen, join string) error {
+	session := collab.NewSession(ww.canvas, user, col)
+	session.SetToken(token)
+	if listen != "" {
+		if _, err := session.Listen(listen); err != nil {
+			session.Close()
+			return err
+		}
+	}
+	if join != "" {
+		session.Connect(join)
+	}
+	ww.collab = session
+	ioLog.Info("collaborating", "user", user)
+	return nil
+}
+
+// ToggleReplay starts playing the board back as it was drawn, or returns
+// to editing if a replay is showing
+func (ww *WhiteboardWindow) ToggleReplay() {
+	if ww.replay != nil {
+		ww.replay.Stop()
+		ww.replay = nil
+		ww.bottom.RemoveAll()
+		inputLog.Info("replay closed")
+		return
+	}
+
+	ww.replay = newReplayPlayer(ww.drawingArea, ww.canvas)
+	ww.bottom.Add(ww.replay.bar)
+	go ww.replay.Run()
+	inputLog.Info("replay opened", "duration", ww.replay.replay.Duration())
+}
+
+// SetBrush selects the brush used for new strokes
+func (ww *WhiteboardWindow) SetBrush(brush drawing.Brush) {
+	ww.canvas.Lock()
+	ww.canvas.Brush = brush
+	ww.canvas.Unlock()
+}
+
+// SetColor selects the colour of new strokes
+func (ww *WhiteboardWindow) SetColor(col color.Color) {
+	ww.canvas.Lock()
+	ww.canvas.Color = col
+	ww.canvas.Unlock()
+}
+
 // setupKeyboardShortcuts configures keyboard shortcuts
 func (ww *WhiteboardWindow) setupKeyboardShortcuts() {
 	// Clear canvas shortcut (Ctrl+N)
 	ww.window.Canvas().SetOnTypedKey(func(key *fyne.KeyEvent) {
 		if key.Name == fyne.KeyN && key.Physical.ScanCode != 0 {
 			// Check for Ctrl modifier (this is simplified, real implementation would need proper modifier detection)
+			ww.canvas.Lock()
 			ww.canvas.Clear()
-			ww.drawingArea.Refresh()
+			ww.canvas.Unlock()
+			return
 		}
+		ww.typedKey(key)
 	})
 }
 
+// showSaveDialog asks for a file name and saves the drawing in the native format
+func (ww *WhiteboardWindow) showSaveDialog() {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ww.window)
+			return
+		}
+		if writer == nil {
+			return // Cancelled
+		}
+		defer writer.Close()
+
+		ww.canvas.Lock()
+		err = ww.canvas.Save(writer)
+		if err == nil && writer.URI().Scheme() == "file" {
+			ww.path = writer.URI().Path()
+		}
+		ww.canvas.Unlock()
+		if err != nil {
+			ioLog.Error("failed to save drawing", "uri", writer.URI().String(), "err", err)
+			dialog.ShowError(err, ww.window)
+			return
+		}
+		ioLog.Info("saved drawing", "uri", writer.URI().String())
+	}, ww.window)
+	saveDialog.SetFileName("whiteboard" + drawing.FileExtension)
+	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{drawing.FileExtension}))
+	saveDialog.Show()
+}
+
+// save writes the drawing to the file it was opened from or last saved to,
+// or asks for a file name if there is none
+func (ww *WhiteboardWindow) save() {
+	ww.canvas.Lock()
+	path := ww.path
+	ww.canvas.Unlock()
+
+	if path == "" {
+		ww.showSaveDialog()
+		return
+	}
+	if err := ww.SaveFile(path); err != nil {
+		ioLog.Error("failed to save drawing", "path", path, "err", err)
+		dialog.ShowError(err, ww.window)
+	}
+}
+
+// SaveFile writes the drawing to a file in the native format
+func (ww *WhiteboardWindow) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create drawing: %w", err)
+	}
+
+	ww.canvas.Lock()
+	err = ww.canvas.Save(f)
+	if err == nil {
+		ww.path = path
+	}
+	ww.canvas.Unlock()
+
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write drawing: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	ioLog.Info("saved drawing", "path", path)
+	return nil
+}
+
+// OpenFile replaces the drawing with a document in the native format
+func (ww *WhiteboardWindow) OpenFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open drawing: %w", err)
+	}
+	defer f.Close()
+
+	loaded, err := drawing.Load(f)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	ww.canvas.Lock()
+	ww.canvas.Replace(loaded)
+	ww.path = path
+	// The opened drawing's size is the one to return to after full screen
+	ww.screen.restoreWidth, ww.screen.restoreHeight = 0, 0
+	ww.fitCanvas(ww.drawingArea.Size())
+	ww.updateMapper()
+	ww.canvas.Unlock()
+
+	ioLog.Info("opened drawing", "path", path, "strokes", len(loaded.Strokes))
+	return nil
+}
+
+// ExportFile renders the drawing to a PNG or JPEG image, or its replay to
+// an animated GIF. A zero width or height keeps the canvas aspect ratio.
+func (ww *WhiteboardWindow) ExportFile(path string, width, height int) error {
+	// Rendering a copy keeps the pen responsive
+	ww.canvas.Lock()
+	snapshot := ww.canvas.Copy()
+	snapshot.CurrentStroke = nil
+	ww.canvas.Unlock()
+
+	width, height = render.ImageSize(snapshot, width, height)
+	if strings.EqualFold(filepath.Ext(path), ".gif") {
+		opts := render.DefaultAnimationOptions
+		opts.Width, opts.Height = width, height
+		err := render.WriteFile(path, func(w io.Writer) error {
+			return render.WriteGIF(w, drawing.NewReplay(snapshot), opts)
+		})
+		if err != nil {
+			return err
+		}
+	} else if err := render.WriteImage(path, render.Canvas(snapshot, width, height)); err != nil {
+		return err
+	}
+	ioLog.Info("exported drawing", "path", path, "width", width, "height", height)
+	return nil
+}
+
+// Tablet returns the tablet controller so it can be configured before
+// ConnectTablet is called
+func (ww *WhiteboardWindow) Tablet() *tablet.TabletController {
+	return ww.tablet
+}
+
+// SetPressureCurve sets the exponent applied to pen pressure.
+// It must be called before the tablet is connected.
+func (ww *WhiteboardWindow) SetPressureCurve(exponent float64) {
+	ww.curve = exponent
+}
+
+// SetSmoothing sets how strongly pen positions are smoothed, from 0 (off)
+// to 0.95. It must be called before the tablet is connected.
+func (ww *WhiteboardWindow) SetSmoothing(factor float64) {
+	ww.smoother = tablet.NewSmoother(factor)
+}
+
+// SetSpeedThinning makes new strokes thinner the faster the pen moves. The
+// speed is in canvas units per second at which the pressure-dependent part
+// of the width halves; 0 disables it.
+func (ww *WhiteboardWindow) SetSpeedThinning(speed float64) {
+	ww.canvas.Lock()
+	defer ww.canvas.Unlock()
+	ww.canvas.SpeedThinning = speed
+}
+
+// SetTipDebounce sets how many consecutive reports a change of the tip
+// switch may last and still be ignored as noise. It must be called before
+// the tablet is connected.
+func (ww *WhiteboardWindow) SetTipDebounce(reports int) {
+	ww.pen = tablet.NewPenTracker(reports)
+	// Only draw while the tip and the first button are both down
+	ww.pen.Contact = func(pen *tablet.PenData) bool {
+		return pen.PenDown && pen.Button1
+	}
+}
+
+// endStroke finishes the stroke being drawn and forgets the pen state, so
+// the next report is tracked from scratch
+func (ww *WhiteboardWindow) endStroke() {
+	ww.canvas.Lock()
+	defer ww.canvas.Unlock()
+	if ww.canvas.CurrentStroke != nil {
+		inputLog.Debug("forcing the current stroke to end")
+	}
+	ww.canvas.FinishStroke()
+	ww.pen.Reset()
+}
+
 // ConnectTablet attempts to connect to the XP-Pen tablet
 func (ww *WhiteboardWindow) ConnectTablet() error {
 	err := ww.tablet.Connect()
@@ -134,75 +449,177 @@ func (ww *WhiteboardWindow) ConnectTablet() error {
 		return err
 	}
 
-	// Update coordinate mapper with actual tablet dimensions
-	maxX, maxY := ww.tablet.GetTabletDimensions()
-	ww.mapper = tablet.NewCoordinateMapper(maxX, maxY, 1200, 900)
+	ww.startTabletInput()
+	return nil
+}
+
+// ConnectReportDevice reads pen input from an already opened report
+// device, such as a replayed capture
+func (ww *WhiteboardWindow) ConnectReportDevice(device tablet.ReportDevice) {
+	ww.tablet.ConnectDevice(device)
+	ww.startTabletInput()
+}
+
+// ConnectPenSource reads pen input from another source than the HID
+// tablet, such as a Linux input device
+func (ww *WhiteboardWindow) ConnectPenSource(source tablet.PenSource) {
+	ww.source = source
+	ww.startTabletInput()
+}
+
+// startTabletInput sizes the coordinate mapper for the connected tablet
+// and starts processing its input
+func (ww *WhiteboardWindow) startTabletInput() {
+	ww.canvas.Lock()
+	ww.updateMapper()
+	ww.canvas.Unlock()
 
 	// Start tablet input processing
 	go ww.processTabletInput()
+}
 
-	return nil
+// updateMapper maps the tablet surface onto the whole canvas.
+// The canvas lock must be held.
+func (ww *WhiteboardWindow) updateMapper() {
+	maxX, maxY := ww.source.GetTabletDimensions()
+	ww.mapper = tablet.NewCoordinateMapper(maxX, maxY, ww.canvas.Width, ww.canvas.Height)
+	ww.mapper.SetMaxPressure(ww.source.GetMaxPressure())
+	ww.mapper.SetPressureCurve(ww.curve)
 }
 
 // processTabletInput continuously reads tablet input
 func (ww *WhiteboardWindow) processTabletInput() {
-	fmt.Println("DEBUG: Starting tablet input processing...")
+	inputLog.Info("starting tablet input processing")
 
-	for ww.tablet.IsConnected() {
-		penData, err := ww.tablet.ReadPenData()
+	var previous *tablet.PenData
+	for ww.source.IsConnected() {
+		penData, err := ww.source.ReadPenData()
+		if errors.Is(err, io.EOF) {
+			break // A replayed capture has ended
+		}
+		if errors.Is(err, tablet.ErrDisconnected) {
+			inputLog.Warn("tablet disconnected", "err", err)
+			break
+		}
 		if err != nil {
+			if debugEnabled(inputLog) {
+				inputLog.Debug("skipping unreadable report", "err", err)
+			}
 			continue // Skip errors and keep trying
 		}
 
-		// Debug output for pen data
-		fmt.Printf("DEBUG: Pen data - X:%d Y:%d Pressure:%d PenDown:%t InRange:%t Button1:%t Button2:%t\n",
-			penData.X, penData.Y, penData.Pressure, penData.PenDown, penData.InRange, penData.Button1, penData.Button2)
-
-		// Special debug output for button presses
-		if penData.Button1 {
-			fmt.Println("DEBUG: *** BUTTON 1 PRESSED ***")
-		}
-		if penData.Button2 {
-			fmt.Println("DEBUG: *** BUTTON 2 PRESSED ***")
+		// Per-sample logging is guarded so it costs nothing when disabled
+		if debugEnabled(inputLog) {
+			inputLog.Debug("pen data",
+				"x", penData.X, "y", penData.Y, "pressure", penData.Pressure,
+				"penDown", penData.PenDown, "inRange", penData.InRange,
+				"button1", penData.Button1, "button2", penData.Button2)
 		}
 
-		// Convert to drawing point
-		point := ww.mapper.PenDataToPoint(penData)
+		// Samples go into the model at full rate; the frame pacer coalesces
+		// the resulting changes into display refreshes
+		ww.canvas.Lock()
 
-		// Handle pen input - only draw when pen is down AND button 1 is pressed
-		if penData.PenDown && penData.Button1 {
-			fmt.Printf("DEBUG: Drawing! Stylus touching tablet at position (%d, %d) with pressure %d and button pressed\n",
-				penData.X, penData.Y, penData.Pressure)
+		// Convert to drawing point
+		smoothed := ww.smoother.Smooth(penData)
+		point := ww.mapper.PenDataToPoint(smoothed)
 
+		// Draw while the debounced pen state is in contact
+		state := ww.pen.Update(smoothed)
+		// The pen does not draw while a replay is showing
+		if state == tablet.PenContact && ww.drawingArea.editable() {
 			if ww.canvas.CurrentStroke == nil {
-				fmt.Println("DEBUG: Starting new stroke")
-				ww.canvas.StartStroke(point)
+				// The stroke starts with the reports held while the touch
+				// down was debounced
+				var points []drawing.Point
+				for _, held := range ww.pen.TakeHeld() {
+					points = append(points, ww.mapper.PenDataToPoint(&held))
+				}
+				points = append(points, point)
+
+				inputLog.Debug("starting stroke", "x", points[0].X, "y", points[0].Y, "eraser", penData.Eraser)
+				if penData.Eraser {
+					// The eraser end of the pen always erases
+					ww.canvas.StartEraserStroke(points[0])
+				} else {
+					ww.canvas.StartStroke(points[0])
+				}
+				for _, p := range points[1:] {
+					ww.canvas.AddPointToCurrentStroke(p)
+				}
 			} else {
-				fmt.Println("DEBUG: Adding point to current stroke")
 				ww.canvas.AddPointToCurrentStroke(point)
 			}
 		} else if ww.canvas.CurrentStroke != nil {
-			// Pen lifted or button released, finish stroke
-			fmt.Println("DEBUG: Pen lifted or button released, finishing stroke")
+			// Pen lifted, button released or proximity lost
+			inputLog.Debug("pen left contact, finishing stroke", "state", state)
 			ww.canvas.FinishStroke()
 		}
+		eraser := penData.Eraser || ww.canvas.Eraser
+		width := ww.canvas.NextStrokeWidth(eraser)
+		ww.canvas.Unlock()
+
+		// Show where the pen will land while it hovers over the tablet
+		if state != tablet.PenOut {
+			ww.drawingArea.SetHover(point, width, eraser)
+			ww.penHovered(state, point.X, point.Y)
+		} else {
+			ww.drawingArea.HideHover()
+		}
+
+		ww.handlePenButtons(previous, penData)
+		previous = penData
+
+		ww.pacer.CountSample()
+	}
+
+	// Never leave a stroke open once input stops
+	ww.endStroke()
+	ww.drawingArea.HideHover()
 
-		// Refresh drawing area
-		ww.drawingArea.Refresh()
+	if ww.source == tablet.PenSource(ww.tablet) {
+		stats := ww.tablet.ReportStats()
+		inputLog.Info("tablet input processing stopped",
+			"penReports", stats.Pen, "keyReports", stats.Keys, "unknownReports", stats.Unknown)
+	} else {
+		inputLog.Info("tablet input processing stopped")
 	}
+}
+
+// SetMaxFrameRate limits how often the drawing area is refreshed.
+// It must be called before Show.
+func (ww *WhiteboardWindow) SetMaxFrameRate(fps int) {
+	ww.pacer = newFramePacer(ww.drawingArea, fps, ww.showFrameStats)
+}
 
-	fmt.Println("DEBUG: Tablet input processing stopped")
+// showFrameStats shows the pen sample rate and display frame rate in the
+// toolbar
+func (ww *WhiteboardWindow) showFrameStats(stats FrameStats) {
+	ww.stats.SetText(fmt.Sprintf("Pen %.0f Hz · %.0f fps", stats.SamplesPerSecond, stats.FramesPerSecond))
 }
 
 // Show displays the window
 func (ww *WhiteboardWindow) Show() {
+	go ww.pacer.Run()
+	defer ww.pacer.Stop()
+
 	ww.window.ShowAndRun()
 }
 
 // Close closes the window and disconnects tablet
 func (ww *WhiteboardWindow) Close() {
-	if ww.tablet != nil {
-		ww.tablet.Disconnect()
+	if ww.replay != nil {
+		ww.replay.Stop()
+	}
+	if ww.source != nil {
+		ww.source.Disconnect()
+	}
+	if ww.collab != nil {
+		ww.collab.Close()
+	}
+	if ww.control != nil {
+		ww.control.Close()
 	}
+	ww.pacer.Stop()
 	ww.app.Quit()
 }
@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"xp-pen-controller/internal/tablet"
+)
+
+// scriptedSource plays pen samples, then fails as an unplugged tablet does
+type scriptedSource struct {
+	mu        sync.Mutex
+	samples   []tablet.PenData
+	connected bool
+}
+
+func (s *scriptedSource) ReadPenData() (*tablet.PenData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == 0 {
+		s.connected = false
+		return nil, tablet.ErrDisconnected
+	}
+	pen := s.samples[0]
+	s.samples = s.samples[1:]
+	return &pen, nil
+}
+
+func (s *scriptedSource) GetTabletDimensions() (int, int) { return 32767, 32767 }
+func (s *scriptedSource) GetMaxPressure() int             { return 8191 }
+
+func (s *scriptedSource) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+func (s *scriptedSource) Disconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = false
+	return nil
+}
+
+func TestUnpluggingEndsTheStroke(t *testing.T) {
+	ww := NewWhiteboardWindow()
+	source := &scriptedSource{connected: true, samples: []tablet.PenData{
+		{X: 1000, Y: 1000, InRange: true},
+		{X: 1000, Y: 1000, Pressure: 4000, InRange: true, PenDown: true, Button1: true},
+		{X: 2000, Y: 1500, Pressure: 4000, InRange: true, PenDown: true, Button1: true},
+	}}
+	ww.ConnectPenSource(source)
+
+	// No sample lifts the pen, so only the disconnect can end the stroke
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ww.canvas.Lock()
+		strokes, open, state := len(ww.canvas.GetAllStrokes()), ww.canvas.CurrentStroke != nil, ww.pen.State()
+		ww.canvas.Unlock()
+		if strokes == 1 && !open && state == tablet.PenOut {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d strokes, stroke open: %v, pen %v; want one finished stroke and the pen out", strokes, open, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
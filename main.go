@@ -1,24 +1,209 @@
 package main
 
 import (
+	"cmp"
+	"flag"
+	"fmt"
+	"image/color"
 	"log"
+	"os"
+	"os/user"
 
+	"xp-pen-controller/internal/control"
+	"xp-pen-controller/internal/drawing"
+	"xp-pen-controller/internal/remote"
+	"xp-pen-controller/internal/tablet"
 	"xp-pen-controller/internal/ui"
 )
 
+// whiteboardOptions are the flags of the default command
+var whiteboardOptions struct {
+	open       string
+	fullscreen bool
+	evdev      string
+	mirror     string
+	user       string
+	color      string
+	listen     string
+	join       string
+	token      string
+	remotePen  string
+	penToken   string
+	control    string
+	controlWeb string
+}
+
+var whiteboardCommand = &command{
+	name:    "whiteboard",
+	summary: "Launch the whiteboard (default when no command is given)",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&whiteboardOptions.open, "open", "", "drawing to open at startup")
+		fs.BoolVar(&whiteboardOptions.fullscreen, "fullscreen", false, "start in full-screen mode (F11 toggles it)")
+		fs.StringVar(&whiteboardOptions.evdev, "evdev", "", "read the pen from a Linux input device, given by name or /dev/input path, instead of raw HID")
+		fs.StringVar(&whiteboardOptions.mirror, "mirror", "", "share the board read-only with web browsers on this address, e.g. :8080")
+		fs.StringVar(&whiteboardOptions.remotePen, "remote-pen", "", `draw with the pen sent by "scrawl send" to this UDP address, e.g. :7071`)
+		fs.StringVar(&whiteboardOptions.penToken, "remote-pen-token", "", `secret shared with "scrawl send"; required to receive on other than loopback`)
+		fs.StringVar(&whiteboardOptions.control, "control-socket", "", `Unix socket for "scrawl ctl", or "off" (default `+control.DefaultSocket()+`)`)
+		fs.StringVar(&whiteboardOptions.controlWeb, "control-http", "", "also serve the control API over HTTP on this loopback address, e.g. 127.0.0.1:7072")
+		fs.StringVar(&whiteboardOptions.user, "user", "", "name to draw as when collaborating (default: login name)")
+		fs.StringVar(&whiteboardOptions.color, "color", "", "colour of your strokes as #rrggbb")
+		fs.StringVar(&whiteboardOptions.listen, "listen", "", "let other whiteboards join the board on this address, e.g. :7070")
+		fs.StringVar(&whiteboardOptions.join, "join", "", "draw together with the whiteboard at this address, e.g. host:7070")
+		fs.StringVar(&whiteboardOptions.token, "token", "", "secret shared by the whiteboards drawing together; required to listen on other than loopback")
+	},
+	run: runWhiteboard,
+}
+
 func main() {
+	if err := runCLI(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "scrawl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runWhiteboard launches the whiteboard window
+func runWhiteboard(env *environment, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
 	// Create the whiteboard window
 	window := ui.NewWhiteboardWindow()
-
-	// Try to connect to the tablet
-	err := window.ConnectTablet()
+	window.Tablet().SetProfile(env.profile)
+	window.Tablet().SetDevicePath(env.config.Device)
+	if env.config.MaxFrameRate > 0 {
+		window.SetMaxFrameRate(env.config.MaxFrameRate)
+	}
+	bindings, err := ui.ParseBindings(env.config.Bindings)
 	if err != nil {
-		log.Printf("Warning: Failed to connect to XP-Pen tablet: %v", err)
-		log.Println("The application will still work, but tablet input will not be available.")
+		return fmt.Errorf("invalid bindings: %w", err)
+	}
+	window.SetBindings(bindings)
+
+	if whiteboardOptions.open != "" {
+		if err := window.OpenFile(whiteboardOptions.open); err != nil {
+			return err
+		}
+	}
+	if whiteboardOptions.fullscreen || env.config.Fullscreen {
+		window.SetFullScreen(true)
+	}
+
+	window.SetPressureCurve(env.config.PressureCurve)
+	window.SetSmoothing(env.config.Smoothing)
+	window.SetTipDebounce(env.config.TipDebounce)
+	window.SetSpeedThinning(env.config.SpeedThinning)
+
+	mirrorAddr := whiteboardOptions.mirror
+	if mirrorAddr == "" {
+		mirrorAddr = env.config.Mirror
+	}
+	if mirrorAddr != "" {
+		if err := window.ServeMirror(mirrorAddr); err != nil {
+			return err
+		}
+	}
+
+	if err := serveControl(window, env); err != nil {
+		return err
+	}
+
+	if err := collaborate(window, env); err != nil {
+		return err
+	}
+
+	evdev := whiteboardOptions.evdev
+	if evdev == "" {
+		evdev = env.config.Evdev
+	}
+
+	// The pen comes from another machine, or else from a tablet here
+	remotePen := cmp.Or(whiteboardOptions.remotePen, env.config.RemotePen)
+	if remotePen != "" {
+		source, err := remote.Listen(remotePen, cmp.Or(whiteboardOptions.penToken, env.config.RemotePenToken))
+		if err != nil {
+			return err
+		}
+		window.ConnectPenSource(source)
+		log.Printf("Waiting for the pen from \"scrawl send\" on %s", source.Addr())
 	} else {
-		log.Println("Successfully connected to XP-Pen tablet")
+		// Try to connect to the tablet
+		if evdev != "" {
+			var source *tablet.EvdevSource
+			source, err = tablet.OpenEvdev(evdev)
+			if err == nil {
+				window.ConnectPenSource(source)
+			}
+		} else {
+			err = window.ConnectTablet()
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to connect to XP-Pen tablet: %v", err)
+			log.Println("The application will still work, but tablet input will not be available.")
+		} else {
+			log.Println("Successfully connected to XP-Pen tablet")
+		}
 	}
 
 	// Show the window (this blocks until the window is closed)
 	window.Show()
+	return nil
+}
+
+// controlOff disables the control socket
+const controlOff = "off"
+
+// serveControl starts the scripting API. The default socket is a
+// convenience, so failing to create it is only a warning.
+func serveControl(window *ui.WhiteboardWindow, env *environment) error {
+	socket := cmp.Or(whiteboardOptions.control, env.config.ControlSocket)
+	httpAddr := cmp.Or(whiteboardOptions.controlWeb, env.config.ControlHTTP)
+	explicit := socket != ""
+	switch socket {
+	case "":
+		socket = control.DefaultSocket()
+	case controlOff:
+		socket = ""
+	}
+
+	err := window.ServeControl(socket, httpAddr)
+	if err == nil || explicit || socket == "" {
+		return err
+	}
+	log.Printf("Warning: %v", err)
+	if httpAddr == "" {
+		return nil
+	}
+	return window.ServeControl("", httpAddr)
+}
+
+// collaborate starts drawing together with other whiteboards if a listen
+// or join address is configured, and applies the user's colour
+func collaborate(window *ui.WhiteboardWindow, env *environment) error {
+	name := cmp.Or(whiteboardOptions.user, env.config.User)
+	colorSpec := cmp.Or(whiteboardOptions.color, env.config.Color)
+	listen := cmp.Or(whiteboardOptions.listen, env.config.CollabListen)
+	join := cmp.Or(whiteboardOptions.join, env.config.CollabJoin)
+	token := cmp.Or(whiteboardOptions.token, env.config.CollabToken)
+
+	var col color.Color
+	if colorSpec != "" {
+		var err error
+		if col, err = drawing.ParseColor(colorSpec); err != nil {
+			return err
+		}
+	}
+	if listen == "" && join == "" {
+		if col != nil {
+			window.SetColor(col)
+		}
+		return nil
+	}
+
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	return window.Collaborate(name, col, token, listen, join)
 }
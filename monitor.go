@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"xp-pen-controller/internal/diag"
+	"xp-pen-controller/internal/tablet"
+)
+
+// monitorOptions are the flags of the monitor command
+var monitorOptions struct {
+	plain    bool
+	interval time.Duration
+}
+
+var monitorCommand = &command{
+	name:    "monitor",
+	summary: "Show raw reports and the decoded pen state live",
+	flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&monitorOptions.plain, "plain", false, "print one line per report instead of the live view")
+		fs.DurationVar(&monitorOptions.interval, "interval", 50*time.Millisecond, "minimum time between screen updates")
+	},
+	run: runMonitor,
+}
+
+// redrawInterval is how often the live view is redrawn while no reports
+// arrive, so it shows when the tablet goes quiet
+const redrawInterval = 250 * time.Millisecond
+
+// monitorRead is a report or error read from the tablet
+type monitorRead struct {
+	report []byte
+	err    error
+}
+
+// runMonitor shows every report until the tablet disconnects
+func runMonitor(env *environment, args []string) error {
+	tc := env.newTablet()
+	if err := tc.Connect(); err != nil {
+		return err
+	}
+	defer tc.Disconnect()
+
+	monitor := diag.NewMonitor(env.profile)
+	var lastRender time.Time
+
+	// Read in the background so the view is redrawn without reports too
+	reads := make(chan monitorRead, 64)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			report, err := tc.ReadReport()
+			select {
+			case reads <- monitorRead{report, err}:
+			case <-done:
+				return
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, tablet.ErrDisconnected) {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	fmt.Printf("Monitoring %s, press Ctrl+C to stop\n", env.profile.Name)
+	for {
+		var read monitorRead
+		select {
+		case read = <-reads:
+		case now := <-ticker.C:
+			if !monitorOptions.plain {
+				monitor.Refresh(now)
+				monitor.Render(os.Stdout)
+				lastRender = now
+			}
+			continue
+		}
+
+		report, err := read.report, read.err
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, tablet.ErrDisconnected) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+
+		if monitorOptions.plain {
+			printReport(env, report)
+			continue
+		}
+
+		// Accumulate every report but only redraw the screen periodically
+		now := time.Now()
+		monitor.Update(report, now)
+		if now.Sub(lastRender) >= monitorOptions.interval {
+			monitor.Render(os.Stdout)
+			lastRender = now
+		}
+	}
+}
+
+// printReport prints a report and its decoded pen state on one line
+func printReport(env *environment, report []byte) {
+	pen, err := env.profile.Layout.Decode(report)
+	if err != nil {
+		fmt.Printf("% x  error: %v\n", report, err)
+		return
+	}
+
+	fmt.Printf("% x  X:%5d Y:%5d Pressure:%4d PenDown:%-5t InRange:%-5t Button1:%-5t Button2:%-5t\n",
+		report, pen.X, pen.Y, pen.Pressure, pen.PenDown, pen.InRange, pen.Button1, pen.Button2)
+}
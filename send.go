@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"xp-pen-controller/internal/remote"
+)
+
+// sendOptions are the flags of the send command
+var sendOptions struct {
+	evdev string
+	token string
+	stats bool
+}
+
+var sendCommand = &command{
+	name:    "send",
+	args:    "<host[:port]>",
+	summary: "Stream the pen to a whiteboard on another machine",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&sendOptions.evdev, "evdev", "", "read the pen from a Linux input device, given by name or /dev/input path, instead of raw HID")
+		fs.StringVar(&sendOptions.token, "token", "", "secret the whiteboard was given with -remote-pen-token")
+		fs.BoolVar(&sendOptions.stats, "stats", false, "print the round trip to the whiteboard every few seconds")
+	},
+	run: runSend,
+}
+
+// runSend forwards the pen to a whiteboard started with -remote-pen until
+// interrupted
+func runSend(env *environment, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected the address of the whiteboard")
+	}
+
+	source, err := openPenSource(env, sendOptions.evdev)
+	if err != nil {
+		return err
+	}
+	defer source.Disconnect()
+
+	sender, err := remote.Dial(args[0], cmp.Or(sendOptions.token, env.config.RemotePenToken))
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		source.Disconnect()
+	}()
+
+	if sendOptions.stats {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				stats := sender.Stats()
+				fmt.Printf("%d samples sent, round trip %s\n", stats.Samples, stats.RoundTrip.Round(10*time.Microsecond))
+			}
+		}()
+	}
+
+	fmt.Printf("Sending pen input to %s, press Ctrl+C to stop\n", args[0])
+	return sender.Run(source)
+}